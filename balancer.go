@@ -1,8 +1,62 @@
 package iproto
 
+import (
+	"math/rand"
+	"sync"
+)
+
+// Connected is implemented by end points which could lose connection to remote side
+type Connected interface {
+	Connected() bool
+}
+
+// Loaded is implemented by end points which know how many requests they are performing now
+type Loaded interface {
+	InFlight() int
+}
+
+// Strategy chooses child of BalancerPoint for a request.
+// Pick is called from a single goroutine, so strategy could keep state without locking.
+// It should return nil if no child is available.
+type Strategy interface {
+	Pick(children []*BalancerChild) *BalancerChild
+}
+
+const balancerChildQueue = 16
+
+type BalancerChild struct {
+	EndPoint
+	Weight  int
+	ch      chan *Request
+	current int
+}
+
+// Available reports false for disconnected children
+func (c *BalancerChild) Available() bool {
+	if cn, ok := c.EndPoint.(Connected); ok {
+		return cn.Connected()
+	}
+	return true
+}
+
+// Load is a count of requests queued to child and performed by it
+func (c *BalancerChild) Load() int {
+	l := len(c.ch)
+	if ld, ok := c.EndPoint.(Loaded); ok {
+		l += ld.InFlight()
+	}
+	return l
+}
+
+// BalancerPoint spreads requests among children.
+// Without Strategy all children read from one shared channel,
+// so whichever child is ready first takes a request.
 type BalancerPoint struct {
 	SimplePoint
+	Strategy Strategy
 	children []EndPoint
+	balanced []*BalancerChild
+	m        sync.Mutex
 }
 
 func (b *BalancerPoint) Init() {
@@ -10,18 +64,162 @@ func (b *BalancerPoint) Init() {
 }
 
 func (b *BalancerPoint) AddChild(ch EndPoint) {
+	b.AddWeighted(ch, 1)
+}
+
+// AddWeighted adds child with a weight used by Weighted strategy
+func (b *BalancerPoint) AddWeighted(ch EndPoint, weight int) {
+	child := &BalancerChild{EndPoint: ch, Weight: weight}
+	if b.Strategy != nil {
+		/* dispatch may pick child as soon as it is published */
+		child.ch = make(chan *Request, balancerChildQueue)
+	}
+	b.m.Lock()
 	b.children = append(b.children, ch)
+	balanced := make([]*BalancerChild, len(b.balanced), len(b.balanced)+1)
+	copy(balanced, b.balanced)
+	b.balanced = append(balanced, child)
+	b.m.Unlock()
 	if b.Runned() {
-		ch.Run(b.b.ch)
+		b.runChild(child)
+	}
+}
+
+func (b *BalancerPoint) runChild(child *BalancerChild) {
+	if b.Strategy == nil {
+		child.Run(b.b.ch)
+	} else {
+		if child.ch == nil {
+			/* added before Strategy was set, dispatch is not started yet */
+			child.ch = make(chan *Request, balancerChildQueue)
+		}
+		child.Run(child.ch)
 	}
 }
 
+func (b *BalancerPoint) snapshot() []*BalancerChild {
+	b.m.Lock()
+	balanced := b.balanced
+	b.m.Unlock()
+	return balanced
+}
+
 func (b *BalancerPoint) Loop() {
-	for _, ch := range b.children {
-		b.RunChild(ch)
+	for _, child := range b.snapshot() {
+		b.runChild(child)
+	}
+	if b.Strategy != nil {
+		b.dispatch()
+	} else {
+		<-b.ExitChan()
+	}
+	for _, child := range b.snapshot() {
+		child.Stop()
+	}
+}
+
+func (b *BalancerPoint) dispatch() {
+	for {
+		select {
+		case <-b.ExitChan():
+			return
+		case req, ok := <-b.ReceiveChan():
+			if !ok {
+				<-b.ExitChan()
+				return
+			}
+			if child := b.Strategy.Pick(b.snapshot()); child == nil {
+				req.IOError()
+			} else {
+				select {
+				case child.ch <- req:
+				case <-b.ExitChan():
+					req.IOError()
+					return
+				}
+			}
+		}
+	}
+}
+
+// RoundRobin passes requests to available children in turn
+type RoundRobin struct {
+	next int
+}
+
+func (rr *RoundRobin) Pick(children []*BalancerChild) *BalancerChild {
+	l := len(children)
+	for i := 0; i < l; i++ {
+		child := children[(rr.next+i)%l]
+		if child.Available() {
+			rr.next = (rr.next + i + 1) % l
+			return child
+		}
+	}
+	return nil
+}
+
+// Weighted is a smooth weighted round robin, as in nginx
+type Weighted struct{}
+
+func (Weighted) Pick(children []*BalancerChild) (best *BalancerChild) {
+	total := 0
+	for _, child := range children {
+		if child.Weight <= 0 || !child.Available() {
+			continue
+		}
+		child.current += child.Weight
+		total += child.Weight
+		if best == nil || child.current > best.current {
+			best = child
+		}
+	}
+	if best != nil {
+		best.current -= total
+	}
+	return
+}
+
+// LeastOutstanding passes request to a child with least load
+type LeastOutstanding struct{}
+
+func (LeastOutstanding) Pick(children []*BalancerChild) (best *BalancerChild) {
+	min := 0
+	for _, child := range children {
+		if !child.Available() {
+			continue
+		}
+		if l := child.Load(); best == nil || l < min {
+			best, min = child, l
+		}
+	}
+	return
+}
+
+// PowerOfTwo passes request to less loaded child of two randomly chosen
+type PowerOfTwo struct {
+	available []*BalancerChild
+}
+
+func (p *PowerOfTwo) Pick(children []*BalancerChild) *BalancerChild {
+	p.available = p.available[:0]
+	for _, child := range children {
+		if child.Available() {
+			p.available = append(p.available, child)
+		}
 	}
-	<-b.ExitChan()
-	for _, ch := range b.children {
-		ch.Stop()
+	switch l := len(p.available); l {
+	case 0:
+		return nil
+	case 1:
+		return p.available[0]
+	default:
+		i := rand.Intn(l)
+		j := (i + 1 + rand.Intn(l-1)) % l
+		a, b := p.available[i], p.available[j]
+		if b.Load() < a.Load() {
+			return b
+		}
+		return a
 	}
 }
@@ -0,0 +1,220 @@
+package iproto_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	nt "github.com/funny-falcon/go-iproto/net"
+	"github.com/funny-falcon/go-iproto/net/iprototest"
+)
+
+const msgBalance = iproto.RequestType(19)
+
+type loadPoint struct {
+	iproto.SF
+	load int
+	down bool
+}
+
+func (p *loadPoint) Run(chan *iproto.Request) {}
+func (p *loadPoint) Stop()                    {}
+func (p *loadPoint) Connected() bool          { return !p.down }
+func (p *loadPoint) InFlight() int            { return p.load }
+
+// queuePoint never reads its queue
+type queuePoint struct {
+	loadPoint
+	ch atomic.Value
+}
+
+func (p *queuePoint) Run(ch chan *iproto.Request) { p.ch.Store(ch) }
+
+func (p *queuePoint) full() bool {
+	ch, _ := p.ch.Load().(chan *iproto.Request)
+	return ch != nil && len(ch) == cap(ch)
+}
+
+func children(points ...*loadPoint) (cs []*iproto.BalancerChild) {
+	for _, p := range points {
+		cs = append(cs, &iproto.BalancerChild{EndPoint: p, Weight: 1})
+	}
+	return
+}
+
+func picks(t *testing.T, s iproto.Strategy, cs []*iproto.BalancerChild, n int) []int {
+	t.Helper()
+	counts := make([]int, len(cs))
+	for i := 0; i < n; i++ {
+		child := s.Pick(cs)
+		for j := range cs {
+			if cs[j] == child {
+				counts[j]++
+			}
+		}
+		if child == nil {
+			t.Fatalf("No child is picked")
+		}
+	}
+	return counts
+}
+
+func TestRoundRobin(t *testing.T) {
+	cs := children(&loadPoint{}, &loadPoint{down: true}, &loadPoint{})
+	if c := picks(t, &iproto.RoundRobin{}, cs, 10); c[0] != 5 || c[1] != 0 || c[2] != 5 {
+		t.Errorf("Requests are not spread over available children: %v", c)
+	}
+	if child := (&iproto.RoundRobin{}).Pick(children(&loadPoint{down: true})); child != nil {
+		t.Errorf("Unavailable child is picked")
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	cs := children(&loadPoint{}, &loadPoint{}, &loadPoint{}, &loadPoint{down: true})
+	cs[0].Weight, cs[1].Weight, cs[2].Weight, cs[3].Weight = 5, 1, 0, 5
+	var s iproto.Weighted
+	seq := make([]*iproto.BalancerChild, 6)
+	for i := range seq {
+		seq[i] = s.Pick(cs)
+	}
+	// smooth: heavy child does not take all requests in a row
+	if seq[0] != cs[0] || seq[1] != cs[0] || seq[2] != cs[0] || seq[3] != cs[1] || seq[4] != cs[0] || seq[5] != cs[0] {
+		t.Errorf("Unexpected weighted sequence")
+	}
+	if c := picks(t, s, cs, 60); c[0] != 50 || c[1] != 10 || c[2] != 0 || c[3] != 0 {
+		t.Errorf("Requests are not spread by weight: %v", c)
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	cs := children(&loadPoint{load: 3}, &loadPoint{load: 2}, &loadPoint{load: 1, down: true})
+	if child := (iproto.LeastOutstanding{}).Pick(cs); child != cs[1] {
+		t.Errorf("Least loaded available child is not picked")
+	}
+	if child := (iproto.LeastOutstanding{}).Pick(cs[2:]); child != nil {
+		t.Errorf("Unavailable child is picked")
+	}
+}
+
+func TestPowerOfTwo(t *testing.T) {
+	cs := children(&loadPoint{load: 5}, &loadPoint{}, &loadPoint{down: true})
+	if c := picks(t, &iproto.PowerOfTwo{}, cs, 100); c[1] != 100 {
+		t.Errorf("Less loaded child of two is not picked: %v", c)
+	}
+	cs = children(&loadPoint{load: 1}, &loadPoint{load: 1}, &loadPoint{load: 1})
+	if c := picks(t, &iproto.PowerOfTwo{}, cs, 300); c[0] == 0 || c[1] == 0 || c[2] == 0 {
+		t.Errorf("Equally loaded children are not chosen randomly: %v", c)
+	}
+	if child := (&iproto.PowerOfTwo{}).Pick(cs[:0]); child != nil {
+		t.Errorf("Child is picked from empty set")
+	}
+}
+
+func balancer(t *testing.T, s iproto.Strategy, n int) (*iproto.BalancerPoint, []*iprototest.Server) {
+	b := &iproto.BalancerPoint{Strategy: s}
+	b.Init()
+	srvs := make([]*iprototest.Server, n)
+	for i := range srvs {
+		srvs[i] = iprototest.NewServer(nt.RC4byte)
+		b.AddChild(srvs[i].Config().NewServer())
+	}
+	iproto.Run(b)
+	t.Cleanup(func() {
+		b.Stop()
+		for _, srv := range srvs {
+			srv.Close()
+		}
+	})
+	// wait for connections
+	time.Sleep(50 * time.Millisecond)
+	return b, srvs
+}
+
+func TestBalancerInFlight(t *testing.T) {
+	b, srvs := balancer(t, iproto.LeastOutstanding{}, 2)
+
+	srvs[0].Script(msgBalance, iprototest.Reply{Delay: 200 * time.Millisecond})
+	var cx iproto.Context
+	_, slow := cx.SendMsgBody(b, msgBalance, nil)
+	if !srvs[0].Wait(1, time.Second) {
+		t.Fatalf("First request is not sent to first child")
+	}
+	for i := 0; i < 3; i++ {
+		iproto.CallMsgBody(b, msgBalance, nil)
+	}
+	if n := len(srvs[1].RequestsOf(msgBalance)); n != 3 {
+		t.Errorf("Requests should avoid child with request in fly, second child got %d", n)
+	}
+	<-slow
+}
+
+func TestBalancerAddChild(t *testing.T) {
+	b, srvs := balancer(t, &iproto.RoundRobin{}, 1)
+
+	srv := iprototest.NewServer(nt.RC4byte)
+	defer srv.Close()
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 20; i++ {
+			iproto.CallMsgBody(b, msgBalance, nil)
+		}
+		close(done)
+	}()
+	b.AddChild(srv.Config().NewServer())
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Balancer is blocked by added child")
+	}
+	if n := len(srvs[0].RequestsOf(msgBalance)) + len(srv.RequestsOf(msgBalance)); n != 20 {
+		t.Errorf("Lost requests: %d of 20", n)
+	}
+}
+
+func TestBalancerStop(t *testing.T) {
+	b := &iproto.BalancerPoint{Strategy: &iproto.RoundRobin{}}
+	b.Init()
+	child := &queuePoint{}
+	b.AddChild(child)
+	iproto.Run(b)
+	var cx iproto.Context
+	var reses []<-chan *iproto.Response
+	for i := 0; i < 20; i++ {
+		_, res := cx.SendMsgBody(b, msgBalance, nil)
+		reses = append(reses, res)
+	}
+	for i := 0; !child.full(); i++ {
+		if i == 100 {
+			t.Fatalf("Child's queue is not filled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// let dispatch block on full queue
+	time.Sleep(10 * time.Millisecond)
+	stopped := make(chan struct{})
+	go func() {
+		b.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("Balancer is blocked by full child's queue")
+	}
+	// child's queue is full, so request blocked in dispatch fails on stop
+	time.Sleep(10 * time.Millisecond)
+	failed := 0
+	for _, res := range reses {
+		select {
+		case r := <-res:
+			if r.Code == iproto.RcIOError {
+				failed++
+			}
+		default:
+		}
+	}
+	if failed != 1 {
+		t.Errorf("Request blocked in dispatch should fail with IOError, %d failed", failed)
+	}
+}
@@ -11,10 +11,14 @@ var _ = log.Print
 type bufBookmark struct {
 	Bookmark
 	state uint32
+	size  int
+	buf   *Buffer
 }
 
 func (b *bufBookmark) Respond(r *Response) {
-	b.state = bsFree
+	if atomic.SwapUint32(&b.state, bsFree) == bsSet {
+		b.buf.dequeued(b.size)
+	}
 }
 
 const (
@@ -32,51 +36,268 @@ type bufferRow struct {
 	row [bufRow]bufBookmark
 }
 
-type Buffer struct {
-	ch         chan *Request
-	onExit     func()
-	set        chan bool
-	m          sync.Mutex
+// Overflow is a policy of bounded queue of SimplePoint
+type Overflow uint8
+
+const (
+	// OverflowReject answers new request with overflow code
+	OverflowReject = Overflow(iota)
+	// OverflowBlock blocks Send until queue has room
+	OverflowBlock
+	// OverflowDropOldest answers oldest queued request with RcTimeout
+	OverflowDropOldest
+)
+
+// queue is a growing ring of bookmarks of one priority class
+type queue struct {
 	rows       map[uint64]*bufferRow
 	head, tail uint64
 	hRow, tRow *bufferRow
+	// skipped counts requests of higher classes sent while this queue were waiting
+	skipped int
 }
 
-func (b *Buffer) init() {
-	b.rows = make(map[uint64]*bufferRow)
+func (q *queue) init() {
+	q.rows = make(map[uint64]*bufferRow)
 	row := new(bufferRow)
-	b.hRow, b.tRow, b.rows[0] = row, row, row
-	b.set = make(chan bool, 1)
+	q.hRow, q.tRow, q.rows[0] = row, row, row
 }
 
-func (b *Buffer) push(r *Request) {
-	if b.tail == b.head {
-		select {
-		case b.ch <- r:
-			return
-		default:
-		}
-	}
+func (q *queue) empty() bool {
+	return atomic.LoadUint64(&q.tail) == atomic.LoadUint64(&q.head)
+}
 
-	tail := atomic.AddUint64(&b.tail, 1) - 1
+// reserve returns bookmark at tail, m guards rows
+func (q *queue) reserve(m *sync.Mutex) *bufBookmark {
+	tail := atomic.AddUint64(&q.tail, 1) - 1
 	big := tail / bufRow
-	row := b.tRow
+	row := q.tRow
 	if row.id != big {
 		var ok bool
-		b.m.Lock()
-		if row, ok = b.rows[big]; !ok {
+		m.Lock()
+		if row, ok = q.rows[big]; !ok {
 			row = &bufferRow{id: big}
-			b.rows[big] = row
-			b.tRow = row
+			q.rows[big] = row
+			q.tRow = row
 		}
+		m.Unlock()
+	}
+	return &row.row[tail%bufRow]
+}
+
+// first skips answered bookmarks and returns first queued one.
+// It returns nil if queue is empty or first bookmark is not set yet.
+func (q *queue) first(m *sync.Mutex) *bufBookmark {
+	for ; q.head < atomic.LoadUint64(&q.tail); atomic.AddUint64(&q.head, 1) {
+		var ok bool
+		big := q.head / bufRow
+		row := q.hRow
+		if row.id != big {
+			m.Lock()
+			row, ok = q.rows[big]
+			delete(q.rows, big-1)
+			m.Unlock()
+			if !ok {
+				return nil
+			}
+			q.hRow = row
+		}
+		middle := &row.row[q.head%bufRow]
+		switch atomic.LoadUint32(&middle.state) {
+		case bsNew:
+			return nil
+		case bsSet:
+			return middle
+		}
+	}
+	return nil
+}
+
+// oldest returns first queued request, m should be locked
+func (q *queue) oldest() *Request {
+	for i := atomic.LoadUint64(&q.head); i < atomic.LoadUint64(&q.tail); i++ {
+		row := q.rows[i/bufRow]
+		if row == nil {
+			continue
+		}
+		middle := &row.row[i%bufRow]
+		if atomic.LoadUint32(&middle.state) == bsSet {
+			middle.Lock()
+			req := middle.Request
+			middle.Unlock()
+			if req != nil {
+				return req
+			}
+		}
+	}
+	return nil
+}
+
+// StarvationLimit is a number of requests of higher priority sent while lower priority
+// request waits, after which lower priority request is sent
+var StarvationLimit = 8
+
+type Buffer struct {
+	ch     chan *Request
+	onExit func()
+	set    chan bool
+	m      sync.Mutex
+	// queues are indexed by priority class, only normal one is used without priorities
+	queues     [nPriorities]queue
+	priorities bool
+
+	queued, bytes int64
+
+	maxLen, maxBytes int
+	overflow         Overflow
+	code             RetCode
+	room             *sync.Cond
+	waiters          int32
+	closed           bool
+}
+
+func (b *Buffer) init() {
+	for i := range b.queues {
+		b.queues[i].init()
+	}
+	b.set = make(chan bool, 1)
+	b.room = sync.NewCond(&b.m)
+}
+
+func (b *Buffer) queue(r *Request) *queue {
+	if b.priorities {
+		return &b.queues[r.Priority.class()]
+	}
+	return &b.queues[PriorityNormal.class()]
+}
+
+func (b *Buffer) empty() bool {
+	for i := range b.queues {
+		if !b.queues[i].empty() {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Buffer) bounded() bool {
+	return b.maxLen > 0 || b.maxBytes > 0
+}
+
+func (b *Buffer) full(size int) bool {
+	if b.maxLen > 0 && atomic.LoadInt64(&b.queued) >= int64(b.maxLen) {
+		return true
+	}
+	if b.maxBytes > 0 {
+		bytes := atomic.LoadInt64(&b.bytes)
+		return bytes > 0 && bytes+int64(size) > int64(b.maxBytes)
+	}
+	return false
+}
+
+func (b *Buffer) dequeued(size int) {
+	atomic.AddInt64(&b.queued, -1)
+	atomic.AddInt64(&b.bytes, -int64(size))
+	if atomic.LoadInt32(&b.waiters) > 0 {
+		b.m.Lock()
+		b.room.Broadcast()
 		b.m.Unlock()
 	}
+}
+
+// blockBookmark wakes blocked Send when its request is answered while waiting for room
+type blockBookmark struct {
+	Bookmark
+	buf *Buffer
+	// answered is guarded by buf.m
+	answered bool
+}
+
+func (w *blockBookmark) Respond(res *Response) {
+	w.buf.m.Lock()
+	w.answered = true
+	w.buf.room.Broadcast()
+	w.buf.m.Unlock()
+}
+
+// overflowed applies overflow policy, it returns false if request should not be queued
+func (b *Buffer) overflowed(r *Request, size int) bool {
+	if !b.full(size) {
+		return true
+	}
+	switch b.overflow {
+	case OverflowBlock:
+		waiter := &blockBookmark{buf: b}
+		if !r.ChainBookmark(waiter) {
+			return false
+		}
+		b.m.Lock()
+		atomic.AddInt32(&b.waiters, 1)
+		for b.full(size) && !b.closed && !waiter.answered {
+			b.room.Wait()
+		}
+		atomic.AddInt32(&b.waiters, -1)
+		closed := b.closed
+		b.m.Unlock()
+		/* waiter is on top of chain, unless request is answered and chain is passed */
+		r.Lock()
+		queue := r.chain == RequestBookmark(waiter)
+		if queue {
+			waiter.unchain()
+		}
+		r.Unlock()
+		/* buffer is closed by Stop, so request could not be queued */
+		if queue && closed {
+			r.RespondFail(RcShutdown)
+			return false
+		}
+		return queue
+	case OverflowDropOldest:
+		for b.full(size) {
+			req := b.oldest()
+			if req == nil {
+				break
+			}
+			req.Expire()
+		}
+		return true
+	}
+	r.RespondFail(b.code)
+	return false
+}
+
+// oldest returns oldest request of lowest priority
+func (b *Buffer) oldest() *Request {
+	b.m.Lock()
+	defer b.m.Unlock()
+	for i := range b.queues {
+		if req := b.queues[i].oldest(); req != nil {
+			return req
+		}
+	}
+	return nil
+}
+
+func (b *Buffer) push(r *Request) {
+	if b.bounded() && !b.overflowed(r, len(r.Body)) {
+		return
+	}
+	if b.empty() {
+		select {
+		case b.ch <- r:
+			return
+		default:
+		}
+	}
 
-	middle := &row.row[tail%bufRow]
-	if r.ChainBookmark(middle) {
-		middle.state = bsSet
-	} else {
-		middle.state = bsFree
+	middle := b.queue(r).reserve(&b.m)
+	middle.buf = b
+	middle.size = len(r.Body)
+	atomic.AddInt64(&b.queued, 1)
+	atomic.AddInt64(&b.bytes, int64(middle.size))
+	if !r.ChainBookmark(middle) || !atomic.CompareAndSwapUint32(&middle.state, bsNew, bsSet) {
+		atomic.StoreUint32(&middle.state, bsFree)
+		b.dequeued(middle.size)
 	}
 	select {
 	case b.set <- true:
@@ -84,7 +305,20 @@ func (b *Buffer) push(r *Request) {
 	}
 }
 
+func (b *Buffer) len() int {
+	return len(b.ch) + int(atomic.LoadInt64(&b.queued))
+}
+
+// size is a body size of requests in buffer, requests in channel are not counted
+func (b *Buffer) size() int {
+	return int(atomic.LoadInt64(&b.bytes))
+}
+
 func (b *Buffer) close() {
+	b.m.Lock()
+	b.closed = true
+	b.room.Broadcast()
+	b.m.Unlock()
 	select {
 	case b.set <- true:
 	default:
@@ -92,34 +326,41 @@ func (b *Buffer) close() {
 	close(b.set)
 }
 
+// next returns first bookmark of highest priority, unless lower priority starves
+func (b *Buffer) next() *bufBookmark {
+	var firsts [nPriorities]*bufBookmark
+	top := -1
+	for i := range b.queues {
+		if firsts[i] = b.queues[i].first(&b.m); firsts[i] != nil {
+			top = i
+		}
+	}
+	if top < 0 {
+		return nil
+	}
+	for i := top - 1; i >= 0; i-- {
+		if firsts[i] == nil {
+			continue
+		}
+		q := &b.queues[i]
+		if q.skipped++; q.skipped > StarvationLimit {
+			q.skipped = 0
+			return firsts[i]
+		}
+	}
+	b.queues[top].skipped = 0
+	return firsts[top]
+}
+
 func (b *Buffer) loop() {
 	for <-b.set {
-	Tiny:
-		for ; b.head < atomic.LoadUint64(&b.tail); b.head++ {
-			var ok bool
-			big := b.head / bufRow
-			row := b.hRow
-			if row.id != big {
-				b.m.Lock()
-				row, ok = b.rows[big]
-				delete(b.rows, big-1)
-				b.m.Unlock()
-				if !ok {
-					break
-				}
-				b.hRow = row
+		for middle := b.next(); middle != nil; middle = b.next() {
+			req := middle.Request
+			if atomic.SwapUint32(&middle.state, bsFree) == bsSet {
+				b.dequeued(middle.size)
 			}
-			middle := &row.row[b.head%bufRow]
-			switch middle.state {
-			case bsNew:
-				break Tiny
-			case bsSet:
-				req := middle.Request
-				middle.state = bsFree
-				if req != nil && req.IsPending() {
-					b.ch <- req
-				}
-			case bsFree:
+			if req != nil && req.IsPending() {
+				b.ch <- req
 			}
 		}
 	}
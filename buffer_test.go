@@ -0,0 +1,231 @@
+package iproto_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+)
+
+// gatePoint receives requests only after open, and answers them with RcOK
+type gatePoint struct {
+	iproto.SimplePoint
+	gate chan struct{}
+}
+
+func newGatePoint(configure func(p *iproto.SimplePoint)) *gatePoint {
+	p := &gatePoint{gate: make(chan struct{})}
+	p.Init(p)
+	configure(&p.SimplePoint)
+	iproto.Run(p)
+	return p
+}
+
+func (p *gatePoint) open() {
+	close(p.gate)
+}
+
+func (p *gatePoint) Loop() {
+	select {
+	case <-p.gate:
+	case <-p.ExitChan():
+		return
+	}
+	for {
+		select {
+		case r := <-p.ReceiveChan():
+			if r.SetInFly(nil) {
+				r.RespondBytes(iproto.RcOK, nil)
+			}
+		case <-p.ExitChan():
+			return
+		}
+	}
+}
+
+// send sends request with body of size, and waits until buffer takes it
+func (p *gatePoint) send(t *testing.T, size int, queued int) iproto.Chan {
+	t.Helper()
+	_, res := iproto.SendMsgBody(p, msgGet, make(iproto.Body, size))
+	waitQueue(t, p, queued)
+	return res
+}
+
+func waitQueue(t *testing.T, p *gatePoint, n int) {
+	t.Helper()
+	for start := time.Now(); p.QueueLen() != n; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Queue has %d requests, expect %d", p.QueueLen(), n)
+		}
+	}
+}
+
+func expectCode(t *testing.T, res iproto.Chan, code iproto.RetCode) {
+	t.Helper()
+	select {
+	case r := <-res:
+		if r.Code != code {
+			t.Errorf("Request answered with %x, expect %x", r.Code, code)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Request is not answered, expect %x", code)
+	}
+}
+
+func TestOverflowReject(t *testing.T) {
+	p := newGatePoint(func(s *iproto.SimplePoint) {
+		s.MaxQueue = 2
+		s.OverflowCode = 0x101
+	})
+	defer p.Stop()
+
+	// first request is taken from queue by buffer's loop, and waits for end point
+	r1 := p.send(t, 1, 0)
+	r2 := p.send(t, 1, 1)
+	r3 := p.send(t, 1, 2)
+	r4 := p.send(t, 1, 2)
+	expectCode(t, r4, 0x101)
+
+	p.open()
+	for _, res := range []iproto.Chan{r1, r2, r3} {
+		expectCode(t, res, iproto.RcOK)
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	p := newGatePoint(func(s *iproto.SimplePoint) {
+		s.MaxQueue = 2
+		s.Overflow = iproto.OverflowDropOldest
+	})
+	defer p.Stop()
+
+	r1 := p.send(t, 1, 0)
+	r2 := p.send(t, 1, 1)
+	r3 := p.send(t, 1, 2)
+	r4 := p.send(t, 1, 2)
+	expectCode(t, r2, iproto.RcTimeout)
+
+	p.open()
+	for _, res := range []iproto.Chan{r1, r3, r4} {
+		expectCode(t, res, iproto.RcOK)
+	}
+}
+
+func TestOverflowDropOldestBytes(t *testing.T) {
+	p := newGatePoint(func(s *iproto.SimplePoint) {
+		s.MaxQueueBytes = 10
+		s.Overflow = iproto.OverflowDropOldest
+	})
+	defer p.Stop()
+
+	r1 := p.send(t, 1, 0)
+	r2 := p.send(t, 4, 1)
+	r3 := p.send(t, 4, 2)
+	// one dropped request is not enough room for large one
+	r4 := p.send(t, 9, 1)
+	expectCode(t, r2, iproto.RcTimeout)
+	expectCode(t, r3, iproto.RcTimeout)
+	if b := p.QueueBytes(); b > 10 {
+		t.Errorf("Queue has %d bytes over budget", b)
+	}
+
+	p.open()
+	expectCode(t, r1, iproto.RcOK)
+	expectCode(t, r4, iproto.RcOK)
+}
+
+func TestOverflowBlock(t *testing.T) {
+	p := newGatePoint(func(s *iproto.SimplePoint) {
+		s.MaxQueue = 1
+		s.Overflow = iproto.OverflowBlock
+	})
+	defer p.Stop()
+
+	r1 := p.send(t, 1, 0)
+	r2 := p.send(t, 1, 1)
+
+	sent := make(chan iproto.Chan, 1)
+	go func() {
+		_, res := iproto.SendMsgBody(p, msgGet, nil)
+		sent <- res
+	}()
+	select {
+	case <-sent:
+		t.Fatalf("Send to full queue should block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.open()
+	var r3 iproto.Chan
+	select {
+	case r3 = <-sent:
+	case <-time.After(time.Second):
+		t.Fatalf("Send is not unblocked")
+	}
+	for _, res := range []iproto.Chan{r1, r2, r3} {
+		expectCode(t, res, iproto.RcOK)
+	}
+}
+
+func TestOverflowBlockAnswered(t *testing.T) {
+	p := newGatePoint(func(s *iproto.SimplePoint) {
+		s.MaxQueue = 1
+		s.Overflow = iproto.OverflowBlock
+	})
+	defer p.Stop()
+
+	r1 := p.send(t, 1, 0)
+	r2 := p.send(t, 1, 1)
+
+	for _, answer := range []func(r *iproto.Request){nil, (*iproto.Request).Cancel} {
+		res := make(iproto.Chan, 1)
+		r := &iproto.Request{Msg: msgGet, Responder: res}
+		code := iproto.RcCanceled
+		if answer == nil {
+			r.SetTimeout(50 * time.Millisecond)
+			code = iproto.RcTimeout
+		} else {
+			time.AfterFunc(50*time.Millisecond, func() { answer(r) })
+		}
+		done := make(chan struct{})
+		go func() {
+			p.Send(r)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Send blocked by full queue is not woken by answer %x", code)
+		}
+		expectCode(t, res, code)
+		waitQueue(t, p, 1)
+	}
+
+	p.open()
+	expectCode(t, r1, iproto.RcOK)
+	expectCode(t, r2, iproto.RcOK)
+}
+
+func TestOverflowBlockStopped(t *testing.T) {
+	p := newGatePoint(func(s *iproto.SimplePoint) {
+		s.MaxQueue = 1
+		s.Overflow = iproto.OverflowBlock
+	})
+
+	p.send(t, 1, 0)
+	p.send(t, 1, 1)
+
+	sent := make(chan iproto.Chan, 1)
+	go func() {
+		_, res := iproto.SendMsgBody(p, msgGet, nil)
+		sent <- res
+	}()
+	time.Sleep(50 * time.Millisecond)
+	p.Stop()
+	select {
+	case res := <-sent:
+		expectCode(t, res, iproto.RcShutdown)
+	case <-time.After(time.Second):
+		t.Fatalf("Send blocked by full queue is not woken by Stop")
+	}
+}
@@ -0,0 +1,279 @@
+package iproto
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type BreakerState uint32
+
+const (
+	BreakerClosed = BreakerState(iota)
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+const (
+	DefaultBreakerWindow       = 10 * time.Second
+	DefaultBreakerBuckets      = 10
+	DefaultBreakerMinRequests  = 20
+	DefaultBreakerRatio        = 0.5
+	DefaultBreakerOpenTimeout  = 5 * time.Second
+	DefaultBreakerHalfOpenReqs = 1
+)
+
+type breakerBucket struct {
+	n      int64
+	total  int
+	failed int
+}
+
+// CircuitBreaker tracks ratio of failed requests to wrapped Service over sliding Window.
+// When ratio exceeds FailureRatio, breaker opens and answers RcCircuitOpen without sending requests.
+// After OpenTimeout it is half-open: HalfOpenRequests probes are sent, and breaker closes
+// if all of them succeed, or opens again on a first failure.
+// Breaker with config rejected by Validate answers RcInternalError without sending requests.
+type CircuitBreaker struct {
+	Service
+
+	Window           time.Duration
+	Buckets          int
+	MinRequests      int
+	FailureRatio     float64
+	OpenTimeout      time.Duration
+	HalfOpenRequests int
+	// IsFailure tells which codes are counted as failures. By default RcTimeout and RcIOError are.
+	IsFailure func(RetCode) bool
+	// OnStateChange is called on every state change.
+	// It is called without lock held, so it could call State and Counts.
+	OnStateChange func(from, to BreakerState)
+
+	m        sync.Mutex
+	state    BreakerState
+	openedAt Epoch
+	probes   int
+	probesOk int
+	buckets  []breakerBucket
+}
+
+type breakerChange struct {
+	from, to BreakerState
+}
+
+func BreakerWrap(s Service) *CircuitBreaker {
+	return &CircuitBreaker{Service: s}
+}
+
+// Validate checks that sliding window could be split into Buckets
+func (cb *CircuitBreaker) Validate() error {
+	if cb.Window < 0 || cb.Buckets < 0 || cb.MinRequests < 0 || cb.HalfOpenRequests < 0 {
+		return fmt.Errorf("iproto breaker: negative Window, Buckets, MinRequests or HalfOpenRequests")
+	}
+	window, buckets := cb.Window, cb.Buckets
+	if window == 0 {
+		window = DefaultBreakerWindow
+	}
+	if buckets == 0 {
+		buckets = DefaultBreakerBuckets
+	}
+	if window < time.Duration(buckets) {
+		return fmt.Errorf("iproto breaker: Window %v is less than %d Buckets", window, buckets)
+	}
+	return nil
+}
+
+func (cb *CircuitBreaker) init() error {
+	if err := cb.Validate(); err != nil {
+		return err
+	}
+	if cb.Window <= 0 {
+		cb.Window = DefaultBreakerWindow
+	}
+	if cb.Buckets <= 0 {
+		cb.Buckets = DefaultBreakerBuckets
+	}
+	if cb.MinRequests <= 0 {
+		cb.MinRequests = DefaultBreakerMinRequests
+	}
+	if cb.FailureRatio <= 0 {
+		cb.FailureRatio = DefaultBreakerRatio
+	}
+	if cb.OpenTimeout <= 0 {
+		cb.OpenTimeout = DefaultBreakerOpenTimeout
+	}
+	if cb.HalfOpenRequests <= 0 {
+		cb.HalfOpenRequests = DefaultBreakerHalfOpenReqs
+	}
+	if cb.IsFailure == nil {
+		cb.IsFailure = isBreakerFailure
+	}
+	cb.buckets = make([]breakerBucket, cb.Buckets)
+	return nil
+}
+
+func isBreakerFailure(code RetCode) bool {
+	return code == RcTimeout || code == RcIOError
+}
+
+func (cb *CircuitBreaker) State() (state BreakerState) {
+	cb.m.Lock()
+	state = cb.state
+	cb.m.Unlock()
+	return
+}
+
+// Counts returns number of all and failed requests in a current window
+func (cb *CircuitBreaker) Counts() (total, failed int) {
+	cb.m.Lock()
+	if cb.buckets != nil {
+		total, failed = cb.counts(cb.bucketN(NowEpoch()))
+	}
+	cb.m.Unlock()
+	return
+}
+
+func (cb *CircuitBreaker) bucketN(now Epoch) int64 {
+	return int64(now) / int64(cb.Window/time.Duration(cb.Buckets))
+}
+
+func (cb *CircuitBreaker) counts(n int64) (total, failed int) {
+	for i := range cb.buckets {
+		if b := &cb.buckets[i]; n-b.n < int64(len(cb.buckets)) {
+			total += b.total
+			failed += b.failed
+		}
+	}
+	return
+}
+
+func (cb *CircuitBreaker) setState(state BreakerState) breakerChange {
+	old := cb.state
+	cb.state = state
+	switch state {
+	case BreakerOpen:
+		cb.openedAt = NowEpoch()
+	case BreakerHalfOpen:
+		cb.probes, cb.probesOk = 0, 0
+	case BreakerClosed:
+		for i := range cb.buckets {
+			cb.buckets[i] = breakerBucket{}
+		}
+	}
+	return breakerChange{from: old, to: state}
+}
+
+func (cb *CircuitBreaker) notify(change breakerChange) {
+	if cb.OnStateChange != nil && change.from != change.to {
+		cb.OnStateChange(change.from, change.to)
+	}
+}
+
+func (cb *CircuitBreaker) allow() (code RetCode, probe bool) {
+	var change breakerChange
+	cb.m.Lock()
+	code, probe, change = cb.admit()
+	cb.m.Unlock()
+	cb.notify(change)
+	return
+}
+
+func (cb *CircuitBreaker) admit() (code RetCode, probe bool, change breakerChange) {
+	if cb.buckets == nil && cb.init() != nil {
+		return RcInternalError, false, change
+	}
+	switch cb.state {
+	case BreakerClosed:
+		return RcOK, false, change
+	case BreakerOpen:
+		if cb.openedAt.Elapsed() < cb.OpenTimeout {
+			return RcCircuitOpen, false, change
+		}
+		change = cb.setState(BreakerHalfOpen)
+	}
+	if cb.probes < cb.HalfOpenRequests {
+		cb.probes++
+		return RcOK, true, change
+	}
+	return RcCircuitOpen, false, change
+}
+
+func (cb *CircuitBreaker) record(code RetCode, probe bool) {
+	cb.m.Lock()
+	change := cb.update(code, probe)
+	cb.m.Unlock()
+	cb.notify(change)
+}
+
+func (cb *CircuitBreaker) update(code RetCode, probe bool) (change breakerChange) {
+	if code == RcCanceled {
+		if probe && cb.state == BreakerHalfOpen {
+			cb.probes--
+		}
+		return
+	}
+	failed := cb.IsFailure(code)
+	if probe {
+		if cb.state != BreakerHalfOpen {
+			return
+		}
+		if failed {
+			change = cb.setState(BreakerOpen)
+		} else if cb.probesOk++; cb.probesOk >= cb.HalfOpenRequests {
+			change = cb.setState(BreakerClosed)
+		}
+		return
+	}
+	if cb.state != BreakerClosed {
+		return
+	}
+	n := cb.bucketN(NowEpoch())
+	b := &cb.buckets[n%int64(len(cb.buckets))]
+	if b.n != n {
+		*b = breakerBucket{n: n}
+	}
+	b.total++
+	if failed {
+		b.failed++
+		total, failed := cb.counts(n)
+		if total >= cb.MinRequests && float64(failed) >= cb.FailureRatio*float64(total) {
+			change = cb.setState(BreakerOpen)
+		}
+	}
+	return
+}
+
+func (cb *CircuitBreaker) Send(r *Request) {
+	code, probe := cb.allow()
+	if code != RcOK {
+		r.RespondFail(code)
+		return
+	}
+	if r.ChainBookmark(&breakerBookmark{cb: cb, probe: probe}) {
+		cb.Service.Send(r)
+	} else if probe {
+		cb.record(RcCanceled, probe)
+	}
+}
+
+type breakerBookmark struct {
+	Bookmark
+	cb    *CircuitBreaker
+	probe bool
+}
+
+func (bm *breakerBookmark) Respond(res *Response) {
+	bm.cb.record(res.Code, bm.probe)
+}
@@ -0,0 +1,215 @@
+package iproto_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+)
+
+const msgBreaker = iproto.RequestType(23)
+
+// codeService answers requests with code, or keeps them after hold
+type codeService struct {
+	code uint32
+	sent int32
+	m    sync.Mutex
+	held []*iproto.Request
+	iproto.SF
+}
+
+func newCodeService() *codeService {
+	s := &codeService{}
+	s.SF = func(r *iproto.Request) {
+		atomic.AddInt32(&s.sent, 1)
+		/* code is stored incremented, so zero means hold */
+		if code := atomic.LoadUint32(&s.code); code != 0 {
+			r.RespondBytes(iproto.RetCode(code-1), nil)
+		} else {
+			s.m.Lock()
+			s.held = append(s.held, r)
+			s.m.Unlock()
+		}
+	}
+	return s
+}
+
+func (s *codeService) answer(code iproto.RetCode) {
+	atomic.StoreUint32(&s.code, uint32(code)+1)
+}
+
+func (s *codeService) hold() {
+	atomic.StoreUint32(&s.code, 0)
+}
+
+func (s *codeService) release(code iproto.RetCode) {
+	s.m.Lock()
+	held := s.held
+	s.held = nil
+	s.m.Unlock()
+	for _, r := range held {
+		r.RespondBytes(code, nil)
+	}
+}
+
+func breaker(s *codeService) *iproto.CircuitBreaker {
+	return &iproto.CircuitBreaker{
+		Service:          s,
+		Window:           time.Second,
+		Buckets:          10,
+		MinRequests:      4,
+		FailureRatio:     0.5,
+		OpenTimeout:      50 * time.Millisecond,
+		HalfOpenRequests: 2,
+	}
+}
+
+func callCodes(cb *iproto.CircuitBreaker, n int) (codes []iproto.RetCode) {
+	for i := 0; i < n; i++ {
+		codes = append(codes, iproto.CallMsgBody(cb, msgBreaker, nil).Code)
+	}
+	return
+}
+
+func TestBreakerOpens(t *testing.T) {
+	s := newCodeService()
+	cb := breaker(s)
+
+	s.answer(iproto.RcOK)
+	callCodes(cb, 2)
+	s.answer(iproto.RcIOError)
+	callCodes(cb, 1)
+	if cb.State() != iproto.BreakerClosed {
+		t.Fatalf("Breaker opened before MinRequests")
+	}
+	if total, failed := cb.Counts(); total != 3 || failed != 1 {
+		t.Errorf("Counts %d %d, expect 3 1", total, failed)
+	}
+	callCodes(cb, 1)
+	if cb.State() != iproto.BreakerOpen {
+		t.Fatalf("Breaker is not opened by failure ratio")
+	}
+
+	s.answer(iproto.RcOK)
+	if codes := callCodes(cb, 3); codes[0] != iproto.RcCircuitOpen || codes[2] != iproto.RcCircuitOpen {
+		t.Errorf("Open breaker should answer RcCircuitOpen, got %x", codes)
+	}
+	if n := atomic.LoadInt32(&s.sent); n != 4 {
+		t.Errorf("Open breaker should not send requests, %d sent", n)
+	}
+}
+
+func TestBreakerUserErrors(t *testing.T) {
+	s := newCodeService()
+	cb := breaker(s)
+
+	s.answer(0x102)
+	callCodes(cb, 10)
+	if cb.State() != iproto.BreakerClosed {
+		t.Errorf("User level codes should not open breaker")
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	s := newCodeService()
+	cb := breaker(s)
+
+	s.answer(iproto.RcTimeout)
+	callCodes(cb, 4)
+	if cb.State() != iproto.BreakerOpen {
+		t.Fatalf("Breaker is not opened")
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	// probes are held, so no more than HalfOpenRequests are sent
+	s.hold()
+	var cx iproto.Context
+	_, res1 := cx.SendMsgBody(cb, msgBreaker, nil)
+	_, res2 := cx.SendMsgBody(cb, msgBreaker, nil)
+	if cb.State() != iproto.BreakerHalfOpen {
+		t.Fatalf("Breaker is not half-open after OpenTimeout")
+	}
+	if code := iproto.CallMsgBody(cb, msgBreaker, nil).Code; code != iproto.RcCircuitOpen {
+		t.Errorf("Request over HalfOpenRequests should be rejected, got %x", code)
+	}
+	s.release(iproto.RcOK)
+	<-res1
+	<-res2
+	if cb.State() != iproto.BreakerClosed {
+		t.Fatalf("Breaker is not closed after successful probes")
+	}
+	if total, failed := cb.Counts(); total != 0 || failed != 0 {
+		t.Errorf("Closed breaker should forget old counts, got %d %d", total, failed)
+	}
+
+	s.answer(iproto.RcIOError)
+	callCodes(cb, 4)
+	time.Sleep(60 * time.Millisecond)
+	callCodes(cb, 1)
+	if cb.State() != iproto.BreakerOpen {
+		t.Errorf("Failed probe should open breaker again, state %v", cb.State())
+	}
+}
+
+func TestBreakerOnStateChange(t *testing.T) {
+	s := newCodeService()
+	cb := breaker(s)
+	cb.HalfOpenRequests = 1
+	var changes []string
+	cb.OnStateChange = func(from, to iproto.BreakerState) {
+		// callback could inspect breaker
+		if cb.State() != to {
+			t.Errorf("State %v in callback, expect %v", cb.State(), to)
+		}
+		cb.Counts()
+		changes = append(changes, from.String()+">"+to.String())
+	}
+
+	s.answer(iproto.RcIOError)
+	callCodes(cb, 4)
+	time.Sleep(60 * time.Millisecond)
+	s.answer(iproto.RcOK)
+	callCodes(cb, 1)
+
+	expect := []string{"closed>open", "open>half-open", "half-open>closed"}
+	if len(changes) != len(expect) {
+		t.Fatalf("Changes %v, expect %v", changes, expect)
+	}
+	for i := range expect {
+		if changes[i] != expect[i] {
+			t.Errorf("Changes %v, expect %v", changes, expect)
+		}
+	}
+}
+
+func TestBreakerValidate(t *testing.T) {
+	cb := &iproto.CircuitBreaker{Window: 5 * time.Nanosecond, Buckets: 10}
+	if cb.Validate() == nil {
+		t.Errorf("Window shorter than Buckets should be rejected")
+	}
+	cb = &iproto.CircuitBreaker{Buckets: -1}
+	if cb.Validate() == nil {
+		t.Errorf("Negative Buckets should be rejected")
+	}
+	cb = &iproto.CircuitBreaker{Window: time.Second, Buckets: 10}
+	if err := cb.Validate(); err != nil {
+		t.Errorf("Valid config is rejected: %v", err)
+	}
+}
+
+func TestBreakerInvalid(t *testing.T) {
+	s := newCodeService()
+	s.answer(iproto.RcOK)
+	cb := breaker(s)
+	cb.Window = 5 * time.Nanosecond
+	for _, code := range callCodes(cb, 2) {
+		if code != iproto.RcInternalError {
+			t.Errorf("Breaker with invalid config should answer RcInternalError, got %x", code)
+		}
+	}
+	if n := atomic.LoadInt32(&s.sent); n != 0 {
+		t.Errorf("Breaker with invalid config sent %d requests", n)
+	}
+}
@@ -1,6 +1,7 @@
 package iproto
 
 import (
+	"context"
 	"log"
 	"runtime"
 	"sync"
@@ -56,6 +57,12 @@ type Context struct {
 	owngen    bool
 	gen       *RGenerator
 	cancelBuf []contextBookmark
+	std       context.Context
+	stdDone   chan struct{}
+	stdClosed bool
+	stdStop   chan struct{}
+	// Priority is set to requests of context, children inherit it
+	Priority Priority
 }
 
 func (c *Context) RemoveCanceler(cn Canceler) {
@@ -105,8 +112,12 @@ func (c *Context) AddCanceler(cn Canceler) {
 }
 
 func (c *Context) cancelAll() {
-	for len(c.cancelsm) > 0 || c.cancelsn > 0 {
+	for {
 		c.m.Lock()
+		if len(c.cancelsm) == 0 && c.cancelsn == 0 {
+			c.m.Unlock()
+			return
+		}
 		cancels := make([]Canceler, 0, len(c.cancels)+c.cancelsn)
 		for i := 0; i < len(c.cancels); i++ {
 			if c.cancels[i] != nil {
@@ -126,12 +137,14 @@ func (c *Context) cancelAll() {
 
 func (c *Context) Cancel() {
 	if atomic.CompareAndSwapUint32((*uint32)(&c.State), 0, uint32(CxCanceled)) {
+		c.closeStd()
 		c.cancelAll()
 	}
 }
 
 func (c *Context) Expire() {
 	if atomic.CompareAndSwapUint32((*uint32)(&c.State), 0, uint32(CxTimeout)) {
+		c.closeStd()
 		c.cancelAll()
 	}
 }
@@ -143,6 +156,7 @@ func (c *Context) NewRequest(msg RequestType, body interface{}) (r *Request, res
 		c.owngen = true
 	}
 	r = c.gen.Request(c.reqId, msg, body)
+	r.Priority = c.Priority
 	ch := make(Chan, 1)
 	res, r.Responder = ch, ch
 
@@ -202,6 +216,14 @@ func (c *Context) Call(serv Service, r RequestData) *Response {
 	return <-res
 }
 
+// CallBatch sends requests within context and waits for all responses, ordered as requests
+func (c *Context) CallBatch(serv Service, reqs []RequestData) MultiResponse {
+	multi := c.NewMulti()
+	multi.TimeoutFrom(serv)
+	multi.SendBatch(serv, reqs)
+	return multi.Results().Sort()
+}
+
 func (c *Context) Alive() bool {
 	return c.State == 0
 }
@@ -211,7 +233,7 @@ func (c *Context) Timeout() bool {
 }
 
 func (c *Context) Child() (child *Context, ok bool) {
-	child = &Context{parent: c}
+	child = &Context{parent: c, Priority: c.Priority, std: c.std}
 	rc := CxState(atomic.LoadUint32((*uint32)(&c.State)))
 	if rc == 0 {
 		c.AddCanceler(child)
@@ -280,4 +302,8 @@ func (c *Context) Done() {
 		c.owngen = false
 		c.gen.Release()
 	}
+	if c.stdStop != nil {
+		close(c.stdStop)
+		c.stdStop = nil
+	}
 }
@@ -47,6 +47,19 @@ func (t *Timer) Stop() {
 	}
 }
 
+// Deadline returns epoch when timer fires, ok is false if timer is not set
+func (t *Timer) Deadline() (e Epoch, ok bool) {
+	if h := t.h; h > 0 {
+		heap := getHeap(h)
+		heap.m.Lock()
+		if i := t.i; i > 0 {
+			e, ok = heap.h[i].e, true
+		}
+		heap.m.Unlock()
+	}
+	return
+}
+
 var heaps = []*tHeap{newHeap(1), newHeap(2)}
 var heapM sync.Mutex
 var heapI uint32
@@ -0,0 +1,125 @@
+package iproto
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error is a response with code other than RcOK returned as error.
+// It works with errors.Is: it matches *Error with same code, and kind sentinels
+// ErrKindTemporary, ErrKindFatal and ErrKindInternal match any code of that kind.
+//
+//	if errors.Is(err, iproto.ErrTimeout) { ... }
+//	if errors.Is(err, iproto.ErrKindTemporary) { retry() }
+type Error struct {
+	Code RetCode
+	Body Body
+}
+
+var (
+	ErrKindTemporary = &Error{Code: RcTemporary}
+	ErrKindFatal     = &Error{Code: RcFatal}
+	ErrKindInternal  = &Error{Code: RcInternal}
+)
+
+var (
+	ErrTimeout       = &Error{Code: RcTimeout}
+	ErrIOError       = &Error{Code: RcIOError}
+	ErrCanceled      = &Error{Code: RcCanceled}
+	ErrShutdown      = ErrCanceled
+	ErrProtocolError = &Error{Code: RcProtocolError}
+	ErrInternalError = &Error{Code: RcInternalError}
+	ErrCircuitOpen   = &Error{Code: RcCircuitOpen}
+	ErrOverload      = &Error{Code: RcOverload}
+)
+
+// RetCodeNames are used in error messages, packages could add their codes
+var RetCodeNames = map[RetCode]string{
+	RcTimeout:       "timeout",
+	RcIOError:       "io error",
+	RcCanceled:      "canceled",
+	RcProtocolError: "protocol error",
+	RcInternalError: "internal error",
+	RcCircuitOpen:   "circuit open",
+	RcOverload:      "overload",
+}
+
+// Kind returns kind bits of code: RcOK, RcTemporary, RcFatal or RcInternal
+func (c RetCode) Kind() RetCode {
+	return c & RcKindMask
+}
+
+// Err returns nil for RcOK and *Error otherwise
+func (c RetCode) Err() error {
+	if c == RcOK {
+		return nil
+	}
+	return &Error{Code: c}
+}
+
+func (e *Error) Error() string {
+	name := RetCodeNames[e.Code]
+	if name == "" {
+		name = "error code"
+	}
+	if len(e.Body) > 0 {
+		return fmt.Sprintf("iproto: %s %#x, body %q", name, uint32(e.Code), []byte(e.Body))
+	}
+	return fmt.Sprintf("iproto: %s %#x", name, uint32(e.Code))
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	if t.Code&^RcKindMask == 0 {
+		return e.Code.Kind() == t.Code
+	}
+	return e.Code == t.Code
+}
+
+func (e *Error) Temporary() bool {
+	return e.Code.Kind() == RcTemporary
+}
+
+func (e *Error) Fatal() bool {
+	return e.Code.Kind() == RcFatal
+}
+
+func (e *Error) Internal() bool {
+	return e.Code.Kind() == RcInternal
+}
+
+// Code returns RetCode of err, if it wraps *Error, and RcInternalError otherwise.
+// It returns RcOK for nil.
+func Code(err error) RetCode {
+	if err == nil {
+		return RcOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return RcInternalError
+}
+
+func IsTemporary(err error) bool {
+	return errors.Is(err, ErrKindTemporary)
+}
+
+func IsFatal(err error) bool {
+	return errors.Is(err, ErrKindFatal)
+}
+
+func IsInternal(err error) bool {
+	return errors.Is(err, ErrKindInternal)
+}
+
+// Err returns *Error if response is not successful, and nil otherwise
+func (res *Response) Err() error {
+	if res.Code == RcOK {
+		return nil
+	}
+	return &Error{Code: res.Code, Body: res.Body}
+}
@@ -0,0 +1,53 @@
+package iproto_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/funny-falcon/go-iproto"
+)
+
+func TestErrorIs(t *testing.T) {
+	err := iproto.RcTimeout.Err()
+	if !errors.Is(err, iproto.ErrTimeout) || errors.Is(err, iproto.ErrIOError) {
+		t.Errorf("Error should match sentinel of its code only")
+	}
+	if !errors.Is(err, iproto.ErrKindInternal) || errors.Is(err, iproto.ErrKindTemporary) || errors.Is(err, iproto.ErrKindFatal) {
+		t.Errorf("Error should match sentinel of its kind only")
+	}
+	if !errors.Is(iproto.RcShutdown.Err(), iproto.ErrShutdown) || !errors.Is(iproto.RcOverload.Err(), iproto.ErrOverload) {
+		t.Errorf("Shutdown and overload should match their sentinels")
+	}
+
+	wrapped := fmt.Errorf("get user: %w", &iproto.Error{Code: 0x101, Body: []byte("busy")})
+	if !errors.Is(wrapped, &iproto.Error{Code: 0x101}) || errors.Is(wrapped, &iproto.Error{Code: 0x201}) {
+		t.Errorf("Wrapped error should match *Error with same code")
+	}
+	if !iproto.IsTemporary(wrapped) || iproto.IsFatal(wrapped) || iproto.IsInternal(wrapped) {
+		t.Errorf("Wrapped 0x101 should be temporary only")
+	}
+	if !iproto.IsFatal(iproto.RetCode(0x102).Err()) || !iproto.IsInternal(iproto.RcIOError.Err()) {
+		t.Errorf("Kinds are not recognized")
+	}
+	if errors.Is(errors.New("other"), iproto.ErrKindInternal) || iproto.IsTemporary(nil) {
+		t.Errorf("Foreign errors should not match")
+	}
+
+	if c := iproto.Code(wrapped); c != 0x101 {
+		t.Errorf("Code of wrapped error %x, expect 0x101", c)
+	}
+	if c := iproto.Code(errors.New("other")); c != iproto.RcInternalError {
+		t.Errorf("Code of foreign error %x, expect RcInternalError", c)
+	}
+	if c := iproto.Code(nil); c != iproto.RcOK {
+		t.Errorf("Code of nil %x, expect RcOK", c)
+	}
+	if iproto.RcOK.Err() != nil || (&iproto.Response{}).Err() != nil {
+		t.Errorf("RcOK should not be an error")
+	}
+	if !strings.Contains(wrapped.Error(), `"busy"`) || !strings.Contains(iproto.ErrTimeout.Error(), "timeout") {
+		t.Errorf("Error messages should have body and name of code: %v, %v", wrapped, iproto.ErrTimeout)
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/funny-falcon/go-iproto
 
-go 1.16
+go 1.18
@@ -0,0 +1,88 @@
+package iproto
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger is a leveled structured logger, *slog.Logger satisfies it.
+// args are alternating keys and values, as in log/slog.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// LogLevel has same values as slog.Level
+type LogLevel int
+
+const (
+	LevelDebug = LogLevel(-4)
+	LevelInfo  = LogLevel(0)
+	LevelWarn  = LogLevel(4)
+	LevelError = LogLevel(8)
+)
+
+func (l LogLevel) String() string {
+	switch {
+	case l < LevelInfo:
+		return "DEBUG"
+	case l < LevelWarn:
+		return "INFO"
+	case l < LevelError:
+		return "WARN"
+	}
+	return "ERROR"
+}
+
+// StdLogger writes to log.Logger lines like "INFO Accepted conn=1 remote=127.0.0.1:4567"
+type StdLogger struct {
+	// Logger is used for output, standard logger if nil
+	Logger *log.Logger
+	// Level is a minimal level to write
+	Level LogLevel
+}
+
+// DefaultLogger is used when Logger is not configured
+var DefaultLogger Logger = StdLogger{}
+
+func (l StdLogger) Debug(msg string, args ...any) { l.log(LevelDebug, msg, args) }
+func (l StdLogger) Info(msg string, args ...any)  { l.log(LevelInfo, msg, args) }
+func (l StdLogger) Warn(msg string, args ...any)  { l.log(LevelWarn, msg, args) }
+func (l StdLogger) Error(msg string, args ...any) { l.log(LevelError, msg, args) }
+
+func (l StdLogger) log(level LogLevel, msg string, args []any) {
+	if level < l.Level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			fmt.Fprintf(&b, " !BADKEY=%v", args[i])
+			break
+		}
+		val := fmt.Sprint(args[i+1])
+		if strings.ContainsAny(val, " =\"\n") {
+			val = fmt.Sprintf("%q", val)
+		}
+		fmt.Fprintf(&b, " %v=%s", args[i], val)
+	}
+	if l.Logger != nil {
+		l.Logger.Output(3, b.String())
+	} else {
+		log.Output(3, b.String())
+	}
+}
+
+// NopLogger discards everything
+type NopLogger struct{}
+
+func (NopLogger) Debug(msg string, args ...any) {}
+func (NopLogger) Info(msg string, args ...any)  {}
+func (NopLogger) Warn(msg string, args ...any)  {}
+func (NopLogger) Error(msg string, args ...any) {}
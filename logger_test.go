@@ -0,0 +1,71 @@
+package iproto_test
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/funny-falcon/go-iproto"
+)
+
+func stdLogger(level iproto.LogLevel) (iproto.StdLogger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return iproto.StdLogger{Logger: log.New(&buf, "", 0), Level: level}, &buf
+}
+
+func TestStdLoggerLevel(t *testing.T) {
+	l, buf := stdLogger(iproto.LevelWarn)
+	l.Debug("debug")
+	l.Info("info")
+	l.Warn("warn")
+	l.Error("error")
+	if got, expect := buf.String(), "WARN warn\nERROR error\n"; got != expect {
+		t.Errorf("Got %q, expect %q", got, expect)
+	}
+
+	l, buf = stdLogger(iproto.LevelDebug)
+	l.Debug("debug")
+	if got, expect := buf.String(), "DEBUG debug\n"; got != expect {
+		t.Errorf("Debug level should write debug messages, got %q", got)
+	}
+}
+
+func TestStdLoggerFormat(t *testing.T) {
+	l, buf := stdLogger(iproto.LevelInfo)
+	l.Info("Accepted", "conn", 1, "remote", "127.0.0.1:4567")
+	l.Warn("Failed", "err", "connection refused", "query", `a="b"`, "odd")
+	expect := []string{
+		`INFO Accepted conn=1 remote=127.0.0.1:4567`,
+		`WARN Failed err="connection refused" query="a=\"b\"" !BADKEY=odd`,
+		``,
+	}
+	if got := buf.String(); got != strings.Join(expect, "\n") {
+		t.Errorf("Got %q, expect %q", got, expect)
+	}
+}
+
+func TestNopLogger(t *testing.T) {
+	var buf bytes.Buffer
+	flags, out := log.Flags(), log.Writer()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	}()
+
+	var l iproto.Logger = iproto.NopLogger{}
+	l.Debug("debug", "k", 1)
+	l.Info("info")
+	l.Warn("warn")
+	l.Error("error", "err", "boom")
+	if buf.Len() != 0 {
+		t.Errorf("NopLogger wrote %q", buf.String())
+	}
+
+	iproto.StdLogger{}.Info("std", "k", "v")
+	if got := buf.String(); got != "INFO std k=v\n" {
+		t.Errorf("StdLogger without Logger should write to standard logger, got %q", got)
+	}
+}
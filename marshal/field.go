@@ -0,0 +1,117 @@
+package marshal
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Field helpers encode and decode single struct field with reflection, exactly as
+// TWriter and TReader of enclosing struct do it. They are used by code generated
+// with iprotogen for field types it could not encode statically.
+// p should be pointer to a field.
+
+func fieldValue(p interface{}) reflect.Value {
+	return reflect.ValueOf(p).Elem()
+}
+
+// FieldSize returns encoded size of field without size or count prefix,
+// or -1 if it could not be known without encoding.
+func FieldSize(p interface{}) int {
+	v := fieldValue(p)
+	return WriterFor(v.Type()).Size(v)
+}
+
+func (w *Writer) FieldAuto(p interface{}) {
+	v := fieldValue(p)
+	WriterFor(v.Type()).WriteAuto(w, v)
+}
+
+func (w *Writer) FieldRaw(p interface{}) {
+	v := fieldValue(p)
+	WriterFor(v.Type()).Write(w, v)
+}
+
+func (w *Writer) FieldWithSize(p interface{}, szwr func(*Writer, int)) {
+	v := fieldValue(p)
+	WriterFor(v.Type()).WithSize(w, v, szwr)
+}
+
+func (w *Writer) FieldWithCount(p interface{}, cntwr func(*Writer, int)) {
+	v := fieldValue(p)
+	WriterFor(v.Type()).WithCount(w, v, cntwr)
+}
+
+func (r *Reader) FieldAuto(p interface{}) {
+	if r.Err == nil {
+		v := fieldValue(p)
+		ReaderFor(v.Type()).Auto(r, v)
+	}
+}
+
+func (r *Reader) FieldFixed(p interface{}) {
+	if r.Err == nil {
+		v := fieldValue(p)
+		ReaderFor(v.Type()).Fixed(r, v)
+	}
+}
+
+func (r *Reader) FieldTail(p interface{}) {
+	if r.Err == nil {
+		v := fieldValue(p)
+		ReaderFor(v.Type()).Tail(r, v)
+	}
+}
+
+func (r *Reader) FieldWithSize(p interface{}, szrd func(*Reader) int) {
+	v := fieldValue(p)
+	ReaderFor(v.Type()).WithSize(r, v, szrd)
+}
+
+func (r *Reader) FieldWithCount(p interface{}, cntrd func(*Reader) int) {
+	v := fieldValue(p)
+	ReaderFor(v.Type()).WithCount(r, v, cntrd)
+}
+
+// Expect checks that read size or count equals to needed one, and sets r.Err otherwise.
+func (r *Reader) Expect(what string, got, need int) bool {
+	if r.Err != nil {
+		return false
+	}
+	if got != need {
+		r.Err = fmt.Errorf("%s doesn't match: got %d, need %d", what, got, need)
+		return false
+	}
+	return true
+}
+
+// Sub cuts next sz bytes into separate reader. It should be passed to Join after reading.
+func (r *Reader) Sub(sz int) Reader {
+	return Reader{Body: r.Slice(sz), Err: r.Err}
+}
+
+// Join takes error of sub reader, or complains if it were not read whole.
+func (r *Reader) Join(sr *Reader) {
+	if r.Err == nil {
+		r.Err = sr.Error()
+	}
+}
+
+// VarslSize returns size of s elements encoded with Uint64var
+func VarslSize[T ~uint8 | ~uint16 | ~uint32 | ~uint64](s []T) (sz int) {
+	for _, v := range s {
+		sz += Varsize64(uint64(v))
+	}
+	return
+}
+
+// ISizeSl returns sum of elements sizes, or -1 if some size is unknown
+func ISizeSl[T IShortSizer](s []T) (sz int) {
+	for _, v := range s {
+		n := v.ISize()
+		if n < 0 {
+			return -1
+		}
+		sz += n
+	}
+	return
+}
@@ -0,0 +1,976 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const marshalPath = "github.com/funny-falcon/go-iproto/marshal"
+
+type encKind int
+
+const (
+	encFallback encKind = iota
+	encNum
+	encString
+	encBytes
+	encNumSlice
+	encNumArray
+	encStruct
+	encStructSlice
+)
+
+type number struct {
+	meth string
+	arg  string
+	size int
+	uint bool
+}
+
+var numbers = map[types.BasicKind]number{
+	types.Bool:    {"Bool", "bool", 1, false},
+	types.Int8:    {"Int8", "int8", 1, false},
+	types.Int16:   {"Int16", "int16", 2, false},
+	types.Int32:   {"Int32", "int32", 4, false},
+	types.Int64:   {"Int64", "int64", 8, false},
+	types.Uint8:   {"Uint8", "uint8", 1, true},
+	types.Uint16:  {"Uint16", "uint16", 2, true},
+	types.Uint32:  {"Uint32", "uint32", 4, true},
+	types.Uint64:  {"Uint64", "uint64", 8, true},
+	types.Float32: {"Float32", "float32", 4, false},
+	types.Float64: {"Float64", "float64", 8, false},
+}
+
+var berNumber = number{"Uint64var", "uint64", -1, true}
+
+// enc describes how a value of some type is encoded.
+type enc struct {
+	kind encKind
+	typ  string // type expression
+	elem string // number or struct type expression, for slices and arrays it is element's one
+	num  number
+	bulk bool // could be written and read with slice methods, ie element is not named
+	ber  bool
+	len  int
+	st   *structType
+	// time is "Time" or "Duration" when value is converted with marshal functions in unit
+	time string
+	unit string
+}
+
+// counted reports whether plain field of this kind is prefixed with uint32 count.
+func (e *enc) counted() bool {
+	switch e.kind {
+	case encString, encBytes, encNumSlice, encStructSlice:
+		return true
+	}
+	return false
+}
+
+// fixed returns size of value, if it is constant, or -1.
+func (e *enc) fixed() int {
+	if e.ber {
+		return -1
+	}
+	switch e.kind {
+	case encNum:
+		return e.num.size
+	case encNumArray:
+		return e.len * e.num.size
+	}
+	return -1
+}
+
+type sboxTail int
+
+const (
+	noTail sboxTail = iota
+	tail
+	tailSplit
+)
+
+type field struct {
+	name   string
+	enc    *enc
+	szm    string
+	cntm   string
+	nosize bool
+	// opt is element type of pointer field prefixed with presence flag
+	opt   string
+	sbox  sboxTail
+	split []*field
+}
+
+type structType struct {
+	name string
+	typ  *types.Named
+	flds []*field
+	// tail is set when last field is read till the end of body, so IReadTail is needed
+	tail bool
+	// fallback is set when some field is encoded with reflection, so size is not known
+	fallback bool
+}
+
+type Generator struct {
+	buf     bytes.Buffer
+	pkg     *types.Package
+	structs map[string]*structType
+	imports map[string]string
+}
+
+// Generate loads package in dir, ignoring file skip, and returns formatted source
+// with methods for types names.
+func Generate(dir string, names []string, skip string) ([]byte, error) {
+	pkg, err := loadPackage(dir, skip)
+	if err != nil {
+		return nil, err
+	}
+	g := &Generator{
+		pkg:     pkg,
+		structs: make(map[string]*structType),
+		imports: map[string]string{marshalPath: "marshal"},
+	}
+	var sts []*structType
+	for _, name := range names {
+		st, err := g.lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		g.structs[name] = st
+		sts = append(sts, st)
+	}
+	for _, st := range sts {
+		if st.flds, err = g.fields(st.typ.Underlying().(*types.Struct), true); err != nil {
+			return nil, fmt.Errorf("%s: %s", st.name, err)
+		}
+		for _, f := range st.flds {
+			if f.enc.kind == encFallback {
+				st.fallback = true
+			}
+		}
+		if len(st.flds) > 0 {
+			st.tail = st.flds[len(st.flds)-1].nosize
+		}
+	}
+
+	for _, st := range sts {
+		g.genStruct(st)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by iprotogen -type=%s; DO NOT EDIT.\n\n", strings.Join(names, ","))
+	fmt.Fprintf(&out, "package %s\n\nimport (\n", pkg.Name())
+	paths := make([]string, 0, len(g.imports))
+	for path, name := range g.imports {
+		// type names are qualified even for fields encoded with reflection
+		if bytes.Contains(g.buf.Bytes(), []byte(name+".")) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(&out, "\t%q\n", path)
+	}
+	out.WriteString(")\n")
+	out.Write(g.buf.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return out.Bytes(), fmt.Errorf("internal error: invalid Go generated: %s", err)
+	}
+	return src, nil
+}
+
+func loadPackage(dir, skip string) (*types.Package, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		if name == skip {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		// package may refer to methods we are going to generate
+		Error: func(error) {},
+	}
+	pkg, _ := conf.Check(bp.ImportPath, fset, files, nil)
+	if pkg == nil {
+		return nil, fmt.Errorf("could not check package in %s", dir)
+	}
+	return pkg, nil
+}
+
+func (g *Generator) lookup(name string) (*structType, error) {
+	obj, ok := g.pkg.Scope().Lookup(name).(*types.TypeName)
+	if !ok {
+		return nil, fmt.Errorf("type %s is not found", name)
+	}
+	named, ok := obj.Type().(*types.Named)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a named type", name)
+	}
+	if _, ok := named.Underlying().(*types.Struct); !ok {
+		return nil, fmt.Errorf("%s is not a struct", name)
+	}
+	if g.ownMethods(named) {
+		return nil, fmt.Errorf("%s already has IWrite or IRead method", name)
+	}
+	return &structType{name: name, typ: named}, nil
+}
+
+func (g *Generator) qualifier(p *types.Package) string {
+	if p == g.pkg {
+		return ""
+	}
+	g.imports[p.Path()] = p.Name()
+	return p.Name()
+}
+
+func (g *Generator) typeString(t types.Type) string {
+	return types.TypeString(t, g.qualifier)
+}
+
+// ownMethods reports whether type is encoded by its own methods.
+func (g *Generator) ownMethods(t types.Type) bool {
+	if g.generated(t) != nil {
+		return false
+	}
+	ms := types.NewMethodSet(types.NewPointer(t))
+	return ms.Lookup(nil, "IWrite") != nil || ms.Lookup(nil, "IRead") != nil
+}
+
+func (g *Generator) generated(t types.Type) *structType {
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() != g.pkg {
+		return nil
+	}
+	return g.structs[named.Obj().Name()]
+}
+
+func (g *Generator) number(t types.Type) (number, bool) {
+	if g.ownMethods(t) {
+		return number{}, false
+	}
+	if b, ok := t.Underlying().(*types.Basic); ok {
+		num, ok := numbers[b.Kind()]
+		return num, ok
+	}
+	return number{}, false
+}
+
+// timeUnits maps time() directive units to marshal constants
+var timeUnits = map[string]string{
+	"sec":   "marshal.TimeSec",
+	"ms":    "marshal.TimeMs",
+	"epoch": "marshal.TimeEpoch",
+}
+
+// isTime reports whether t is time.Time, or time.Duration if name is Duration
+func isTime(t types.Type, name string) bool {
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "time" && named.Obj().Name() == name
+}
+
+func (g *Generator) classify(t types.Type, ber bool, unit string) (*enc, error) {
+	e := &enc{typ: g.typeString(t), ber: ber}
+	if unit != "" && timeUnits[unit] == "" {
+		return nil, fmt.Errorf("could not understand directive time(%s)", unit)
+	}
+	switch {
+	case isTime(t, "Time"):
+		if unit == "" {
+			unit = "epoch"
+		}
+		e.time = "Time"
+	case unit != "" && isTime(t, "Duration"):
+		e.time = "Duration"
+	case unit != "":
+		return nil, fmt.Errorf("could not apply 'time(%s)' for type %s", unit, e.typ)
+	}
+	if e.time != "" {
+		e.kind = encNum
+		e.setNum(numbers[types.Int64], e.typ)
+		e.unit = timeUnits[unit]
+	} else if !g.ownMethods(t) {
+		switch u := t.Underlying().(type) {
+		case *types.Basic:
+			if num, ok := g.number(t); ok {
+				e.kind = encNum
+				e.setNum(num, g.typeString(t))
+			} else if u.Kind() == types.String {
+				e.kind = encString
+			}
+		case *types.Slice:
+			et := u.Elem()
+			if num, ok := g.number(et); ok {
+				if types.Identical(et, types.Typ[types.Uint8]) && !ber {
+					e.kind = encBytes
+				} else {
+					e.kind = encNumSlice
+					e.setNum(num, g.typeString(et))
+					e.bulk = isBulk(et, num)
+				}
+			} else if st := g.generated(et); st != nil {
+				e.kind = encStructSlice
+				e.elem = g.typeString(et)
+				e.st = st
+			}
+		case *types.Array:
+			et := u.Elem()
+			if num, ok := g.number(et); ok {
+				e.kind = encNumArray
+				e.setNum(num, g.typeString(et))
+				e.bulk = isBulk(et, num)
+				e.len = int(u.Len())
+			}
+		case *types.Struct:
+			if st := g.generated(t); st != nil {
+				e.kind = encStruct
+				e.elem = e.typ
+				e.st = st
+			}
+		}
+	}
+	if ber {
+		switch e.kind {
+		case encNum, encNumSlice, encNumArray:
+			if e.num.uint {
+				e.num = berNumber
+				e.bulk = false
+				return e, nil
+			}
+		}
+		return nil, fmt.Errorf("could not apply 'ber' for type %s", e.typ)
+	}
+	return e, nil
+}
+
+// isBulk reports whether slice of et could be written with slice method of Writer
+func isBulk(et types.Type, num number) bool {
+	_, basic := et.(*types.Basic)
+	return basic && num.meth != "Bool"
+}
+
+func (e *enc) setNum(num number, elem string) {
+	e.num = num
+	e.elem = elem
+}
+
+var prefixes = map[string]string{
+	"ber": "Intvar",
+	"i8":  "IntUint8",
+	"i16": "IntUint16",
+	"i32": "IntUint32",
+	"i64": "IntUint64",
+}
+
+// fields parses exported struct fields as reflective marshal.TWriter does,
+// withSbox enables sbox tail tags.
+func (g *Generator) fields(s *types.Struct, withSbox bool) (flds []*field, err error) {
+	nosize, sboxtail := false, false
+	for i := 0; i < s.NumFields(); i++ {
+		v := s.Field(i)
+		if !v.Exported() {
+			continue
+		}
+		if nosize {
+			return nil, fmt.Errorf("only last field could be marked as size(no) or cnt(no)")
+		}
+		if sboxtail {
+			return nil, fmt.Errorf("sbox tail could be only last field")
+		}
+		tag := reflect.StructTag(s.Tag(i))
+		f := &field{name: v.Name()}
+		var ber, skip, opt bool
+		var unit string
+		for _, m := range strings.Split(tag.Get("iproto"), ",") {
+			switch {
+			case m == "skip":
+				skip = true
+			case m == "ber":
+				ber = true
+			case m == "opt":
+				opt = true
+			case strings.HasPrefix(m, "time(") && strings.HasSuffix(m, ")"):
+				unit = m[5 : len(m)-1]
+			case strings.HasPrefix(m, "size(") && strings.HasSuffix(m, ")"):
+				t := m[5 : len(m)-1]
+				if t == "no" {
+					f.nosize = true
+				} else if f.szm = prefixes[t]; f.szm == "" {
+					return nil, fmt.Errorf("could not understand directive size(%s) for field %s", t, v.Name())
+				}
+			case strings.HasPrefix(m, "cnt(") && strings.HasSuffix(m, ")"):
+				t := m[4 : len(m)-1]
+				if t == "no" {
+					f.nosize = true
+				} else if f.cntm = prefixes[t]; f.cntm == "" {
+					return nil, fmt.Errorf("could not understand directive cnt(%s) for field %s", t, v.Name())
+				}
+			}
+		}
+		if skip {
+			continue
+		}
+		if f.szm != "" && f.cntm != "" {
+			return nil, fmt.Errorf("you shall not use both size() and cnt() iproto tag directive for field %s", v.Name())
+		}
+		if f.szm == "" && f.cntm == "" && !f.nosize && g.zeroSize(v.Type()) {
+			continue
+		}
+		if f.enc, err = g.classify(v.Type(), ber, unit); err != nil {
+			return nil, fmt.Errorf("field %s: %s", v.Name(), err)
+		}
+		if opt {
+			ptr, ok := v.Type().Underlying().(*types.Pointer)
+			if !ok {
+				return nil, fmt.Errorf("could not apply 'opt' for type %s of field %s", f.enc.typ, v.Name())
+			}
+			f.opt = g.typeString(ptr.Elem())
+		}
+		nosize = f.nosize
+
+		if !withSbox {
+			flds = append(flds, f)
+			continue
+		}
+		for _, m := range strings.Split(tag.Get("sbox"), ",") {
+			switch m {
+			case "tail":
+				f.sbox = tail
+			case "tailsplit":
+				f.sbox = tailSplit
+			default:
+				continue
+			}
+			sl, ok := v.Type().Underlying().(*types.Slice)
+			if !ok {
+				return nil, fmt.Errorf("could apply sbox:%s only for slices", m)
+			}
+			elem := &field{}
+			if elem.enc, err = g.classify(sl.Elem(), ber, ""); err != nil {
+				return nil, fmt.Errorf("field %s: %s", v.Name(), err)
+			}
+			f.split = []*field{elem}
+			if f.sbox == tailSplit {
+				s, ok := sl.Elem().Underlying().(*types.Struct)
+				if !ok {
+					return nil, fmt.Errorf("could apply sbox:tailsplit only for slices of struct")
+				}
+				if f.split, err = g.fields(s, false); err != nil {
+					return nil, fmt.Errorf("field %s: %s", v.Name(), err)
+				}
+			}
+			sboxtail = true
+		}
+		flds = append(flds, f)
+	}
+	return flds, nil
+}
+
+// zeroSize reports whether reflective writer skips field of this type.
+func (g *Generator) zeroSize(t types.Type) bool {
+	if g.generated(t) != nil || g.ownMethods(t) || isTime(t, "Time") {
+		return false
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Array:
+		return u.Len() == 0 || g.zeroSize(u.Elem())
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			v := u.Field(i)
+			tag := reflect.StructTag(u.Tag(i)).Get("iproto")
+			if v.Exported() && (tag != "" || !g.zeroSize(v.Type())) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (g *Generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *Generator) genStruct(st *structType) {
+	g.printf("\nfunc (s %s) IWrite(w *marshal.Writer) {\n", st.name)
+	for _, f := range st.flds {
+		x := "s." + f.name
+		var code string
+		switch {
+		case f.szm != "":
+			code = writeWithSize(f.enc, x, f.szm)
+		case f.cntm != "":
+			code = writeWithCount(f.enc, x, f.cntm)
+		case f.nosize:
+			code = writeRaw(f.enc, x)
+		default:
+			code = writeAuto(f.enc, x)
+		}
+		if f.opt != "" {
+			code = fmt.Sprintf("if %s == nil {\nw.Bool(false)\n} else {\nw.Bool(true)\n%s}\n", x, code)
+		}
+		g.printf("%s", code)
+	}
+	g.printf("}\n")
+
+	g.genSize(st)
+
+	g.genRead(st, "IRead")
+	if st.tail {
+		g.genRead(st, "IReadTail")
+	}
+
+	g.genTupleWrite(st)
+	g.genTupleRead(st)
+}
+
+func (g *Generator) genSize(st *structType) {
+	g.printf("\nfunc (s %s) ISize() int {\n", st.name)
+	if st.fallback {
+		g.printf("\treturn -1\n}\n")
+		return
+	}
+	const0 := 0
+	var body bytes.Buffer
+	for _, f := range st.flds {
+		x := "s." + f.name
+		sz, dyn := sizeExpr(f.enc, x)
+		if dyn {
+			fmt.Fprintf(&body, "if n := %s; n >= 0 {\n", sz)
+			switch {
+			case f.szm != "":
+				fmt.Fprintf(&body, "sz += %s + n\n", prefixSize(f.szm, "n"))
+			case f.cntm != "":
+				fmt.Fprintf(&body, "sz += %s + n\n", prefixSize(f.cntm, countExpr(f.enc, x)))
+			case !f.nosize && f.enc.counted():
+				fmt.Fprintf(&body, "sz += 4 + n\n")
+			default:
+				fmt.Fprintf(&body, "sz += n\n")
+			}
+			fmt.Fprintf(&body, "} else {\nreturn -1\n}\n")
+			continue
+		}
+		var prefix string
+		switch {
+		case f.szm != "":
+			prefix = prefixSize(f.szm, sz)
+		case f.cntm != "":
+			prefix = prefixSize(f.cntm, countExpr(f.enc, x))
+		case !f.nosize && f.enc.counted():
+			prefix = "4"
+		}
+		for _, part := range []string{prefix, sz} {
+			if n, err := strconv.Atoi(part); err == nil {
+				const0 += n
+			} else if part != "" {
+				fmt.Fprintf(&body, "sz += %s\n", part)
+			}
+		}
+	}
+	if body.Len() == 0 {
+		g.printf("\treturn %d\n}\n", const0)
+		return
+	}
+	g.printf("\tsz := %d\n%s\treturn sz\n}\n", const0, body.String())
+}
+
+func (g *Generator) genRead(st *structType, name string) {
+	g.printf("\nfunc (s *%s) %s(r *marshal.Reader) {\n", st.name, name)
+	for i, f := range st.flds {
+		x := "s." + f.name
+		var code string
+		switch {
+		case f.szm != "":
+			code = readWithSize(f.enc, x, "r", f.szm)
+		case f.cntm != "":
+			code = readWithCount(f.enc, x, "r", f.cntm)
+		case f.nosize && name == "IReadTail" && i == len(st.flds)-1:
+			code = readTail(f.enc, x, "r")
+		case f.nosize:
+			code = readFixed(f.enc, x, "r")
+		default:
+			code = readAuto(f.enc, x, "r")
+		}
+		if f.opt != "" {
+			code = fmt.Sprintf("if r.Bool() {\nif %s == nil {\n%s = new(%s)\n}\n%s} else if r.Err == nil {\n%s = nil\n}\n",
+				x, x, f.opt, code, x)
+		}
+		g.printf("%s", code)
+	}
+	g.printf("}\n")
+}
+
+func splitTail(st *structType) (flds []*field, last *field) {
+	flds = st.flds
+	if n := len(flds); n > 0 && flds[n-1].sbox != noTail {
+		return flds[:n-1], flds[n-1]
+	}
+	return flds, nil
+}
+
+func (g *Generator) genTupleWrite(st *structType) {
+	g.printf("\nfunc (s %s) ITupleWrite(w *marshal.Writer) {\n", st.name)
+	flds, last := splitTail(st)
+	switch {
+	case last == nil:
+		g.printf("w.IntUint32(%d)\n", len(flds))
+	case last.sbox == tail:
+		g.printf("w.IntUint32(%d + len(s.%s))\n", len(flds), last.name)
+	default:
+		g.printf("w.IntUint32(%d + len(s.%s)*%d)\n", len(flds), last.name, len(last.split))
+	}
+	for _, f := range flds {
+		x := "s." + f.name
+		code := writeWithSize(f.enc, x, "Intvar")
+		if f.opt != "" {
+			// nil optional pointer is written as empty field
+			code = fmt.Sprintf("if %s == nil {\nw.Intvar(0)\n} else %s", x, code)
+		}
+		g.printf("%s", code)
+	}
+	if last != nil {
+		g.printf("for j := range s.%s {\n", last.name)
+		for _, f := range last.split {
+			x := "s." + last.name + "[j]"
+			if f.name != "" {
+				x += "." + f.name
+			}
+			g.printf("%s", writeWithSize(f.enc, x, "Intvar"))
+		}
+		g.printf("}\n")
+	}
+	g.printf("}\n")
+}
+
+func (g *Generator) genTupleRead(st *structType) {
+	g.printf("\nfunc (s *%s) ITupleRead(r *marshal.Reader) {\n", st.name)
+	flds, last := splitTail(st)
+	if len(flds) == 0 && last == nil {
+		g.printf("r.IntUint32()\n}\n")
+		return
+	}
+	g.printf("n := r.IntUint32()\n")
+	for i, f := range flds {
+		g.printf("if n <= %d {\nreturn\n}\n", i)
+		x := "s." + f.name
+		if f.opt != "" {
+			g.printf("if sz := r.Intvar(); sz > 0 {\nif %s == nil {\n%s = new(%s)\n}\nif sr := r.Sub(sz); r.Err == nil {\n%sr.Join(&sr)\n}\n} else if r.Err == nil {\n%s = nil\n}\n",
+				x, x, f.opt, readTail(f.enc, x, "sr"), x)
+			continue
+		}
+		g.printf("%s", readWithSize(f.enc, x, "r", "Intvar"))
+	}
+	if last != nil {
+		x := "s." + last.name
+		cnt := "n"
+		if len(flds) > 0 {
+			g.printf("if n < %d {\nreturn\n}\n", len(flds))
+			cnt = fmt.Sprintf("n - %d", len(flds))
+		}
+		if last.sbox == tailSplit {
+			cnt = fmt.Sprintf("(%s) / %d", cnt, len(last.split))
+		}
+		g.printf("if l := %s; len(%s) != l {\n%s = make(%s, l)\n}\n", cnt, x, x, last.enc.typ)
+		g.printf("for j := range %s {\n", x)
+		for _, f := range last.split {
+			x := x + "[j]"
+			if f.name != "" {
+				x += "." + f.name
+			}
+			g.printf("%s", readWithSize(f.enc, x, "r", "Intvar"))
+		}
+		g.printf("}\n")
+	}
+	g.printf("}\n")
+}
+
+// Writer code
+
+func wconv(e *enc, x string) string {
+	if e.time != "" {
+		return fmt.Sprintf("marshal.%sInt(%s, %s)", e.time, x, e.unit)
+	}
+	if e.elem == e.num.arg {
+		return x
+	}
+	return e.num.arg + "(" + x + ")"
+}
+
+func rconv(e *enc, x string) string {
+	if e.time != "" {
+		return fmt.Sprintf("marshal.Int%s(%s, %s)", e.time, x, e.unit)
+	}
+	if e.elem == e.num.arg {
+		return x
+	}
+	return e.elem + "(" + x + ")"
+}
+
+func sconv(e *enc, x string) string {
+	if e.typ == "string" {
+		return x
+	}
+	return e.typ + "(" + x + ")"
+}
+
+func sizeExpr(e *enc, x string) (sz string, dyn bool) {
+	switch e.kind {
+	case encNum:
+		if e.ber {
+			return "marshal.Varsize64(" + wconv(e, x) + ")", false
+		}
+		return strconv.Itoa(e.num.size), false
+	case encString, encBytes:
+		return "len(" + x + ")", false
+	case encNumSlice:
+		if e.ber {
+			return "marshal.VarslSize(" + x + ")", false
+		}
+		if e.num.size == 1 {
+			return "len(" + x + ")", false
+		}
+		return fmt.Sprintf("len(%s)*%d", x, e.num.size), false
+	case encNumArray:
+		if e.ber {
+			return "marshal.VarslSize(" + x + "[:])", false
+		}
+		return strconv.Itoa(e.fixed()), false
+	case encStruct:
+		return x + ".ISize()", true
+	case encStructSlice:
+		return "marshal.ISizeSl(" + x + ")", true
+	}
+	panic("size of fallback field")
+}
+
+func countExpr(e *enc, x string) string {
+	switch e.kind {
+	case encNum, encStruct:
+		return "1"
+	case encNumArray:
+		return strconv.Itoa(e.len)
+	}
+	return "len(" + x + ")"
+}
+
+func prefixSize(m string, n string) string {
+	switch m {
+	case "IntUint8":
+		return "1"
+	case "IntUint16":
+		return "2"
+	case "IntUint32":
+		return "4"
+	case "IntUint64":
+		return "8"
+	}
+	if i, err := strconv.Atoi(n); err == nil {
+		return strconv.Itoa(varsize(i))
+	}
+	return "marshal.Varsize(" + n + ")"
+}
+
+func varsize(i int) (j int) {
+	for j = 0; i >= 1<<7; j++ {
+		i >>= 7
+	}
+	return j + 1
+}
+
+func writeRaw(e *enc, x string) string {
+	switch e.kind {
+	case encNum:
+		return fmt.Sprintf("w.%s(%s)\n", e.num.meth, wconv(e, x))
+	case encString:
+		if e.typ != "string" {
+			x = "string(" + x + ")"
+		}
+		return fmt.Sprintf("w.String(%s)\n", x)
+	case encBytes:
+		return fmt.Sprintf("w.Bytes(%s)\n", x)
+	case encNumSlice, encNumArray:
+		sl := x
+		if e.kind == encNumArray {
+			sl += "[:]"
+		}
+		if e.bulk {
+			return fmt.Sprintf("w.%ssl(%s)\n", e.num.meth, sl)
+		}
+		return fmt.Sprintf("for i := range %s {\nw.%s(%s)\n}\n", x, e.num.meth, wconv(e, x+"[i]"))
+	case encStruct:
+		return fmt.Sprintf("%s.IWrite(w)\n", x)
+	case encStructSlice:
+		return fmt.Sprintf("for i := range %s {\n%s[i].IWrite(w)\n}\n", x, x)
+	}
+	return "{\n" + wfield("FieldRaw", x, "") + "}\n"
+}
+
+// wfield passes pointer to copy of x to reflective writer,
+// so value receiver of generated method doesn't escape to heap.
+func wfield(meth, x, args string) string {
+	return fmt.Sprintf("f := %s\nw.%s(&f%s)\n", x, meth, args)
+}
+
+func writeAuto(e *enc, x string) string {
+	if e.kind == encFallback {
+		return "{\n" + wfield("FieldAuto", x, "") + "}\n"
+	}
+	if e.counted() {
+		return fmt.Sprintf("w.IntUint32(len(%s))\n", x) + writeRaw(e, x)
+	}
+	return writeRaw(e, x)
+}
+
+func writeWithSize(e *enc, x, m string) string {
+	if e.kind == encFallback {
+		return "{\n" + wfield("FieldWithSize", x, ", (*marshal.Writer)."+m) + "}\n"
+	}
+	sz, dyn := sizeExpr(e, x)
+	if !dyn {
+		return fmt.Sprintf("w.%s(%s)\n", m, sz) + writeRaw(e, x)
+	}
+	return fmt.Sprintf("if sz := %s; sz >= 0 {\nw.%s(sz)\n%s} else {\n%s}\n",
+		sz, m, writeRaw(e, x), wfield("FieldWithSize", x, ", (*marshal.Writer)."+m))
+}
+
+func writeWithCount(e *enc, x, m string) string {
+	if e.kind == encFallback {
+		return "{\n" + wfield("FieldWithCount", x, ", (*marshal.Writer)."+m) + "}\n"
+	}
+	return fmt.Sprintf("w.%s(%s)\n", m, countExpr(e, x)) + writeRaw(e, x)
+}
+
+// Reader code, rd is name of reader variable
+
+func ref(rd string) string {
+	if rd == "r" {
+		return rd
+	}
+	return "&" + rd
+}
+
+func readFixed(e *enc, x, rd string) string {
+	switch e.kind {
+	case encNum:
+		return fmt.Sprintf("%s = %s\n", x, rconv(e, rd+"."+e.num.meth+"()"))
+	case encString:
+		return fmt.Sprintf("%s = %s\n", x, sconv(e, rd+".String("+rd+".IntUint32())"))
+	case encBytes:
+		return fmt.Sprintf("%s.Uint8sl(%s)\n", rd, x)
+	case encNumSlice, encNumArray:
+		sl := x
+		if e.kind == encNumArray {
+			sl += "[:]"
+		}
+		if e.bulk {
+			return fmt.Sprintf("%s.%ssl(%s)\n", rd, e.num.meth, sl)
+		}
+		return fmt.Sprintf("for i := range %s {\n%s[i] = %s\n}\n", x, x, rconv(e, rd+"."+e.num.meth+"()"))
+	case encStruct:
+		return fmt.Sprintf("%s.IRead(%s)\n", x, ref(rd))
+	case encStructSlice:
+		return fmt.Sprintf("for i := range %s {\n%s[i].IRead(%s)\n}\n", x, x, ref(rd))
+	}
+	return fmt.Sprintf("%s.FieldFixed(&%s)\n", rd, x)
+}
+
+func readAuto(e *enc, x, rd string) string {
+	if e.kind == encFallback {
+		return fmt.Sprintf("%s.FieldAuto(&%s)\n", rd, x)
+	}
+	if e.counted() {
+		return readWithCount(e, x, rd, "IntUint32")
+	}
+	return readFixed(e, x, rd)
+}
+
+func readTail(e *enc, x, rd string) string {
+	switch e.kind {
+	case encString:
+		return fmt.Sprintf("%s = %s\n", x, sconv(e, "string("+rd+".Tail())"))
+	case encBytes:
+		return fmt.Sprintf("%s = %s.Tail()\n", x, rd)
+	case encNumSlice:
+		if !e.ber {
+			n := "len(" + rd + ".Body)"
+			if e.num.size > 1 {
+				n += "/" + strconv.Itoa(e.num.size)
+			}
+			return fmt.Sprintf("if %s.Err == nil {\n%s = make(%s, %s)\n%s}\n", rd, x, e.typ, n, readFixed(e, x, rd))
+		}
+		return fmt.Sprintf("%s = %s[:0]\nfor len(%s.Body) > 0 && %s.Err == nil {\n%s = append(%s, %s)\n}\n",
+			x, x, rd, rd, x, x, rconv(e, rd+"."+e.num.meth+"()"))
+	case encStructSlice:
+		return fmt.Sprintf("%s = %s[:0]\nfor len(%s.Body) > 0 && %s.Err == nil {\n%s = append(%s, %s{})\n%s[len(%s)-1].IRead(%s)\n}\n",
+			x, x, rd, rd, x, x, e.elem, x, x, ref(rd))
+	case encStruct:
+		if e.st.tail {
+			return fmt.Sprintf("%s.IReadTail(%s)\n", x, ref(rd))
+		}
+	case encFallback:
+		return fmt.Sprintf("%s.FieldTail(&%s)\n", rd, x)
+	}
+	return readFixed(e, x, rd)
+}
+
+func readWithCount(e *enc, x, rd, m string) string {
+	switch e.kind {
+	case encNum, encStruct, encNumArray:
+		return fmt.Sprintf("if %s.Expect(\"count\", %s.%s(), %s) {\n%s}\n", rd, rd, m, countExpr(e, x), readFixed(e, x, rd))
+	case encString:
+		return fmt.Sprintf("%s = %s\n", x, sconv(e, rd+".String("+rd+"."+m+"())"))
+	case encBytes:
+		return fmt.Sprintf("%s = %s.Slice(%s.%s())\n", x, rd, rd, m)
+	case encNumSlice, encStructSlice:
+		return fmt.Sprintf("if l := %s.%s(); %s.Err == nil {\nif len(%s) != l {\n%s = make(%s, l)\n}\n%s}\n",
+			rd, m, rd, x, x, e.typ, readFixed(e, x, rd))
+	}
+	return fmt.Sprintf("%s.FieldWithCount(&%s, (*marshal.Reader).%s)\n", rd, x, m)
+}
+
+func readWithSize(e *enc, x, rd, m string) string {
+	if sz := e.fixed(); sz >= 0 {
+		return fmt.Sprintf("if %s.Expect(\"size\", %s.%s(), %d) {\n%s}\n", rd, rd, m, sz, readFixed(e, x, rd))
+	}
+	switch e.kind {
+	case encString, encBytes:
+		return readWithCount(e, x, rd, m)
+	case encNumSlice:
+		if !e.ber {
+			n := rd + "." + m + "()"
+			if e.num.size > 1 {
+				n += " / " + strconv.Itoa(e.num.size)
+			}
+			return fmt.Sprintf("if l := %s; %s.Err == nil {\nif len(%s) != l {\n%s = make(%s, l)\n}\n%s}\n",
+				n, rd, x, x, e.typ, readFixed(e, x, rd))
+		}
+	case encFallback:
+		return fmt.Sprintf("%s.FieldWithSize(&%s, (*marshal.Reader).%s)\n", rd, x, m)
+	}
+	return fmt.Sprintf("if sr := %s.Sub(%s.%s()); %s.Err == nil {\n%s%s.Join(&sr)\n}\n",
+		rd, rd, m, rd, readTail(e, x, "sr"), rd)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const gentestTypes = "Ints,Strs,Nums,Nested,Sized,Tuple,Split,Loose,Times,Opts"
+
+func TestGenerateUpToDate(t *testing.T) {
+	out := filepath.Join("gentest", "ints_iproto.go")
+	want, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Generate("gentest", strings.Split(gentestTypes, ","), filepath.Base(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s is out of date, run go generate in gentest", out)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir := t.TempDir()
+	src := `package bad
+
+import "time"
+
+type Size struct {
+	A []byte ` + "`iproto:\"size(no)\"`" + `
+	B int32
+}
+
+type Tail struct {
+	A []int32 ` + "`sbox:\"tail\"`" + `
+	B int32
+}
+
+type Ber struct {
+	A string ` + "`iproto:\"ber\"`" + `
+}
+
+type Opt struct {
+	A int32 ` + "`iproto:\"opt\"`" + `
+}
+
+type Unit struct {
+	A time.Time ` + "`iproto:\"time(h)\"`" + `
+}
+
+type NotTime struct {
+	A int64 ` + "`iproto:\"time(sec)\"`" + `
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "bad.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Size", "Tail", "Ber", "Opt", "Unit", "NotTime", "Missing"} {
+		if _, err := Generate(dir, []string{name}, "bad_iproto.go"); err == nil {
+			t.Errorf("%s: error expected", name)
+		}
+	}
+}
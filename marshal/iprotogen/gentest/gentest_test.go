@@ -0,0 +1,230 @@
+package gentest
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto/marshal"
+	"github.com/funny-falcon/go-iproto/sbox"
+)
+
+// ref types have the same layout, but no generated methods, so they are encoded with reflection
+type refInts Ints
+type refStrs Strs
+type refNums Nums
+type refNested Nested
+type refSized Sized
+type refTuple Tuple
+type refSplit Split
+type refLoose Loose
+type refTimes Times
+type refOpts Opts
+
+var ints = Ints{
+	I8: -1, I16: -300, I32: 0x12345678, I64: -1 << 40,
+	U8: 0xfe, U16: 0xfedc, U32: 0xfedcba98, U64: 1 << 63,
+	F32: 1.5, F64: -2.25, Id: 77,
+}
+
+var strs = Strs{
+	S: "hello", N: "name", B: []byte{1, 2, 3}, O: []Octet{4, 5},
+	SB: string(make([]byte, 200)), BI16: []byte("bi16"), NC8: "nc8",
+}
+
+var nums = Nums{
+	Sl: []int32{-1, 2}, Ids: []Id{3, 4, 5}, Arr: [3]uint16{6, 7, 8},
+	Ber: 1 << 40, Bers: []uint32{127, 128, 300}, BerA: [2]uint16{0x3fff, 0x4000},
+	BerS: 128, SlS: []int64{-9}, SlC: []float32{0.5, 1}, ArrS: [2]int16{-1, 1},
+	ArrC: [2]int16{2, -2}, I64: 64,
+}
+
+var nested = Nested{
+	Ints: ints, Strs: strs, IntsC: ints,
+	All:  []Ints{ints, {I8: 1}},
+	Some: []Nums{nums, {}},
+	Tail: []byte("tail"),
+}
+
+var sized = Sized{Head: 1, Nested: nested, Last: nested}
+
+var tuple = Tuple{Id: 1, Name: "tuple", Flags: 200, Ints: ints, Tags: []string{"a", "bc"}}
+
+var split = Split{Id: 2, Pairs: []Pair{{"a", 1}, {"b", 2}}}
+
+var p = int32(5)
+var loose = Loose{P: &p, Ps: []*Ints{&ints}, Any: "any", Pc: &nums, Vs: [2]string{"v", "s"}}
+
+var times = Times{
+	On: true, Flags: []bool{true, false}, Fl: [2]Flag{false, true},
+	T:  time.Date(2020, time.May, 4, 3, 2, 1, 123456789, time.UTC),
+	Ts: time.Unix(1500000000, 0).UTC(),
+	Tm: time.UnixMilli(1500000000123).UTC(),
+	D:  1500 * time.Millisecond, Ds: time.Minute,
+}
+
+var name = Name("opt")
+var opts = Opts{
+	M: map[string]int32{"b": 2, "a": 1, "c": 3},
+	P: &p, Pz: &name,
+	Ts: []time.Time{times.T, {}},
+}
+
+type sample struct {
+	gen, ref interface{}
+	// read is false, if reflective decoding could not read value back
+	read bool
+}
+
+var samples = []sample{
+	{ints, refInts(ints), true},
+	{strs, refStrs(strs), true},
+	{nums, refNums(nums), true},
+	{nested, refNested(nested), true},
+	{sized, refSized(sized), true},
+	{tuple, refTuple(tuple), true},
+	{split, refSplit(split), true},
+	{loose, refLoose(loose), false},
+	{times, refTimes(times), true},
+	{Times{}, refTimes{}, true},
+	{opts, refOpts(opts), true},
+	{Opts{Pn: &ints}, refOpts{Pn: &ints}, true},
+}
+
+func newOf(v interface{}) interface{} {
+	return reflect.New(reflect.TypeOf(v)).Interface()
+}
+
+func TestWrite(t *testing.T) {
+	for _, s := range samples {
+		gen, ref := marshal.Write(s.gen), marshal.Write(s.ref)
+		if !bytes.Equal(gen, ref) {
+			t.Errorf("%T:\ngenerated [% x]\nreflected [% x]", s.gen, gen, ref)
+		}
+		if sz := s.gen.(marshal.IShortSizer).ISize(); sz >= 0 && sz != len(gen) {
+			t.Errorf("%T: ISize %d, written %d", s.gen, sz, len(gen))
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	for _, s := range samples {
+		if !s.read {
+			continue
+		}
+		b := marshal.Write(s.ref)
+		gen, ref := newOf(s.gen), newOf(s.ref)
+		if err := marshal.ReadTail(b, gen); err != nil {
+			t.Errorf("%T: %s", s.gen, err)
+		}
+		if err := marshal.ReadTail(b, ref); err != nil {
+			t.Errorf("%T: %s", s.ref, err)
+		}
+		back := reflect.ValueOf(ref).Elem().Convert(reflect.TypeOf(s.gen)).Interface()
+		if g := reflect.ValueOf(gen).Elem().Interface(); !reflect.DeepEqual(g, back) {
+			t.Errorf("%T:\ngenerated %+v\nreflected %+v", s.gen, g, back)
+		}
+	}
+}
+
+func TestTuple(t *testing.T) {
+	w := &marshal.Writer{}
+	for _, s := range samples {
+		sbox.WriteTuple(w, s.gen)
+		gen := w.Written()
+		sbox.WriteTuple(w, s.ref)
+		ref := w.Written()
+		if !bytes.Equal(gen, ref) {
+			t.Errorf("%T:\ngenerated [% x]\nreflected [% x]", s.gen, gen, ref)
+		}
+		if !s.read {
+			continue
+		}
+		gv, rv := newOf(s.gen), newOf(s.ref)
+		if err := sbox.ReadRawTuple(&marshal.Reader{Body: ref}, gv); err != nil {
+			t.Errorf("%T: %s", s.gen, err)
+		}
+		if err := sbox.ReadRawTuple(&marshal.Reader{Body: ref}, rv); err != nil {
+			t.Errorf("%T: %s", s.ref, err)
+		}
+		back := reflect.ValueOf(rv).Elem().Convert(reflect.TypeOf(s.gen)).Interface()
+		if g := reflect.ValueOf(gv).Elem().Interface(); !reflect.DeepEqual(g, back) {
+			t.Errorf("%T:\ngenerated %+v\nreflected %+v", s.gen, g, back)
+		}
+	}
+}
+
+func benchmarkWrite(b *testing.B, v interface{}) {
+	b.ReportAllocs()
+	w := &marshal.Writer{}
+	for i := 0; i < b.N; i++ {
+		w.Write(v)
+		w.Reset()
+	}
+}
+
+func BenchmarkWriteGenerated(b *testing.B) {
+	benchmarkWrite(b, nested)
+}
+
+func BenchmarkWriteReflect(b *testing.B) {
+	benchmarkWrite(b, refNested(nested))
+}
+
+func benchmarkRead(b *testing.B, v interface{}) {
+	b.ReportAllocs()
+	body := marshal.Write(v)
+	p := newOf(v)
+	for i := 0; i < b.N; i++ {
+		if err := marshal.ReadTail(body, p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadGenerated(b *testing.B) {
+	benchmarkRead(b, ints)
+}
+
+func BenchmarkReadReflect(b *testing.B) {
+	benchmarkRead(b, refInts(ints))
+}
+
+func benchmarkTupleWrite(b *testing.B, v interface{}) {
+	b.ReportAllocs()
+	w := &marshal.Writer{}
+	for i := 0; i < b.N; i++ {
+		sbox.WriteTuple(w, v)
+		w.Reset()
+	}
+}
+
+func BenchmarkTupleWriteGenerated(b *testing.B) {
+	benchmarkTupleWrite(b, tuple)
+}
+
+func BenchmarkTupleWriteReflect(b *testing.B) {
+	benchmarkTupleWrite(b, refTuple(tuple))
+}
+
+func benchmarkTupleRead(b *testing.B, v interface{}) {
+	b.ReportAllocs()
+	w := &marshal.Writer{}
+	sbox.WriteTuple(w, v)
+	body := w.Written()
+	p := newOf(v)
+	for i := 0; i < b.N; i++ {
+		if err := sbox.ReadRawTuple(&marshal.Reader{Body: body}, p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTupleReadGenerated(b *testing.B) {
+	benchmarkTupleRead(b, tuple)
+}
+
+func BenchmarkTupleReadReflect(b *testing.B) {
+	benchmarkTupleRead(b, refTuple(tuple))
+}
@@ -0,0 +1,1279 @@
+// Code generated by iprotogen -type=Ints,Strs,Nums,Nested,Sized,Tuple,Split,Loose,Times,Opts; DO NOT EDIT.
+
+package gentest
+
+import (
+	"github.com/funny-falcon/go-iproto/marshal"
+	"time"
+)
+
+func (s Ints) IWrite(w *marshal.Writer) {
+	w.Int8(s.I8)
+	w.Int16(s.I16)
+	w.Int32(s.I32)
+	w.Int64(s.I64)
+	w.Uint8(s.U8)
+	w.Uint16(s.U16)
+	w.Uint32(s.U32)
+	w.Uint64(s.U64)
+	w.Float32(s.F32)
+	w.Float64(s.F64)
+	w.Uint32(uint32(s.Id))
+}
+
+func (s Ints) ISize() int {
+	return 46
+}
+
+func (s *Ints) IRead(r *marshal.Reader) {
+	s.I8 = r.Int8()
+	s.I16 = r.Int16()
+	s.I32 = r.Int32()
+	s.I64 = r.Int64()
+	s.U8 = r.Uint8()
+	s.U16 = r.Uint16()
+	s.U32 = r.Uint32()
+	s.U64 = r.Uint64()
+	s.F32 = r.Float32()
+	s.F64 = r.Float64()
+	s.Id = Id(r.Uint32())
+}
+
+func (s Ints) ITupleWrite(w *marshal.Writer) {
+	w.IntUint32(11)
+	w.Intvar(1)
+	w.Int8(s.I8)
+	w.Intvar(2)
+	w.Int16(s.I16)
+	w.Intvar(4)
+	w.Int32(s.I32)
+	w.Intvar(8)
+	w.Int64(s.I64)
+	w.Intvar(1)
+	w.Uint8(s.U8)
+	w.Intvar(2)
+	w.Uint16(s.U16)
+	w.Intvar(4)
+	w.Uint32(s.U32)
+	w.Intvar(8)
+	w.Uint64(s.U64)
+	w.Intvar(4)
+	w.Float32(s.F32)
+	w.Intvar(8)
+	w.Float64(s.F64)
+	w.Intvar(4)
+	w.Uint32(uint32(s.Id))
+}
+
+func (s *Ints) ITupleRead(r *marshal.Reader) {
+	n := r.IntUint32()
+	if n <= 0 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 1) {
+		s.I8 = r.Int8()
+	}
+	if n <= 1 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 2) {
+		s.I16 = r.Int16()
+	}
+	if n <= 2 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 4) {
+		s.I32 = r.Int32()
+	}
+	if n <= 3 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 8) {
+		s.I64 = r.Int64()
+	}
+	if n <= 4 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 1) {
+		s.U8 = r.Uint8()
+	}
+	if n <= 5 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 2) {
+		s.U16 = r.Uint16()
+	}
+	if n <= 6 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 4) {
+		s.U32 = r.Uint32()
+	}
+	if n <= 7 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 8) {
+		s.U64 = r.Uint64()
+	}
+	if n <= 8 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 4) {
+		s.F32 = r.Float32()
+	}
+	if n <= 9 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 8) {
+		s.F64 = r.Float64()
+	}
+	if n <= 10 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 4) {
+		s.Id = Id(r.Uint32())
+	}
+}
+
+func (s Strs) IWrite(w *marshal.Writer) {
+	w.IntUint32(len(s.S))
+	w.String(s.S)
+	w.IntUint32(len(s.N))
+	w.String(string(s.N))
+	w.IntUint32(len(s.B))
+	w.Bytes(s.B)
+	w.IntUint32(len(s.O))
+	for i := range s.O {
+		w.Uint8(uint8(s.O[i]))
+	}
+	w.Intvar(len(s.SB))
+	w.String(s.SB)
+	w.IntUint16(len(s.BI16))
+	w.Bytes(s.BI16)
+	w.IntUint8(len(s.NC8))
+	w.String(string(s.NC8))
+}
+
+func (s Strs) ISize() int {
+	sz := 19
+	sz += len(s.S)
+	sz += len(s.N)
+	sz += len(s.B)
+	sz += len(s.O)
+	sz += marshal.Varsize(len(s.SB))
+	sz += len(s.SB)
+	sz += len(s.BI16)
+	sz += len(s.NC8)
+	return sz
+}
+
+func (s *Strs) IRead(r *marshal.Reader) {
+	s.S = r.String(r.IntUint32())
+	s.N = Name(r.String(r.IntUint32()))
+	s.B = r.Slice(r.IntUint32())
+	if l := r.IntUint32(); r.Err == nil {
+		if len(s.O) != l {
+			s.O = make([]Octet, l)
+		}
+		for i := range s.O {
+			s.O[i] = Octet(r.Uint8())
+		}
+	}
+	s.SB = r.String(r.Intvar())
+	s.BI16 = r.Slice(r.IntUint16())
+	s.NC8 = Name(r.String(r.IntUint8()))
+}
+
+func (s Strs) ITupleWrite(w *marshal.Writer) {
+	w.IntUint32(7)
+	w.Intvar(len(s.S))
+	w.String(s.S)
+	w.Intvar(len(s.N))
+	w.String(string(s.N))
+	w.Intvar(len(s.B))
+	w.Bytes(s.B)
+	w.Intvar(len(s.O))
+	for i := range s.O {
+		w.Uint8(uint8(s.O[i]))
+	}
+	w.Intvar(len(s.SB))
+	w.String(s.SB)
+	w.Intvar(len(s.BI16))
+	w.Bytes(s.BI16)
+	w.Intvar(len(s.NC8))
+	w.String(string(s.NC8))
+}
+
+func (s *Strs) ITupleRead(r *marshal.Reader) {
+	n := r.IntUint32()
+	if n <= 0 {
+		return
+	}
+	s.S = r.String(r.Intvar())
+	if n <= 1 {
+		return
+	}
+	s.N = Name(r.String(r.Intvar()))
+	if n <= 2 {
+		return
+	}
+	s.B = r.Slice(r.Intvar())
+	if n <= 3 {
+		return
+	}
+	if l := r.Intvar(); r.Err == nil {
+		if len(s.O) != l {
+			s.O = make([]Octet, l)
+		}
+		for i := range s.O {
+			s.O[i] = Octet(r.Uint8())
+		}
+	}
+	if n <= 4 {
+		return
+	}
+	s.SB = r.String(r.Intvar())
+	if n <= 5 {
+		return
+	}
+	s.BI16 = r.Slice(r.Intvar())
+	if n <= 6 {
+		return
+	}
+	s.NC8 = Name(r.String(r.Intvar()))
+}
+
+func (s Nums) IWrite(w *marshal.Writer) {
+	w.IntUint32(len(s.Sl))
+	w.Int32sl(s.Sl)
+	w.IntUint32(len(s.Ids))
+	for i := range s.Ids {
+		w.Uint32(uint32(s.Ids[i]))
+	}
+	w.Uint16sl(s.Arr[:])
+	w.Uint64var(s.Ber)
+	w.IntUint32(len(s.Bers))
+	for i := range s.Bers {
+		w.Uint64var(uint64(s.Bers[i]))
+	}
+	for i := range s.BerA {
+		w.Uint64var(uint64(s.BerA[i]))
+	}
+	w.IntUint8(marshal.Varsize64(uint64(s.BerS)))
+	w.Uint64var(uint64(s.BerS))
+	w.Intvar(len(s.SlS) * 8)
+	w.Int64sl(s.SlS)
+	w.IntUint16(len(s.SlC))
+	w.Float32sl(s.SlC)
+	w.IntUint32(4)
+	w.Int16sl(s.ArrS[:])
+	w.Intvar(2)
+	w.Int16sl(s.ArrC[:])
+	w.IntUint64(4)
+	w.Int32(s.I64)
+}
+
+func (s Nums) ISize() int {
+	sz := 46
+	sz += len(s.Sl) * 4
+	sz += len(s.Ids) * 4
+	sz += marshal.Varsize64(s.Ber)
+	sz += marshal.VarslSize(s.Bers)
+	sz += marshal.VarslSize(s.BerA[:])
+	sz += marshal.Varsize64(uint64(s.BerS))
+	sz += marshal.Varsize(len(s.SlS) * 8)
+	sz += len(s.SlS) * 8
+	sz += len(s.SlC) * 4
+	return sz
+}
+
+func (s *Nums) IRead(r *marshal.Reader) {
+	if l := r.IntUint32(); r.Err == nil {
+		if len(s.Sl) != l {
+			s.Sl = make([]int32, l)
+		}
+		r.Int32sl(s.Sl)
+	}
+	if l := r.IntUint32(); r.Err == nil {
+		if len(s.Ids) != l {
+			s.Ids = make([]Id, l)
+		}
+		for i := range s.Ids {
+			s.Ids[i] = Id(r.Uint32())
+		}
+	}
+	r.Uint16sl(s.Arr[:])
+	s.Ber = r.Uint64var()
+	if l := r.IntUint32(); r.Err == nil {
+		if len(s.Bers) != l {
+			s.Bers = make([]uint32, l)
+		}
+		for i := range s.Bers {
+			s.Bers[i] = uint32(r.Uint64var())
+		}
+	}
+	for i := range s.BerA {
+		s.BerA[i] = uint16(r.Uint64var())
+	}
+	if sr := r.Sub(r.IntUint8()); r.Err == nil {
+		s.BerS = uint32(sr.Uint64var())
+		r.Join(&sr)
+	}
+	if l := r.Intvar() / 8; r.Err == nil {
+		if len(s.SlS) != l {
+			s.SlS = make([]int64, l)
+		}
+		r.Int64sl(s.SlS)
+	}
+	if l := r.IntUint16(); r.Err == nil {
+		if len(s.SlC) != l {
+			s.SlC = make([]float32, l)
+		}
+		r.Float32sl(s.SlC)
+	}
+	if r.Expect("size", r.IntUint32(), 4) {
+		r.Int16sl(s.ArrS[:])
+	}
+	if r.Expect("count", r.Intvar(), 2) {
+		r.Int16sl(s.ArrC[:])
+	}
+	if r.Expect("size", r.IntUint64(), 4) {
+		s.I64 = r.Int32()
+	}
+}
+
+func (s Nums) ITupleWrite(w *marshal.Writer) {
+	w.IntUint32(12)
+	w.Intvar(len(s.Sl) * 4)
+	w.Int32sl(s.Sl)
+	w.Intvar(len(s.Ids) * 4)
+	for i := range s.Ids {
+		w.Uint32(uint32(s.Ids[i]))
+	}
+	w.Intvar(6)
+	w.Uint16sl(s.Arr[:])
+	w.Intvar(marshal.Varsize64(s.Ber))
+	w.Uint64var(s.Ber)
+	w.Intvar(marshal.VarslSize(s.Bers))
+	for i := range s.Bers {
+		w.Uint64var(uint64(s.Bers[i]))
+	}
+	w.Intvar(marshal.VarslSize(s.BerA[:]))
+	for i := range s.BerA {
+		w.Uint64var(uint64(s.BerA[i]))
+	}
+	w.Intvar(marshal.Varsize64(uint64(s.BerS)))
+	w.Uint64var(uint64(s.BerS))
+	w.Intvar(len(s.SlS) * 8)
+	w.Int64sl(s.SlS)
+	w.Intvar(len(s.SlC) * 4)
+	w.Float32sl(s.SlC)
+	w.Intvar(4)
+	w.Int16sl(s.ArrS[:])
+	w.Intvar(4)
+	w.Int16sl(s.ArrC[:])
+	w.Intvar(4)
+	w.Int32(s.I64)
+}
+
+func (s *Nums) ITupleRead(r *marshal.Reader) {
+	n := r.IntUint32()
+	if n <= 0 {
+		return
+	}
+	if l := r.Intvar() / 4; r.Err == nil {
+		if len(s.Sl) != l {
+			s.Sl = make([]int32, l)
+		}
+		r.Int32sl(s.Sl)
+	}
+	if n <= 1 {
+		return
+	}
+	if l := r.Intvar() / 4; r.Err == nil {
+		if len(s.Ids) != l {
+			s.Ids = make([]Id, l)
+		}
+		for i := range s.Ids {
+			s.Ids[i] = Id(r.Uint32())
+		}
+	}
+	if n <= 2 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 6) {
+		r.Uint16sl(s.Arr[:])
+	}
+	if n <= 3 {
+		return
+	}
+	if sr := r.Sub(r.Intvar()); r.Err == nil {
+		s.Ber = sr.Uint64var()
+		r.Join(&sr)
+	}
+	if n <= 4 {
+		return
+	}
+	if sr := r.Sub(r.Intvar()); r.Err == nil {
+		s.Bers = s.Bers[:0]
+		for len(sr.Body) > 0 && sr.Err == nil {
+			s.Bers = append(s.Bers, uint32(sr.Uint64var()))
+		}
+		r.Join(&sr)
+	}
+	if n <= 5 {
+		return
+	}
+	if sr := r.Sub(r.Intvar()); r.Err == nil {
+		for i := range s.BerA {
+			s.BerA[i] = uint16(sr.Uint64var())
+		}
+		r.Join(&sr)
+	}
+	if n <= 6 {
+		return
+	}
+	if sr := r.Sub(r.Intvar()); r.Err == nil {
+		s.BerS = uint32(sr.Uint64var())
+		r.Join(&sr)
+	}
+	if n <= 7 {
+		return
+	}
+	if l := r.Intvar() / 8; r.Err == nil {
+		if len(s.SlS) != l {
+			s.SlS = make([]int64, l)
+		}
+		r.Int64sl(s.SlS)
+	}
+	if n <= 8 {
+		return
+	}
+	if l := r.Intvar() / 4; r.Err == nil {
+		if len(s.SlC) != l {
+			s.SlC = make([]float32, l)
+		}
+		r.Float32sl(s.SlC)
+	}
+	if n <= 9 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 4) {
+		r.Int16sl(s.ArrS[:])
+	}
+	if n <= 10 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 4) {
+		r.Int16sl(s.ArrC[:])
+	}
+	if n <= 11 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 4) {
+		s.I64 = r.Int32()
+	}
+}
+
+func (s Nested) IWrite(w *marshal.Writer) {
+	s.Ints.IWrite(w)
+	if sz := s.Strs.ISize(); sz >= 0 {
+		w.Intvar(sz)
+		s.Strs.IWrite(w)
+	} else {
+		f := s.Strs
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	w.IntUint8(1)
+	s.IntsC.IWrite(w)
+	w.IntUint16(len(s.All))
+	for i := range s.All {
+		s.All[i].IWrite(w)
+	}
+	w.IntUint32(len(s.Some))
+	for i := range s.Some {
+		s.Some[i].IWrite(w)
+	}
+	w.Bytes(s.Tail)
+}
+
+func (s Nested) ISize() int {
+	sz := 0
+	if n := s.Ints.ISize(); n >= 0 {
+		sz += n
+	} else {
+		return -1
+	}
+	if n := s.Strs.ISize(); n >= 0 {
+		sz += marshal.Varsize(n) + n
+	} else {
+		return -1
+	}
+	if n := s.IntsC.ISize(); n >= 0 {
+		sz += 1 + n
+	} else {
+		return -1
+	}
+	if n := marshal.ISizeSl(s.All); n >= 0 {
+		sz += 2 + n
+	} else {
+		return -1
+	}
+	if n := marshal.ISizeSl(s.Some); n >= 0 {
+		sz += 4 + n
+	} else {
+		return -1
+	}
+	sz += len(s.Tail)
+	return sz
+}
+
+func (s *Nested) IRead(r *marshal.Reader) {
+	s.Ints.IRead(r)
+	if sr := r.Sub(r.Intvar()); r.Err == nil {
+		s.Strs.IRead(&sr)
+		r.Join(&sr)
+	}
+	if r.Expect("count", r.IntUint8(), 1) {
+		s.IntsC.IRead(r)
+	}
+	if l := r.IntUint16(); r.Err == nil {
+		if len(s.All) != l {
+			s.All = make([]Ints, l)
+		}
+		for i := range s.All {
+			s.All[i].IRead(r)
+		}
+	}
+	if l := r.IntUint32(); r.Err == nil {
+		if len(s.Some) != l {
+			s.Some = make([]Nums, l)
+		}
+		for i := range s.Some {
+			s.Some[i].IRead(r)
+		}
+	}
+	r.Uint8sl(s.Tail)
+}
+
+func (s *Nested) IReadTail(r *marshal.Reader) {
+	s.Ints.IRead(r)
+	if sr := r.Sub(r.Intvar()); r.Err == nil {
+		s.Strs.IRead(&sr)
+		r.Join(&sr)
+	}
+	if r.Expect("count", r.IntUint8(), 1) {
+		s.IntsC.IRead(r)
+	}
+	if l := r.IntUint16(); r.Err == nil {
+		if len(s.All) != l {
+			s.All = make([]Ints, l)
+		}
+		for i := range s.All {
+			s.All[i].IRead(r)
+		}
+	}
+	if l := r.IntUint32(); r.Err == nil {
+		if len(s.Some) != l {
+			s.Some = make([]Nums, l)
+		}
+		for i := range s.Some {
+			s.Some[i].IRead(r)
+		}
+	}
+	s.Tail = r.Tail()
+}
+
+func (s Nested) ITupleWrite(w *marshal.Writer) {
+	w.IntUint32(6)
+	if sz := s.Ints.ISize(); sz >= 0 {
+		w.Intvar(sz)
+		s.Ints.IWrite(w)
+	} else {
+		f := s.Ints
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	if sz := s.Strs.ISize(); sz >= 0 {
+		w.Intvar(sz)
+		s.Strs.IWrite(w)
+	} else {
+		f := s.Strs
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	if sz := s.IntsC.ISize(); sz >= 0 {
+		w.Intvar(sz)
+		s.IntsC.IWrite(w)
+	} else {
+		f := s.IntsC
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	if sz := marshal.ISizeSl(s.All); sz >= 0 {
+		w.Intvar(sz)
+		for i := range s.All {
+			s.All[i].IWrite(w)
+		}
+	} else {
+		f := s.All
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	if sz := marshal.ISizeSl(s.Some); sz >= 0 {
+		w.Intvar(sz)
+		for i := range s.Some {
+			s.Some[i].IWrite(w)
+		}
+	} else {
+		f := s.Some
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	w.Intvar(len(s.Tail))
+	w.Bytes(s.Tail)
+}
+
+func (s *Nested) ITupleRead(r *marshal.Reader) {
+	n := r.IntUint32()
+	if n <= 0 {
+		return
+	}
+	if sr := r.Sub(r.Intvar()); r.Err == nil {
+		s.Ints.IRead(&sr)
+		r.Join(&sr)
+	}
+	if n <= 1 {
+		return
+	}
+	if sr := r.Sub(r.Intvar()); r.Err == nil {
+		s.Strs.IRead(&sr)
+		r.Join(&sr)
+	}
+	if n <= 2 {
+		return
+	}
+	if sr := r.Sub(r.Intvar()); r.Err == nil {
+		s.IntsC.IRead(&sr)
+		r.Join(&sr)
+	}
+	if n <= 3 {
+		return
+	}
+	if sr := r.Sub(r.Intvar()); r.Err == nil {
+		s.All = s.All[:0]
+		for len(sr.Body) > 0 && sr.Err == nil {
+			s.All = append(s.All, Ints{})
+			s.All[len(s.All)-1].IRead(&sr)
+		}
+		r.Join(&sr)
+	}
+	if n <= 4 {
+		return
+	}
+	if sr := r.Sub(r.Intvar()); r.Err == nil {
+		s.Some = s.Some[:0]
+		for len(sr.Body) > 0 && sr.Err == nil {
+			s.Some = append(s.Some, Nums{})
+			s.Some[len(s.Some)-1].IRead(&sr)
+		}
+		r.Join(&sr)
+	}
+	if n <= 5 {
+		return
+	}
+	s.Tail = r.Slice(r.Intvar())
+}
+
+func (s Sized) IWrite(w *marshal.Writer) {
+	w.Int32(s.Head)
+	if sz := s.Nested.ISize(); sz >= 0 {
+		w.IntUint32(sz)
+		s.Nested.IWrite(w)
+	} else {
+		f := s.Nested
+		w.FieldWithSize(&f, (*marshal.Writer).IntUint32)
+	}
+	s.Last.IWrite(w)
+}
+
+func (s Sized) ISize() int {
+	sz := 4
+	if n := s.Nested.ISize(); n >= 0 {
+		sz += 4 + n
+	} else {
+		return -1
+	}
+	if n := s.Last.ISize(); n >= 0 {
+		sz += n
+	} else {
+		return -1
+	}
+	return sz
+}
+
+func (s *Sized) IRead(r *marshal.Reader) {
+	s.Head = r.Int32()
+	if sr := r.Sub(r.IntUint32()); r.Err == nil {
+		s.Nested.IReadTail(&sr)
+		r.Join(&sr)
+	}
+	s.Last.IRead(r)
+}
+
+func (s *Sized) IReadTail(r *marshal.Reader) {
+	s.Head = r.Int32()
+	if sr := r.Sub(r.IntUint32()); r.Err == nil {
+		s.Nested.IReadTail(&sr)
+		r.Join(&sr)
+	}
+	s.Last.IReadTail(r)
+}
+
+func (s Sized) ITupleWrite(w *marshal.Writer) {
+	w.IntUint32(3)
+	w.Intvar(4)
+	w.Int32(s.Head)
+	if sz := s.Nested.ISize(); sz >= 0 {
+		w.Intvar(sz)
+		s.Nested.IWrite(w)
+	} else {
+		f := s.Nested
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	if sz := s.Last.ISize(); sz >= 0 {
+		w.Intvar(sz)
+		s.Last.IWrite(w)
+	} else {
+		f := s.Last
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+}
+
+func (s *Sized) ITupleRead(r *marshal.Reader) {
+	n := r.IntUint32()
+	if n <= 0 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 4) {
+		s.Head = r.Int32()
+	}
+	if n <= 1 {
+		return
+	}
+	if sr := r.Sub(r.Intvar()); r.Err == nil {
+		s.Nested.IReadTail(&sr)
+		r.Join(&sr)
+	}
+	if n <= 2 {
+		return
+	}
+	if sr := r.Sub(r.Intvar()); r.Err == nil {
+		s.Last.IReadTail(&sr)
+		r.Join(&sr)
+	}
+}
+
+func (s Tuple) IWrite(w *marshal.Writer) {
+	w.Uint32(uint32(s.Id))
+	w.IntUint32(len(s.Name))
+	w.String(s.Name)
+	w.Uint64var(uint64(s.Flags))
+	s.Ints.IWrite(w)
+	{
+		f := s.Tags
+		w.FieldAuto(&f)
+	}
+}
+
+func (s Tuple) ISize() int {
+	return -1
+}
+
+func (s *Tuple) IRead(r *marshal.Reader) {
+	s.Id = Id(r.Uint32())
+	s.Name = r.String(r.IntUint32())
+	s.Flags = uint32(r.Uint64var())
+	s.Ints.IRead(r)
+	r.FieldAuto(&s.Tags)
+}
+
+func (s Tuple) ITupleWrite(w *marshal.Writer) {
+	w.IntUint32(4 + len(s.Tags))
+	w.Intvar(4)
+	w.Uint32(uint32(s.Id))
+	w.Intvar(len(s.Name))
+	w.String(s.Name)
+	w.Intvar(marshal.Varsize64(uint64(s.Flags)))
+	w.Uint64var(uint64(s.Flags))
+	if sz := s.Ints.ISize(); sz >= 0 {
+		w.Intvar(sz)
+		s.Ints.IWrite(w)
+	} else {
+		f := s.Ints
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	for j := range s.Tags {
+		w.Intvar(len(s.Tags[j]))
+		w.String(s.Tags[j])
+	}
+}
+
+func (s *Tuple) ITupleRead(r *marshal.Reader) {
+	n := r.IntUint32()
+	if n <= 0 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 4) {
+		s.Id = Id(r.Uint32())
+	}
+	if n <= 1 {
+		return
+	}
+	s.Name = r.String(r.Intvar())
+	if n <= 2 {
+		return
+	}
+	if sr := r.Sub(r.Intvar()); r.Err == nil {
+		s.Flags = uint32(sr.Uint64var())
+		r.Join(&sr)
+	}
+	if n <= 3 {
+		return
+	}
+	if sr := r.Sub(r.Intvar()); r.Err == nil {
+		s.Ints.IRead(&sr)
+		r.Join(&sr)
+	}
+	if n < 4 {
+		return
+	}
+	if l := n - 4; len(s.Tags) != l {
+		s.Tags = make([]string, l)
+	}
+	for j := range s.Tags {
+		s.Tags[j] = r.String(r.Intvar())
+	}
+}
+
+func (s Split) IWrite(w *marshal.Writer) {
+	w.Int32(s.Id)
+	{
+		f := s.Pairs
+		w.FieldAuto(&f)
+	}
+}
+
+func (s Split) ISize() int {
+	return -1
+}
+
+func (s *Split) IRead(r *marshal.Reader) {
+	s.Id = r.Int32()
+	r.FieldAuto(&s.Pairs)
+}
+
+func (s Split) ITupleWrite(w *marshal.Writer) {
+	w.IntUint32(1 + len(s.Pairs)*2)
+	w.Intvar(4)
+	w.Int32(s.Id)
+	for j := range s.Pairs {
+		w.Intvar(len(s.Pairs[j].Key))
+		w.String(s.Pairs[j].Key)
+		w.Intvar(8)
+		w.Int64(s.Pairs[j].Val)
+	}
+}
+
+func (s *Split) ITupleRead(r *marshal.Reader) {
+	n := r.IntUint32()
+	if n <= 0 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 4) {
+		s.Id = r.Int32()
+	}
+	if n < 1 {
+		return
+	}
+	if l := (n - 1) / 2; len(s.Pairs) != l {
+		s.Pairs = make([]Pair, l)
+	}
+	for j := range s.Pairs {
+		s.Pairs[j].Key = r.String(r.Intvar())
+		if r.Expect("size", r.Intvar(), 8) {
+			s.Pairs[j].Val = r.Int64()
+		}
+	}
+}
+
+func (s Loose) IWrite(w *marshal.Writer) {
+	{
+		f := s.P
+		w.FieldAuto(&f)
+	}
+	{
+		f := s.Ps
+		w.FieldAuto(&f)
+	}
+	{
+		f := s.Any
+		w.FieldAuto(&f)
+	}
+	{
+		f := s.Pc
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	{
+		f := s.Vs
+		w.FieldAuto(&f)
+	}
+}
+
+func (s Loose) ISize() int {
+	return -1
+}
+
+func (s *Loose) IRead(r *marshal.Reader) {
+	r.FieldAuto(&s.P)
+	r.FieldAuto(&s.Ps)
+	r.FieldAuto(&s.Any)
+	r.FieldWithSize(&s.Pc, (*marshal.Reader).Intvar)
+	r.FieldAuto(&s.Vs)
+}
+
+func (s Loose) ITupleWrite(w *marshal.Writer) {
+	w.IntUint32(5)
+	{
+		f := s.P
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	{
+		f := s.Ps
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	{
+		f := s.Any
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	{
+		f := s.Pc
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	{
+		f := s.Vs
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+}
+
+func (s *Loose) ITupleRead(r *marshal.Reader) {
+	n := r.IntUint32()
+	if n <= 0 {
+		return
+	}
+	r.FieldWithSize(&s.P, (*marshal.Reader).Intvar)
+	if n <= 1 {
+		return
+	}
+	r.FieldWithSize(&s.Ps, (*marshal.Reader).Intvar)
+	if n <= 2 {
+		return
+	}
+	r.FieldWithSize(&s.Any, (*marshal.Reader).Intvar)
+	if n <= 3 {
+		return
+	}
+	r.FieldWithSize(&s.Pc, (*marshal.Reader).Intvar)
+	if n <= 4 {
+		return
+	}
+	r.FieldWithSize(&s.Vs, (*marshal.Reader).Intvar)
+}
+
+func (s Times) IWrite(w *marshal.Writer) {
+	w.Bool(s.On)
+	w.Bool(bool(s.Flag))
+	w.IntUint8(len(s.Flags))
+	for i := range s.Flags {
+		w.Bool(s.Flags[i])
+	}
+	for i := range s.Fl {
+		w.Bool(bool(s.Fl[i]))
+	}
+	w.Int64(marshal.TimeInt(s.T, marshal.TimeEpoch))
+	w.Int64(marshal.TimeInt(s.Ts, marshal.TimeSec))
+	w.IntUint8(8)
+	w.Int64(marshal.TimeInt(s.Tm, marshal.TimeMs))
+	w.Int64(int64(s.D))
+	w.Int64(marshal.DurationInt(s.Ds, marshal.TimeSec))
+}
+
+func (s Times) ISize() int {
+	sz := 46
+	sz += len(s.Flags)
+	return sz
+}
+
+func (s *Times) IRead(r *marshal.Reader) {
+	s.On = r.Bool()
+	s.Flag = Flag(r.Bool())
+	if l := r.IntUint8(); r.Err == nil {
+		if len(s.Flags) != l {
+			s.Flags = make([]bool, l)
+		}
+		for i := range s.Flags {
+			s.Flags[i] = r.Bool()
+		}
+	}
+	for i := range s.Fl {
+		s.Fl[i] = Flag(r.Bool())
+	}
+	s.T = marshal.IntTime(r.Int64(), marshal.TimeEpoch)
+	s.Ts = marshal.IntTime(r.Int64(), marshal.TimeSec)
+	if r.Expect("size", r.IntUint8(), 8) {
+		s.Tm = marshal.IntTime(r.Int64(), marshal.TimeMs)
+	}
+	s.D = time.Duration(r.Int64())
+	s.Ds = marshal.IntDuration(r.Int64(), marshal.TimeSec)
+}
+
+func (s Times) ITupleWrite(w *marshal.Writer) {
+	w.IntUint32(9)
+	w.Intvar(1)
+	w.Bool(s.On)
+	w.Intvar(1)
+	w.Bool(bool(s.Flag))
+	w.Intvar(len(s.Flags))
+	for i := range s.Flags {
+		w.Bool(s.Flags[i])
+	}
+	w.Intvar(2)
+	for i := range s.Fl {
+		w.Bool(bool(s.Fl[i]))
+	}
+	w.Intvar(8)
+	w.Int64(marshal.TimeInt(s.T, marshal.TimeEpoch))
+	w.Intvar(8)
+	w.Int64(marshal.TimeInt(s.Ts, marshal.TimeSec))
+	w.Intvar(8)
+	w.Int64(marshal.TimeInt(s.Tm, marshal.TimeMs))
+	w.Intvar(8)
+	w.Int64(int64(s.D))
+	w.Intvar(8)
+	w.Int64(marshal.DurationInt(s.Ds, marshal.TimeSec))
+}
+
+func (s *Times) ITupleRead(r *marshal.Reader) {
+	n := r.IntUint32()
+	if n <= 0 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 1) {
+		s.On = r.Bool()
+	}
+	if n <= 1 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 1) {
+		s.Flag = Flag(r.Bool())
+	}
+	if n <= 2 {
+		return
+	}
+	if l := r.Intvar(); r.Err == nil {
+		if len(s.Flags) != l {
+			s.Flags = make([]bool, l)
+		}
+		for i := range s.Flags {
+			s.Flags[i] = r.Bool()
+		}
+	}
+	if n <= 3 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 2) {
+		for i := range s.Fl {
+			s.Fl[i] = Flag(r.Bool())
+		}
+	}
+	if n <= 4 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 8) {
+		s.T = marshal.IntTime(r.Int64(), marshal.TimeEpoch)
+	}
+	if n <= 5 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 8) {
+		s.Ts = marshal.IntTime(r.Int64(), marshal.TimeSec)
+	}
+	if n <= 6 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 8) {
+		s.Tm = marshal.IntTime(r.Int64(), marshal.TimeMs)
+	}
+	if n <= 7 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 8) {
+		s.D = time.Duration(r.Int64())
+	}
+	if n <= 8 {
+		return
+	}
+	if r.Expect("size", r.Intvar(), 8) {
+		s.Ds = marshal.IntDuration(r.Int64(), marshal.TimeSec)
+	}
+}
+
+func (s Opts) IWrite(w *marshal.Writer) {
+	{
+		f := s.M
+		w.FieldWithCount(&f, (*marshal.Writer).IntUint16)
+	}
+	if s.P == nil {
+		w.Bool(false)
+	} else {
+		w.Bool(true)
+		{
+			f := s.P
+			w.FieldAuto(&f)
+		}
+	}
+	if s.Pn == nil {
+		w.Bool(false)
+	} else {
+		w.Bool(true)
+		{
+			f := s.Pn
+			w.FieldAuto(&f)
+		}
+	}
+	if s.Pz == nil {
+		w.Bool(false)
+	} else {
+		w.Bool(true)
+		{
+			f := s.Pz
+			w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+		}
+	}
+	{
+		f := s.Ts
+		w.FieldAuto(&f)
+	}
+}
+
+func (s Opts) ISize() int {
+	return -1
+}
+
+func (s *Opts) IRead(r *marshal.Reader) {
+	r.FieldWithCount(&s.M, (*marshal.Reader).IntUint16)
+	if r.Bool() {
+		if s.P == nil {
+			s.P = new(int32)
+		}
+		r.FieldAuto(&s.P)
+	} else if r.Err == nil {
+		s.P = nil
+	}
+	if r.Bool() {
+		if s.Pn == nil {
+			s.Pn = new(Ints)
+		}
+		r.FieldAuto(&s.Pn)
+	} else if r.Err == nil {
+		s.Pn = nil
+	}
+	if r.Bool() {
+		if s.Pz == nil {
+			s.Pz = new(Name)
+		}
+		r.FieldWithSize(&s.Pz, (*marshal.Reader).Intvar)
+	} else if r.Err == nil {
+		s.Pz = nil
+	}
+	r.FieldAuto(&s.Ts)
+}
+
+func (s Opts) ITupleWrite(w *marshal.Writer) {
+	w.IntUint32(5)
+	{
+		f := s.M
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	if s.P == nil {
+		w.Intvar(0)
+	} else {
+		f := s.P
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	if s.Pn == nil {
+		w.Intvar(0)
+	} else {
+		f := s.Pn
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	if s.Pz == nil {
+		w.Intvar(0)
+	} else {
+		f := s.Pz
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+	{
+		f := s.Ts
+		w.FieldWithSize(&f, (*marshal.Writer).Intvar)
+	}
+}
+
+func (s *Opts) ITupleRead(r *marshal.Reader) {
+	n := r.IntUint32()
+	if n <= 0 {
+		return
+	}
+	r.FieldWithSize(&s.M, (*marshal.Reader).Intvar)
+	if n <= 1 {
+		return
+	}
+	if sz := r.Intvar(); sz > 0 {
+		if s.P == nil {
+			s.P = new(int32)
+		}
+		if sr := r.Sub(sz); r.Err == nil {
+			sr.FieldTail(&s.P)
+			r.Join(&sr)
+		}
+	} else if r.Err == nil {
+		s.P = nil
+	}
+	if n <= 2 {
+		return
+	}
+	if sz := r.Intvar(); sz > 0 {
+		if s.Pn == nil {
+			s.Pn = new(Ints)
+		}
+		if sr := r.Sub(sz); r.Err == nil {
+			sr.FieldTail(&s.Pn)
+			r.Join(&sr)
+		}
+	} else if r.Err == nil {
+		s.Pn = nil
+	}
+	if n <= 3 {
+		return
+	}
+	if sz := r.Intvar(); sz > 0 {
+		if s.Pz == nil {
+			s.Pz = new(Name)
+		}
+		if sr := r.Sub(sz); r.Err == nil {
+			sr.FieldTail(&s.Pz)
+			r.Join(&sr)
+		}
+	} else if r.Err == nil {
+		s.Pz = nil
+	}
+	if n <= 4 {
+		return
+	}
+	r.FieldWithSize(&s.Ts, (*marshal.Reader).Intvar)
+}
@@ -0,0 +1,120 @@
+// Package gentest holds types with methods generated by iprotogen,
+// and checks them against reflective marshal and sbox encoding.
+package gentest
+
+import "time"
+
+//go:generate go run github.com/funny-falcon/go-iproto/marshal/iprotogen -type=Ints,Strs,Nums,Nested,Sized,Tuple,Split,Loose,Times,Opts
+
+type Id uint32
+
+type Name string
+
+type Octet uint8
+
+type Ints struct {
+	I8  int8
+	I16 int16
+	I32 int32
+	I64 int64
+	U8  uint8
+	U16 uint16
+	U32 uint32
+	U64 uint64
+	F32 float32
+	F64 float64
+	Id  Id
+}
+
+type Strs struct {
+	S     string
+	N     Name
+	B     []byte
+	O     []Octet
+	SB    string `iproto:"size(ber)"`
+	BI16  []byte `iproto:"size(i16)"`
+	NC8   Name   `iproto:"cnt(i8)"`
+	Empty [0]byte
+	skip  int32
+	Skip  int32 `iproto:"skip"`
+}
+
+type Nums struct {
+	Sl   []int32
+	Ids  []Id
+	Arr  [3]uint16
+	Ber  uint64    `iproto:"ber"`
+	Bers []uint32  `iproto:"ber"`
+	BerA [2]uint16 `iproto:"ber"`
+	BerS uint32    `iproto:"size(i8),ber"`
+	SlS  []int64   `iproto:"size(ber)"`
+	SlC  []float32 `iproto:"cnt(i16)"`
+	ArrS [2]int16  `iproto:"size(i32)"`
+	ArrC [2]int16  `iproto:"cnt(ber)"`
+	I64  int32     `iproto:"size(i64)"`
+}
+
+type Nested struct {
+	Ints  Ints
+	Strs  Strs   `iproto:"size(ber)"`
+	IntsC Ints   `iproto:"cnt(i8)"`
+	All   []Ints `iproto:"cnt(i16)"`
+	Some  []Nums
+	Tail  []byte `iproto:"size(no)"`
+}
+
+type Sized struct {
+	Head   int32
+	Nested Nested `iproto:"size(i32)"`
+	Last   Nested `iproto:"size(no)"`
+}
+
+type Tuple struct {
+	Id    Id
+	Name  string
+	Flags uint32 `iproto:"ber"`
+	Ints  Ints
+	Tags  []string `sbox:"tail"`
+}
+
+type Pair struct {
+	Key string
+	Val int64
+}
+
+type Split struct {
+	Id    int32
+	Pairs []Pair `sbox:"tailsplit"`
+}
+
+// Loose has fields generated code encodes with reflection
+type Loose struct {
+	P   *int32
+	Ps  []*Ints
+	Any interface{}
+	Pc  *Nums `iproto:"size(ber)"`
+	Vs  [2]string
+}
+
+type Flag bool
+
+type Times struct {
+	On    bool
+	Flag  Flag
+	Flags []bool `iproto:"cnt(i8)"`
+	Fl    [2]Flag
+	T     time.Time
+	Ts    time.Time `iproto:"time(sec)"`
+	Tm    time.Time `iproto:"time(ms),size(i8)"`
+	D     time.Duration
+	Ds    time.Duration `iproto:"time(sec)"`
+}
+
+// Opts has maps and optional pointers, which are encoded with reflection
+type Opts struct {
+	M  map[string]int32 `iproto:"cnt(i16)"`
+	P  *int32           `iproto:"opt"`
+	Pn *Ints            `iproto:"opt"`
+	Pz *Name            `iproto:"opt,size(ber)"`
+	Ts []time.Time
+}
@@ -0,0 +1,65 @@
+// Iprotogen generates reflection free marshal methods for struct types.
+//
+// For every named struct it writes IWrite and ISize methods for marshal.Writer,
+// IRead (and IReadTail when last field is marked size(no) or cnt(no)) for marshal.Reader,
+// and ITupleWrite, ITupleRead for sbox tuples. Fields are encoded exactly as reflective
+// marshal and sbox code does it, honoring `iproto` and `sbox` struct tags.
+// Fields of types it doesn't know statically (pointers, maps, interfaces, foreign structs)
+// are still encoded with reflection.
+//
+// Usage:
+//
+//	//go:generate go run github.com/funny-falcon/go-iproto/marshal/iprotogen -type=User,Session
+//
+// Output is written to <first type>_iproto.go in the package directory, unless -output is set.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of struct type names; must be set")
+	output    = flag.String("output", "", "output file name; default srcdir/<type>_iproto.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of iprotogen:\n")
+	fmt.Fprintf(os.Stderr, "\tiprotogen -type T [directory]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("iprotogen: ")
+	flag.Usage = usage
+	flag.Parse()
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	names := strings.Split(*typeNames, ",")
+
+	dir := "."
+	if args := flag.Args(); len(args) > 0 {
+		dir = args[0]
+	}
+
+	out := *output
+	if out == "" {
+		out = filepath.Join(dir, strings.ToLower(names[0])+"_iproto.go")
+	}
+
+	src, err := Generate(dir, names, filepath.Base(out))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = os.WriteFile(out, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 )
 
 var _ = fmt.Printf
@@ -85,6 +86,11 @@ type SInts11 struct {
 	U64sbb uint64 `iproto:"size(ber),ber"`
 }
 
+type SInts12 struct {
+	A int32    `iproto:"size(i64)"`
+	B []uint16 `iproto:"cnt(i64)"`
+}
+
 type SArr1 struct {
 	Ua1 [2]uint32
 	Ua2 [2]uint32 `iproto:"size(ber)"`
@@ -95,6 +101,10 @@ type SArr1 struct {
 	Ua7 [2]uint32 `iproto:"cnt(ber),ber"`
 }
 
+type SArr2 struct {
+	A [2]uint32 `iproto:"ber"`
+}
+
 type SSlice1 struct {
 	Ua1 []uint32
 	Ua2 []uint32 `iproto:"size(ber)"`
@@ -105,6 +115,26 @@ type SSlice1 struct {
 	Ua7 []uint32 `iproto:"cnt(ber),ber"`
 }
 
+type STail1 struct {
+	A uint8
+	B []uint16 `iproto:"size(no)"`
+}
+
+// STail2 reads its tail itself
+type STail2 struct {
+	A    uint8
+	Rest []byte
+}
+
+func (s *STail2) IRead(r *Reader) {
+	s.A = r.Uint8()
+}
+
+func (s *STail2) IReadTail(r *Reader) {
+	s.IRead(r)
+	s.Rest = r.Tail()
+}
+
 type SByte1 struct {
 	A byte
 	B []byte
@@ -128,6 +158,23 @@ type SStruct1 struct {
 	B []SS2 `iproto:"cnt(i16)"`
 }
 
+type SStruct2 struct {
+	A [2]uint16 `iproto:"cnt(i8)"`
+}
+
+type SStruct3 struct {
+	A SStruct2 `iproto:"size(i8)"`
+}
+
+type SStruct4 struct {
+	A uint32
+	B SOwn1
+}
+
+type SStruct5 struct {
+	A SStruct4 `iproto:"size(i8)"`
+}
+
 type SIFace1 struct {
 	A interface{}   `iproto:"cnt(i16)"`
 	B []interface{} `iproto:"cnt(i16)"`
@@ -137,6 +184,61 @@ type SIFace2 struct {
 	A interface{} `iproto:"size(ber)"`
 }
 
+type SBool1 struct {
+	A bool
+	B []bool `iproto:"cnt(i8)"`
+}
+
+type SMap1 struct {
+	A map[string]int16
+	B map[uint8]SS1    `iproto:"cnt(i8)"`
+	C map[int32][]byte `iproto:"size(ber)"`
+}
+
+type STime1 struct {
+	A time.Time
+	B time.Time `iproto:"time(sec)"`
+	C time.Time `iproto:"time(ms)"`
+	D time.Duration
+	E time.Duration `iproto:"time(sec)"`
+	F time.Duration `iproto:"time(ms)"`
+}
+
+type SOpt1 struct {
+	A *int32  `iproto:"opt"`
+	B *SS1    `iproto:"opt"`
+	C *string `iproto:"opt,size(i8)"`
+}
+
+var optI32, optStr = int32(5), "ab"
+
+// SCnt1 writes itself, and knows count of its elements
+type SCnt1 struct {
+	A []uint16
+}
+
+func (s SCnt1) IWrite(w *Writer) {
+	w.Uint16sl(s.A)
+}
+
+func (s SCnt1) ICount() int {
+	return len(s.A)
+}
+
+// SOwn1 writes itself, but doesn't know its count
+type SOwn1 struct {
+	A uint16
+}
+
+func (s SOwn1) IWrite(w *Writer) {
+	w.Uint16(s.A)
+}
+
+type SCnt2 struct {
+	A SCnt1
+	B SOwn1 `iproto:"cnt(i8)"`
+}
+
 type Should struct {
 	v interface{}
 	m []byte
@@ -194,6 +296,58 @@ var shoulds = [...]Should{
 		}},
 	{SString1{A: "asdf"}, []byte{4, 0, 0, 0, 'a', 's', 'd', 'f'}},
 	{SByte1{A: 1, B: []byte{1, 2, 3, 4}, C: []int8{2, 3}}, []byte{1, 4, 0, 0, 0, 1, 2, 3, 4, 2, 2, 3}},
+	{true, []byte{1}},
+	{SBool1{A: true, B: []bool{false, true}}, []byte{1, 2, 0, 1}},
+	{map[string]int16{"a": 1}, []byte{1, 0, 0, 0, 1, 0, 0, 0, 'a', 1, 0}},
+	{SMap1{A: map[string]int16{"b": 2, "a": 1}, B: map[uint8]SS1{7: {1, 2}}, C: map[int32][]byte{3: {9}}},
+		[]byte{
+			2, 0, 0, 0, 1, 0, 0, 0, 'a', 1, 0, 1, 0, 0, 0, 'b', 2, 0,
+			1, 7, 1, 0, 0, 0, 2, 0,
+			9, 3, 0, 0, 0, 1, 0, 0, 0, 9,
+		}},
+	{STime1{
+		A: time.Date(2010, time.January, 1, 0, 0, 1, 0, time.UTC),
+		B: time.Unix(1500000000, 0).UTC(),
+		C: time.UnixMilli(1500000000123).UTC(),
+		D: 1500 * time.Millisecond,
+		E: 3 * time.Second,
+		F: 1500 * time.Millisecond,
+	},
+		[]byte{
+			0x00, 0xca, 0x9a, 0x3b, 0, 0, 0, 0,
+			0x00, 0x2f, 0x68, 0x59, 0, 0, 0, 0,
+			0x7b, 0x98, 0xf7, 0x3e, 0x5d, 0x01, 0, 0,
+			0x00, 0x2f, 0x68, 0x59, 0, 0, 0, 0,
+			3, 0, 0, 0, 0, 0, 0, 0,
+			0xdc, 0x05, 0, 0, 0, 0, 0, 0,
+		}},
+	{STime1{}, make([]byte, 48)},
+	{SOpt1{A: &optI32, C: &optStr}, []byte{1, 5, 0, 0, 0, 0, 1, 2, 'a', 'b'}},
+	{SOpt1{B: &SS1{1, 2}}, []byte{0, 1, 1, 0, 0, 0, 2, 0, 0}},
+	{SInts11{127}, []byte{1, 127}},
+	{SInts11{128}, []byte{2, 0x81, 0x00}},
+	{SInts11{1 << 14}, []byte{3, 0x81, 0x80, 0x00}},
+	{SStruct3{SStruct2{[2]uint16{1, 2}}}, []byte{5, 2, 1, 0, 2, 0}},
+	{SArr2{[2]uint32{1, 128}}, []byte{1, 0x81, 0x00}},
+	{SInts12{A: 1, B: []uint16{2}}, []byte{4, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2, 0}},
+}
+
+func TestVarsize(t *testing.T) {
+	w := &Writer{}
+	for _, i := range []int{0, 127, 128, 129, 1<<14 - 1, 1 << 14, 1 << 21, 1<<28 + 5} {
+		w.Intvar(i)
+		if n := len(w.Written()); Varsize(i) != n || Varsize64(uint64(i)) != n {
+			t.Errorf("Varsize(%d) = %d, Varsize64 = %d, written %d", i, Varsize(i), Varsize64(uint64(i)), n)
+		}
+		w.Reset()
+	}
+}
+
+func TestEncodeCounted(t *testing.T) {
+	// struct which knows its count is prefixed with it,
+	// struct without ICount is counted as single element
+	s := SCnt2{A: SCnt1{A: []uint16{1, 2}}, B: SOwn1{3}}
+	should_write(t, s, []byte{2, 0, 0, 0, 1, 0, 2, 0, 1, 3, 0})
 }
 
 func should_write(t *testing.T, v interface{}, should []byte) {
@@ -307,3 +461,56 @@ func BenchmarkDecode(b *testing.B) {
 		}
 	}
 }
+
+func TestEncodeUnknownSize(t *testing.T) {
+	// SOwn1 doesn't know its size, so SStruct4 has no static size
+	s := SStruct5{SStruct4{A: 1, B: SOwn1{2}}}
+	should_write(t, s, []byte{6, 1, 0, 0, 0, 2, 0})
+}
+
+func TestDecodeTail(t *testing.T) {
+	var s STail1
+	if err := ReadTail([]byte{1, 2, 0, 3, 0}, &s); err != nil {
+		t.Fatal(err)
+	}
+	if should := (STail1{1, []uint16{2, 3}}); !reflect.DeepEqual(s, should) {
+		t.Errorf("Doesn't match %#v\nshould: %#v", s, should)
+	}
+}
+
+func TestDecodeReadTailer(t *testing.T) {
+	var s STail2
+	if err := ReadTail([]byte{1, 2, 3}, &s); err != nil {
+		t.Fatal(err)
+	}
+	if should := (STail2{1, []byte{2, 3}}); !reflect.DeepEqual(s, should) {
+		t.Errorf("Doesn't match %#v\nshould: %#v", s, should)
+	}
+}
+
+// SNil1 writes itself even through nil pointer
+type SNil1 struct {
+	A uint16
+}
+
+func (s *SNil1) IWrite(w *Writer) {
+	if s == nil {
+		w.Uint8(0)
+		return
+	}
+	w.Uint8(1)
+	w.Uint16(s.A)
+}
+
+type SNil2 struct {
+	A *SNil1
+	B *SNil1
+	C []*SOwn1
+}
+
+func TestEncodePtrMethods(t *testing.T) {
+	// pointer type with own methods is written by them, even if it is nil,
+	// pointer to type with value methods is written by element's methods
+	s := SNil2{B: &SNil1{2}, C: []*SOwn1{{3}, {4}}}
+	should_write(t, s, []byte{0, 1, 2, 0, 2, 0, 0, 0, 3, 0, 4, 0})
+}
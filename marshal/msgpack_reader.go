@@ -0,0 +1,632 @@
+package marshal
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"sync"
+)
+
+// MsgpackReader reads values in MessagePack format.
+// Structs are read from arrays of fields in order or from maps of field names,
+// whatever is in data.
+type MsgpackReader struct {
+	*Reader
+}
+
+var msgpackReaderPool = sync.Pool{
+	New: func() interface{} {
+		return &MsgpackReader{&Reader{}}
+	},
+}
+
+func MsgpackRead(b []byte, i interface{}) (err error) {
+	r := msgpackReaderPool.Get().(*MsgpackReader)
+	r.Body = b
+	err = r.Decode(i)
+	*r.Reader = Reader{}
+	msgpackReaderPool.Put(r)
+	return err
+}
+
+var errMsgpackShort = errors.New("iproto.MsgpackReader: not enough data")
+
+func (r *MsgpackReader) fail(format string, args ...interface{}) {
+	if r.Err == nil {
+		r.Err = fmt.Errorf("iproto.MsgpackReader: "+format, args...)
+	}
+}
+
+// Peek returns code of next value without reading it
+func (r *MsgpackReader) Peek() byte {
+	if r.Err != nil {
+		return 0
+	}
+	if len(r.Body) == 0 {
+		r.Err = errMsgpackShort
+		return 0
+	}
+	return r.Body[0]
+}
+
+func (r *MsgpackReader) take(n int) (res []byte) {
+	if r.Err != nil {
+		return
+	}
+	if n < 0 || len(r.Body) < n {
+		r.Err = errMsgpackShort
+		return
+	}
+	res = r.Body[:n]
+	r.Body = r.Body[n:]
+	return
+}
+
+// uint reads big endian unsigned integer of n bytes
+func (r *MsgpackReader) uint(n int) uint64 {
+	p := r.take(n)
+	switch len(p) {
+	case 1:
+		return uint64(p[0])
+	case 2:
+		return uint64(be.Uint16(p))
+	case 4:
+		return uint64(be.Uint32(p))
+	case 8:
+		return be.Uint64(p)
+	}
+	return 0
+}
+
+// IsNil reads nil and returns true, if next value is nil
+func (r *MsgpackReader) IsNil() bool {
+	if r.Peek() == 0xc0 {
+		r.Body = r.Body[1:]
+		return true
+	}
+	return false
+}
+
+func (r *MsgpackReader) Bool() bool {
+	switch c := r.Uint8(); c {
+	case 0xc2:
+		return false
+	case 0xc3:
+		return true
+	default:
+		r.fail("expected bool, got %#x", c)
+	}
+	return false
+}
+
+// number reads any integer or float, exactly one of results is meaningful
+func (r *MsgpackReader) number() (u uint64, i int64, f float64, kind reflect.Kind) {
+	c := r.Uint8()
+	switch {
+	case r.Err != nil:
+		return
+	case c < 0x80:
+		return uint64(c), 0, 0, reflect.Uint64
+	case c >= 0xe0:
+		return 0, int64(int8(c)), 0, reflect.Int64
+	}
+	switch c {
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return r.uint(1 << (c - 0xcc)), 0, 0, reflect.Uint64
+	case 0xd0:
+		i = int64(int8(r.uint(1)))
+	case 0xd1:
+		i = int64(int16(r.uint(2)))
+	case 0xd2:
+		i = int64(int32(r.uint(4)))
+	case 0xd3:
+		i = int64(r.uint(8))
+	case 0xca:
+		return 0, 0, float64(math.Float32frombits(uint32(r.uint(4)))), reflect.Float32
+	case 0xcb:
+		return 0, 0, math.Float64frombits(r.uint(8)), reflect.Float64
+	default:
+		r.fail("expected number, got %#x", c)
+		return
+	}
+	if i >= 0 {
+		return uint64(i), 0, 0, reflect.Uint64
+	}
+	return 0, i, 0, reflect.Int64
+}
+
+func (r *MsgpackReader) Int() int64 {
+	u, i, _, kind := r.number()
+	switch kind {
+	case reflect.Uint64:
+		if u > math.MaxInt64 {
+			r.fail("%d overflows int64", u)
+		}
+		return int64(u)
+	case reflect.Int64:
+		return i
+	case reflect.Float32, reflect.Float64:
+		r.fail("expected integer, got float")
+	}
+	return 0
+}
+
+func (r *MsgpackReader) Uint() uint64 {
+	u, i, _, kind := r.number()
+	switch kind {
+	case reflect.Uint64:
+		return u
+	case reflect.Int64:
+		r.fail("expected unsigned integer, got %d", i)
+	case reflect.Float32, reflect.Float64:
+		r.fail("expected integer, got float")
+	}
+	return 0
+}
+
+// Float reads float or integer
+func (r *MsgpackReader) Float() float64 {
+	u, i, f, kind := r.number()
+	switch kind {
+	case reflect.Uint64:
+		return float64(u)
+	case reflect.Int64:
+		return float64(i)
+	}
+	return f
+}
+
+// strBin reads length of string or binary
+func (r *MsgpackReader) strBin() int {
+	c := r.Uint8()
+	switch {
+	case r.Err != nil:
+		return 0
+	case c&0xe0 == 0xa0:
+		return int(c & 0x1f)
+	case c >= 0xd9 && c <= 0xdb:
+		return int(r.uint(1 << (c - 0xd9)))
+	case c >= 0xc4 && c <= 0xc6:
+		return int(r.uint(1 << (c - 0xc4)))
+	}
+	r.fail("expected string or binary, got %#x", c)
+	return 0
+}
+
+// Str reads string or binary as string
+func (r *MsgpackReader) Str() string {
+	return string(r.take(r.strBin()))
+}
+
+// Bin reads binary or string, result refers to Body
+func (r *MsgpackReader) Bin() []byte {
+	return r.take(r.strBin())
+}
+
+func (r *MsgpackReader) ArrayHeader() int {
+	c := r.Uint8()
+	switch {
+	case r.Err != nil:
+		return 0
+	case c&0xf0 == 0x90:
+		return int(c & 0x0f)
+	case c == 0xdc || c == 0xdd:
+		return r.count(2 << (c - 0xdc))
+	}
+	r.fail("expected array, got %#x", c)
+	return 0
+}
+
+func (r *MsgpackReader) MapHeader() int {
+	c := r.Uint8()
+	switch {
+	case r.Err != nil:
+		return 0
+	case c&0xf0 == 0x80:
+		return int(c & 0x0f)
+	case c == 0xde || c == 0xdf:
+		return r.count(2 << (c - 0xde))
+	}
+	r.fail("expected map, got %#x", c)
+	return 0
+}
+
+// count reads number of elements, each element takes at least one byte
+func (r *MsgpackReader) count(n int) int {
+	cnt := int(r.uint(n))
+	if cnt > len(r.Body) {
+		r.Err = errMsgpackShort
+		return 0
+	}
+	return cnt
+}
+
+func (r *MsgpackReader) Ext() (e Ext) {
+	c := r.Uint8()
+	var n int
+	switch {
+	case r.Err != nil:
+		return
+	case c >= 0xd4 && c <= 0xd8:
+		n = 1 << (c - 0xd4)
+	case c >= 0xc7 && c <= 0xc9:
+		n = int(r.uint(1 << (c - 0xc7)))
+	default:
+		r.fail("expected ext, got %#x", c)
+		return
+	}
+	e.Type = r.Int8()
+	e.Data = r.take(n)
+	return
+}
+
+// Skip skips next value
+func (r *MsgpackReader) Skip() {
+	c := r.Peek()
+	switch {
+	case r.Err != nil:
+	case c&0xf0 == 0x90 || c == 0xdc || c == 0xdd:
+		for n := r.ArrayHeader(); n > 0 && r.Err == nil; n-- {
+			r.Skip()
+		}
+	case c&0xf0 == 0x80 || c == 0xde || c == 0xdf:
+		for n := r.MapHeader(); n > 0 && r.Err == nil; n-- {
+			r.Skip()
+			r.Skip()
+		}
+	default:
+		r.Any()
+	}
+}
+
+// Any reads value of any type: integers are read as uint64 for non-negative and int64 for negative,
+// arrays as []interface{}, maps as map[interface{}]interface{}, and extensions as Ext
+func (r *MsgpackReader) Any() interface{} {
+	c := r.Peek()
+	switch {
+	case r.Err != nil:
+		return nil
+	case c <= 0x7f || c >= 0xe0 || (c >= 0xca && c <= 0xd3):
+		u, i, f, kind := r.number()
+		switch kind {
+		case reflect.Uint64:
+			return u
+		case reflect.Int64:
+			return i
+		case reflect.Float32:
+			return float32(f)
+		}
+		return f
+	case c&0xe0 == 0xa0 || (c >= 0xd9 && c <= 0xdb):
+		return r.Str()
+	case c >= 0xc4 && c <= 0xc6:
+		return append([]byte(nil), r.Bin()...)
+	case c&0xf0 == 0x90 || c == 0xdc || c == 0xdd:
+		n := r.ArrayHeader()
+		res := make([]interface{}, n)
+		for i := 0; i < n && r.Err == nil; i++ {
+			res[i] = r.Any()
+		}
+		return res
+	case c&0xf0 == 0x80 || c == 0xde || c == 0xdf:
+		n := r.MapHeader()
+		res := make(map[interface{}]interface{}, n)
+		for i := 0; i < n && r.Err == nil; i++ {
+			k := r.Any()
+			switch k.(type) {
+			case []interface{}, map[interface{}]interface{}, []byte, Ext:
+				r.fail("unhashable map key %T", k)
+				return nil
+			}
+			res[k] = r.Any()
+		}
+		return res
+	case c == 0xc2 || c == 0xc3:
+		return r.Bool()
+	case c >= 0xd4 && c <= 0xd8 || c >= 0xc7 && c <= 0xc9:
+		e := r.Ext()
+		e.Data = append([]byte(nil), e.Data...)
+		return e
+	case c == 0xc0:
+		r.Body = r.Body[1:]
+		return nil
+	}
+	r.fail("unknown code %#x", c)
+	return nil
+}
+
+// Decode reads value into i, which should be a pointer
+func (r *MsgpackReader) Decode(i interface{}) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	switch o := i.(type) {
+	case *interface{}:
+		*o = r.Any()
+	case *string:
+		*o = r.Str()
+	case *int:
+		*o = int(r.Int())
+	case *int64:
+		*o = r.Int()
+	case *uint64:
+		*o = r.Uint()
+	case *bool:
+		*o = r.Bool()
+	default:
+		val := reflect.ValueOf(i)
+		if val.Kind() != reflect.Ptr || val.IsNil() {
+			r.fail("could not decode into %T", i)
+			break
+		}
+		r.DecodeValue(val.Elem())
+	}
+	return r.Err
+}
+
+func (r *MsgpackReader) DecodeValue(val reflect.Value) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	MsgpackReaderFor(val.Type()).Read(r, val)
+	return r.Err
+}
+
+var mrs = make(map[uintptr]*TMsgpackReader)
+var mrss = mrs
+var mrsL sync.Mutex
+
+func MsgpackReaderFor(rt reflect.Type) (rd *TMsgpackReader) {
+	rtid := reflect.ValueOf(rt).Pointer()
+	mrsL.Lock()
+	defer mrsL.Unlock()
+	if rd = mrs[rtid]; rd == nil {
+		mrss = make(map[uintptr]*TMsgpackReader, len(mrs)+1)
+		for t, r := range mrs {
+			mrss[t] = r
+		}
+		rd = _msgpackReader(rt)
+		mrs = mrss
+	}
+	return
+}
+
+func _msgpackReader(rt reflect.Type) (rd *TMsgpackReader) {
+	rtid := reflect.ValueOf(rt).Pointer()
+	if rd = mrss[rtid]; rd == nil {
+		rd = &TMsgpackReader{Type: rt}
+		mrss[rtid] = rd
+		rd.Fill()
+	}
+	return
+}
+
+type TMsgpackReader struct {
+	Type  reflect.Type
+	Key   *TMsgpackReader
+	Elem  *TMsgpackReader
+	Read  func(*MsgpackReader, reflect.Value)
+	Flds  []MsgpackFieldReader
+	Names map[string]int
+}
+
+type MsgpackFieldReader struct {
+	*TMsgpackReader
+	I    int
+	Name string
+}
+
+func (t *TMsgpackReader) Fill() {
+	rt := t.Type
+	if rt.Kind() != reflect.Interface && reflect.PtrTo(rt).Implements(iextreader) {
+		t.Read = func(r *MsgpackReader, v reflect.Value) {
+			if e := r.Ext(); r.Err == nil {
+				if err := v.Addr().Interface().(IExtReader).ISetExt(e); err != nil {
+					r.Err = err
+				}
+			}
+		}
+		return
+	} else if rt == text {
+		t.Read = func(r *MsgpackReader, v reflect.Value) {
+			e := r.Ext()
+			e.Data = append([]byte(nil), e.Data...)
+			v.Set(reflect.ValueOf(e))
+		}
+		return
+	}
+
+	switch rt.Kind() {
+	case reflect.Bool:
+		t.Read = func(r *MsgpackReader, v reflect.Value) { v.SetBool(r.Bool()) }
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		t.Read = func(r *MsgpackReader, v reflect.Value) {
+			if i := r.Int(); v.OverflowInt(i) {
+				r.fail("%d overflows %s", i, v.Type())
+			} else {
+				v.SetInt(i)
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		t.Read = func(r *MsgpackReader, v reflect.Value) {
+			if i := r.Uint(); v.OverflowUint(i) {
+				r.fail("%d overflows %s", i, v.Type())
+			} else {
+				v.SetUint(i)
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		t.Read = func(r *MsgpackReader, v reflect.Value) { v.SetFloat(r.Float()) }
+	case reflect.String:
+		t.Read = func(r *MsgpackReader, v reflect.Value) { v.SetString(r.Str()) }
+	case reflect.Ptr:
+		t.Elem = _msgpackReader(rt.Elem())
+		t.Read = func(r *MsgpackReader, v reflect.Value) {
+			if r.IsNil() {
+				v.Set(reflect.Zero(rt))
+				return
+			}
+			if v.IsNil() {
+				v.Set(reflect.New(rt.Elem()))
+			}
+			t.Elem.Read(r, v.Elem())
+		}
+	case reflect.Interface:
+		t.Read = func(r *MsgpackReader, v reflect.Value) {
+			if r.IsNil() {
+				v.Set(reflect.Zero(rt))
+				return
+			}
+			if !v.IsNil() && v.Elem().Kind() == reflect.Ptr && !v.Elem().IsNil() {
+				r.DecodeValue(v.Elem().Elem())
+				return
+			}
+			if rt.NumMethod() != 0 {
+				r.fail("could not decode into %s", rt)
+				return
+			}
+			if a := r.Any(); a != nil {
+				v.Set(reflect.ValueOf(a))
+			}
+		}
+	case reflect.Slice:
+		t.FillSlice()
+	case reflect.Array:
+		t.FillArray()
+	case reflect.Map:
+		t.Key = _msgpackReader(rt.Key())
+		t.Elem = _msgpackReader(rt.Elem())
+		t.Read = func(r *MsgpackReader, v reflect.Value) {
+			if r.IsNil() {
+				v.Set(reflect.Zero(rt))
+				return
+			}
+			n := r.MapHeader()
+			if v.IsNil() {
+				v.Set(reflect.MakeMapWithSize(rt, n))
+			}
+			for i := 0; i < n && r.Err == nil; i++ {
+				key := reflect.New(rt.Key()).Elem()
+				t.Key.Read(r, key)
+				val := reflect.New(rt.Elem()).Elem()
+				t.Elem.Read(r, val)
+				if r.Err == nil {
+					v.SetMapIndex(key, val)
+				}
+			}
+		}
+	case reflect.Struct:
+		t.FillStruct()
+	default:
+		log.Panicf("Could not decode msgpack into %+v", rt)
+	}
+}
+
+func (t *TMsgpackReader) FillSlice() {
+	rt := t.Type
+	if rt.Elem().Kind() == reflect.Uint8 && !reflect.PtrTo(rt.Elem()).Implements(iextreader) {
+		t.Read = func(r *MsgpackReader, v reflect.Value) {
+			if r.IsNil() {
+				v.Set(reflect.Zero(rt))
+				return
+			}
+			b := r.Bin()
+			s := reflect.MakeSlice(rt, len(b), len(b))
+			reflect.Copy(s, reflect.ValueOf(b))
+			v.Set(s)
+		}
+		return
+	}
+	t.Elem = _msgpackReader(rt.Elem())
+	t.Read = func(r *MsgpackReader, v reflect.Value) {
+		if r.IsNil() {
+			v.Set(reflect.Zero(rt))
+			return
+		}
+		n := r.ArrayHeader()
+		s := reflect.MakeSlice(rt, n, n)
+		for i := 0; i < n && r.Err == nil; i++ {
+			t.Elem.Read(r, s.Index(i))
+		}
+		v.Set(s)
+	}
+}
+
+func (t *TMsgpackReader) FillArray() {
+	rt := t.Type
+	l := rt.Len()
+	if rt.Elem().Kind() == reflect.Uint8 && !reflect.PtrTo(rt.Elem()).Implements(iextreader) {
+		t.Read = func(r *MsgpackReader, v reflect.Value) {
+			b := r.Bin()
+			if len(b) > l {
+				r.fail("%d bytes does not fit %s", len(b), rt)
+				return
+			}
+			v.Set(reflect.Zero(rt))
+			reflect.Copy(v, reflect.ValueOf(b))
+		}
+		return
+	}
+	t.Elem = _msgpackReader(rt.Elem())
+	t.Read = func(r *MsgpackReader, v reflect.Value) {
+		n := r.ArrayHeader()
+		if n > l {
+			r.fail("%d elements does not fit %s", n, rt)
+			return
+		}
+		v.Set(reflect.Zero(rt))
+		for i := 0; i < n && r.Err == nil; i++ {
+			t.Elem.Read(r, v.Index(i))
+		}
+	}
+}
+
+func (t *TMsgpackReader) FillStruct() {
+	rt := t.Type
+	t.Names = make(map[string]int)
+	for i := 0; i < rt.NumField(); i++ {
+		fld := rt.Field(i)
+		name, _ := msgpackTag(fld)
+		if fld.PkgPath != "" || name == "-" {
+			continue
+		}
+		t.Names[name] = len(t.Flds)
+		t.Flds = append(t.Flds, MsgpackFieldReader{
+			TMsgpackReader: _msgpackReader(fld.Type),
+			I:              i,
+			Name:           name,
+		})
+	}
+	t.Read = t.readStruct
+}
+
+// readStruct reads struct from array of fields or from map of field names,
+// extra elements and unknown names are skipped
+func (t *TMsgpackReader) readStruct(r *MsgpackReader, v reflect.Value) {
+	c := r.Peek()
+	switch {
+	case r.Err != nil:
+	case c&0xf0 == 0x80 || c == 0xde || c == 0xdf:
+		n := r.MapHeader()
+		for i := 0; i < n && r.Err == nil; i++ {
+			if j, ok := t.Names[r.Str()]; ok {
+				f := t.Flds[j]
+				f.Read(r, v.Field(f.I))
+			} else {
+				r.Skip()
+			}
+		}
+	default:
+		n := r.ArrayHeader()
+		for i := 0; i < n && r.Err == nil; i++ {
+			if i < len(t.Flds) {
+				f := t.Flds[i]
+				f.Read(r, v.Field(f.I))
+			} else {
+				r.Skip()
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package marshal
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type MArr struct {
+	Id   uint32
+	Name string
+	Tags []string
+}
+
+type MMap struct {
+	_    struct{} `msgpack:",map"`
+	Id   int64    `msgpack:"id"`
+	Ok   bool     `msgpack:"ok"`
+	Skip string   `msgpack:"-"`
+}
+
+type MPtr struct {
+	A *int32
+	B map[string]uint8
+	C interface{}
+}
+
+// MUuid is encoded as extension 2, as uuid in Tarantool
+type MUuid [16]byte
+
+func (u MUuid) IExt() Ext {
+	return Ext{Type: 2, Data: u[:]}
+}
+
+func (u *MUuid) ISetExt(e Ext) error {
+	if e.Type != 2 || len(e.Data) != 16 {
+		return fmt.Errorf("wrong uuid %v", e)
+	}
+	copy(u[:], e.Data)
+	return nil
+}
+
+var i32 = int32(-300)
+
+var mshoulds = [...]Should{
+	{uint32(5), []byte{5}},
+	{uint32(200), []byte{0xcc, 200}},
+	{uint64(70000), []byte{0xce, 0, 1, 0x11, 0x70}},
+	{int8(-5), []byte{0xfb}},
+	{int16(-300), []byte{0xd1, 0xfe, 0xd4}},
+	{true, []byte{0xc3}},
+	{float32(1.5), []byte{0xca, 0x3f, 0xc0, 0, 0}},
+	{"abc", []byte{0xa3, 'a', 'b', 'c'}},
+	{[]byte{1, 2}, []byte{0xc4, 2, 1, 2}},
+	{[]uint16{1, 300}, []byte{0x92, 1, 0xcd, 1, 0x2c}},
+	{[2]int{-1, 1}, []byte{0x92, 0xff, 1}},
+	{MArr{Id: 1, Name: "a", Tags: []string{"x"}}, []byte{0x93, 1, 0xa1, 'a', 0x91, 0xa1, 'x'}},
+	{MArr{Id: 1}, []byte{0x93, 1, 0xa0, 0xc0}},
+	{MMap{Id: -1, Ok: true}, []byte{0x82, 0xa2, 'i', 'd', 0xff, 0xa2, 'o', 'k', 0xc3}},
+	{MPtr{A: &i32, B: map[string]uint8{"k": 1}, C: "s"},
+		[]byte{0x93, 0xd1, 0xfe, 0xd4, 0x81, 0xa1, 'k', 1, 0xa1, 's'}},
+	{MPtr{}, []byte{0x93, 0xc0, 0xc0, 0xc0}},
+	{MUuid{1, 15: 2}, []byte{0xd8, 2, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2}},
+	{Ext{Type: -1, Data: []byte{1, 2, 3}}, []byte{0xc7, 3, 0xff, 1, 2, 3}},
+}
+
+func TestMsgpackEncode(t *testing.T) {
+	for _, should := range mshoulds {
+		if encoded := MsgpackWrite(should.v); !bytes.Equal(encoded, should.m) {
+			t.Errorf("Doesn't match %#v\n% x\n% x", should.v, encoded, should.m)
+		}
+	}
+}
+
+func TestMsgpackDecode(t *testing.T) {
+	for _, should := range mshoulds {
+		zero := zerovalue_pointer(should.v)
+		if err := MsgpackRead(should.m, zero); err != nil {
+			t.Errorf("Error %v\ndata: [% x]\nshould: %#v", err, should.m, should.v)
+		} else if !reflect.DeepEqual(dereference(zero), should.v) {
+			t.Errorf("Doesn't match [% x]\ngot: %#v\nshould: %#v", should.m, dereference(zero), should.v)
+		}
+	}
+}
+
+func TestMsgpackDecodeMixed(t *testing.T) {
+	// struct from map with unknown keys, map from array is an error
+	var m MArr
+	data := MsgpackWrite(map[string]interface{}{"Name": "n", "Extra": []interface{}{1, nil}})
+	if err := MsgpackRead(data, &m); err != nil || m.Name != "n" {
+		t.Errorf("struct should be read from map, got %+v %v", m, err)
+	}
+	// array with extra fields
+	data = MsgpackWrite([]interface{}{7, "x", nil, "extra"})
+	if err := MsgpackRead(data, &m); err != nil || m.Id != 7 || m.Tags != nil {
+		t.Errorf("extra fields should be skipped, got %+v %v", m, err)
+	}
+	var u8 uint8
+	if err := MsgpackRead([]byte{0xcd, 1, 0}, &u8); err == nil {
+		t.Errorf("overflow should be detected")
+	}
+	if err := MsgpackRead([]byte{0x93, 1}, &m); err == nil {
+		t.Errorf("short data should be detected")
+	}
+
+	var any interface{}
+	data = MsgpackWrite(MPtr{A: &i32, B: map[string]uint8{"k": 1}, C: MUuid{}})
+	if err := MsgpackRead(data, &any); err != nil {
+		t.Fatal(err)
+	}
+	should := []interface{}{int64(-300), map[interface{}]interface{}{"k": uint64(1)}, Ext{Type: 2, Data: make([]byte, 16)}}
+	if !reflect.DeepEqual(any, should) {
+		t.Errorf("Doesn't match\ngot: %#v\nshould: %#v", any, should)
+	}
+}
+
+func BenchmarkMsgpackEncode(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for _, should := range mshoulds {
+			MsgpackWrite(should.v)
+		}
+	}
+}
+
+func BenchmarkMsgpackDecode(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for _, should := range mshoulds {
+			zero := zerovalue_pointer(should.v)
+			MsgpackRead(should.m, zero)
+		}
+	}
+}
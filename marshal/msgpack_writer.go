@@ -0,0 +1,459 @@
+package marshal
+
+import (
+	"encoding/binary"
+	"log"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var be = binary.BigEndian
+
+// Ext is a MessagePack extension value, such as decimal or uuid of Tarantool
+type Ext struct {
+	Type int8
+	Data []byte
+}
+
+// IExtWriter is implemented by types encoded as MessagePack extension
+type IExtWriter interface {
+	IExt() Ext
+}
+
+// IExtReader is implemented by pointers to types decoded from MessagePack extension
+type IExtReader interface {
+	ISetExt(Ext) error
+}
+
+var iextwriter = reflect.TypeOf(new(IExtWriter)).Elem()
+var iextreader = reflect.TypeOf(new(IExtReader)).Elem()
+var text = reflect.TypeOf(Ext{})
+
+// MsgpackWriter writes values in MessagePack format.
+// Structs are written as arrays of exported fields by default, or as maps of field names,
+// if struct has blank field tagged `msgpack:",map"`:
+//
+//	type User struct {
+//		_    struct{} `msgpack:",map"`
+//		Id   uint32   `msgpack:"id"`
+//		Name string   `msgpack:"name"`
+//		Pass string   `msgpack:"-"`
+//	}
+//
+// It could wrap Writer passed to IWrite:
+//
+//	func (r Req) IWrite(w *marshal.Writer) {
+//		mw := marshal.MsgpackWriter{Writer: w}
+//		mw.Encode(r.Tuple)
+//	}
+type MsgpackWriter struct {
+	*Writer
+}
+
+var msgpackWriterPool = sync.Pool{
+	New: func() interface{} {
+		return &MsgpackWriter{&Writer{DefSize: 512}}
+	},
+}
+
+func MsgpackWrite(i interface{}) (res []byte) {
+	w := msgpackWriterPool.Get().(*MsgpackWriter)
+	w.Encode(i)
+	res = w.Written()
+	msgpackWriterPool.Put(w)
+	return res
+}
+
+func (w *MsgpackWriter) Nil() {
+	w.Uint8(0xc0)
+}
+
+func (w *MsgpackWriter) Bool(b bool) {
+	if b {
+		w.Uint8(0xc3)
+	} else {
+		w.Uint8(0xc2)
+	}
+}
+
+func (w *MsgpackWriter) Uint(i uint64) {
+	switch {
+	case i < 0x80:
+		w.Uint8(uint8(i))
+	case i <= math.MaxUint8:
+		b := w.Need(2)
+		b[0], b[1] = 0xcc, uint8(i)
+	case i <= math.MaxUint16:
+		b := w.Need(3)
+		b[0] = 0xcd
+		be.PutUint16(b[1:], uint16(i))
+	case i <= math.MaxUint32:
+		b := w.Need(5)
+		b[0] = 0xce
+		be.PutUint32(b[1:], uint32(i))
+	default:
+		b := w.Need(9)
+		b[0] = 0xcf
+		be.PutUint64(b[1:], i)
+	}
+}
+
+func (w *MsgpackWriter) Int(i int64) {
+	switch {
+	case i >= 0:
+		w.Uint(uint64(i))
+	case i >= -32:
+		w.Uint8(uint8(i))
+	case i >= math.MinInt8:
+		b := w.Need(2)
+		b[0], b[1] = 0xd0, uint8(i)
+	case i >= math.MinInt16:
+		b := w.Need(3)
+		b[0] = 0xd1
+		be.PutUint16(b[1:], uint16(i))
+	case i >= math.MinInt32:
+		b := w.Need(5)
+		b[0] = 0xd2
+		be.PutUint32(b[1:], uint32(i))
+	default:
+		b := w.Need(9)
+		b[0] = 0xd3
+		be.PutUint64(b[1:], uint64(i))
+	}
+}
+
+func (w *MsgpackWriter) Float32(f float32) {
+	b := w.Need(5)
+	b[0] = 0xca
+	be.PutUint32(b[1:], math.Float32bits(f))
+}
+
+func (w *MsgpackWriter) Float64(f float64) {
+	b := w.Need(9)
+	b[0] = 0xcb
+	be.PutUint64(b[1:], math.Float64bits(f))
+}
+
+// head writes fix code if n < fixMax, or one of codes with 1, 2 or 4 byte length
+func (w *MsgpackWriter) head(n int, fix byte, fixMax int, c8, c16, c32 byte) {
+	switch {
+	case n < fixMax:
+		w.Uint8(fix | uint8(n))
+	case c8 != 0 && n <= math.MaxUint8:
+		b := w.Need(2)
+		b[0], b[1] = c8, uint8(n)
+	case n <= math.MaxUint16:
+		b := w.Need(3)
+		b[0] = c16
+		be.PutUint16(b[1:], uint16(n))
+	default:
+		b := w.Need(5)
+		b[0] = c32
+		be.PutUint32(b[1:], uint32(n))
+	}
+}
+
+func (w *MsgpackWriter) Str(s string) {
+	w.head(len(s), 0xa0, 32, 0xd9, 0xda, 0xdb)
+	w.String(s)
+}
+
+func (w *MsgpackWriter) Bin(b []byte) {
+	w.head(len(b), 0, 0, 0xc4, 0xc5, 0xc6)
+	w.Bytes(b)
+}
+
+func (w *MsgpackWriter) ArrayHeader(n int) {
+	w.head(n, 0x90, 16, 0, 0xdc, 0xdd)
+}
+
+func (w *MsgpackWriter) MapHeader(n int) {
+	w.head(n, 0x80, 16, 0, 0xde, 0xdf)
+}
+
+func (w *MsgpackWriter) Ext(e Ext) {
+	switch len(e.Data) {
+	case 1:
+		w.Uint8(0xd4)
+	case 2:
+		w.Uint8(0xd5)
+	case 4:
+		w.Uint8(0xd6)
+	case 8:
+		w.Uint8(0xd7)
+	case 16:
+		w.Uint8(0xd8)
+	default:
+		w.head(len(e.Data), 0, 0, 0xc7, 0xc8, 0xc9)
+	}
+	w.Int8(e.Type)
+	w.Bytes(e.Data)
+}
+
+func (w *MsgpackWriter) Encode(i interface{}) {
+	switch o := i.(type) {
+	case nil:
+		w.Nil()
+	case bool:
+		w.Bool(o)
+	case int:
+		w.Int(int64(o))
+	case int64:
+		w.Int(o)
+	case int32:
+		w.Int(int64(o))
+	case uint:
+		w.Uint(uint64(o))
+	case uint64:
+		w.Uint(o)
+	case uint32:
+		w.Uint(uint64(o))
+	case float64:
+		w.Float64(o)
+	case string:
+		w.Str(o)
+	case []byte:
+		if o == nil {
+			w.Nil()
+		} else {
+			w.Bin(o)
+		}
+	case Ext:
+		w.Ext(o)
+	case []interface{}:
+		if o == nil {
+			w.Nil()
+			return
+		}
+		w.ArrayHeader(len(o))
+		for _, v := range o {
+			w.Encode(v)
+		}
+	case map[string]interface{}:
+		if o == nil {
+			w.Nil()
+			return
+		}
+		w.MapHeader(len(o))
+		for k, v := range o {
+			w.Str(k)
+			w.Encode(v)
+		}
+	default:
+		w.EncodeValue(reflect.ValueOf(i))
+	}
+}
+
+func (w *MsgpackWriter) EncodeValue(val reflect.Value) {
+	MsgpackWriterFor(val.Type()).Write(w, val)
+}
+
+var mws = make(map[uintptr]*TMsgpackWriter)
+var mwss = mws
+var mwsL sync.Mutex
+
+func MsgpackWriterFor(rt reflect.Type) (wr *TMsgpackWriter) {
+	rtid := reflect.ValueOf(rt).Pointer()
+	mwsL.Lock()
+	defer mwsL.Unlock()
+	if wr = mws[rtid]; wr == nil {
+		mwss = make(map[uintptr]*TMsgpackWriter, len(mws)+1)
+		for t, w := range mws {
+			mwss[t] = w
+		}
+		wr = _msgpackWriter(rt)
+		mws = mwss
+	}
+	return
+}
+
+func _msgpackWriter(rt reflect.Type) (wr *TMsgpackWriter) {
+	rtid := reflect.ValueOf(rt).Pointer()
+	if wr = mwss[rtid]; wr == nil {
+		wr = &TMsgpackWriter{Type: rt}
+		mwss[rtid] = wr
+		wr.Fill()
+	}
+	return
+}
+
+type TMsgpackWriter struct {
+	Type  reflect.Type
+	Key   *TMsgpackWriter
+	Elem  *TMsgpackWriter
+	Write func(*MsgpackWriter, reflect.Value)
+	AsMap bool
+	Flds  []MsgpackFieldWriter
+}
+
+type MsgpackFieldWriter struct {
+	*TMsgpackWriter
+	I    int
+	Name string
+}
+
+func (t *TMsgpackWriter) Fill() {
+	rt := t.Type
+	if rt.Kind() == reflect.Interface {
+		t.Write = func(w *MsgpackWriter, v reflect.Value) {
+			if v.IsNil() {
+				w.Nil()
+			} else {
+				w.Encode(v.Elem().Interface())
+			}
+		}
+		return
+	} else if rt.Implements(iextwriter) {
+		t.Write = func(w *MsgpackWriter, v reflect.Value) {
+			if rt.Kind() == reflect.Ptr && v.IsNil() {
+				w.Nil()
+				return
+			}
+			w.Ext(v.Interface().(IExtWriter).IExt())
+		}
+		return
+	} else if reflect.PtrTo(rt).Implements(iextwriter) {
+		t.Write = func(w *MsgpackWriter, v reflect.Value) {
+			if !v.CanAddr() {
+				p := reflect.New(rt)
+				p.Elem().Set(v)
+				v = p.Elem()
+			}
+			w.Ext(v.Addr().Interface().(IExtWriter).IExt())
+		}
+		return
+	} else if rt == text {
+		t.Write = func(w *MsgpackWriter, v reflect.Value) {
+			w.Ext(v.Interface().(Ext))
+		}
+		return
+	}
+
+	switch rt.Kind() {
+	case reflect.Bool:
+		t.Write = func(w *MsgpackWriter, v reflect.Value) { w.Bool(v.Bool()) }
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		t.Write = func(w *MsgpackWriter, v reflect.Value) { w.Int(v.Int()) }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		t.Write = func(w *MsgpackWriter, v reflect.Value) { w.Uint(v.Uint()) }
+	case reflect.Float32:
+		t.Write = func(w *MsgpackWriter, v reflect.Value) { w.Float32(float32(v.Float())) }
+	case reflect.Float64:
+		t.Write = func(w *MsgpackWriter, v reflect.Value) { w.Float64(v.Float()) }
+	case reflect.String:
+		t.Write = func(w *MsgpackWriter, v reflect.Value) { w.Str(v.String()) }
+	case reflect.Ptr:
+		t.Elem = _msgpackWriter(rt.Elem())
+		t.Write = func(w *MsgpackWriter, v reflect.Value) {
+			if v.IsNil() {
+				w.Nil()
+			} else {
+				t.Elem.Write(w, v.Elem())
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		t.FillSlice()
+	case reflect.Map:
+		t.Key = _msgpackWriter(rt.Key())
+		t.Elem = _msgpackWriter(rt.Elem())
+		t.Write = func(w *MsgpackWriter, v reflect.Value) {
+			if v.IsNil() {
+				w.Nil()
+				return
+			}
+			w.MapHeader(v.Len())
+			for it := v.MapRange(); it.Next(); {
+				t.Key.Write(w, it.Key())
+				t.Elem.Write(w, it.Value())
+			}
+		}
+	case reflect.Struct:
+		t.FillStruct()
+	default:
+		log.Panicf("Could not encode %+v as msgpack", rt)
+	}
+}
+
+func (t *TMsgpackWriter) FillSlice() {
+	rt := t.Type
+	slice := rt.Kind() == reflect.Slice
+	if rt.Elem().Kind() == reflect.Uint8 && !rt.Elem().Implements(iextwriter) {
+		t.Write = func(w *MsgpackWriter, v reflect.Value) {
+			switch {
+			case slice && v.IsNil():
+				w.Nil()
+			case slice:
+				w.Bin(v.Bytes())
+			default:
+				w.head(v.Len(), 0, 0, 0xc4, 0xc5, 0xc6)
+				b := w.Need(v.Len())
+				reflect.Copy(reflect.ValueOf(b), v)
+			}
+		}
+		return
+	}
+	t.Elem = _msgpackWriter(rt.Elem())
+	t.Write = func(w *MsgpackWriter, v reflect.Value) {
+		if slice && v.IsNil() {
+			w.Nil()
+			return
+		}
+		l := v.Len()
+		w.ArrayHeader(l)
+		for i := 0; i < l; i++ {
+			t.Elem.Write(w, v.Index(i))
+		}
+	}
+}
+
+// msgpackTag returns name and options of field
+func msgpackTag(fld reflect.StructField) (name string, opts []string) {
+	tag := strings.Split(fld.Tag.Get("msgpack"), ",")
+	if name = tag[0]; name == "" {
+		name = fld.Name
+	}
+	return name, tag[1:]
+}
+
+func (t *TMsgpackWriter) FillStruct() {
+	rt := t.Type
+	for i := 0; i < rt.NumField(); i++ {
+		fld := rt.Field(i)
+		name, opts := msgpackTag(fld)
+		if fld.Name == "_" {
+			for _, o := range opts {
+				switch o {
+				case "map":
+					t.AsMap = true
+				case "array":
+				default:
+					log.Panicf("Could not understand msgpack option %q of %+v", o, rt)
+				}
+			}
+			continue
+		}
+		if fld.PkgPath != "" || name == "-" {
+			continue
+		}
+		t.Flds = append(t.Flds, MsgpackFieldWriter{
+			TMsgpackWriter: _msgpackWriter(fld.Type),
+			I:              i,
+			Name:           name,
+		})
+	}
+	t.Write = func(w *MsgpackWriter, v reflect.Value) {
+		if t.AsMap {
+			w.MapHeader(len(t.Flds))
+		} else {
+			w.ArrayHeader(len(t.Flds))
+		}
+		for _, f := range t.Flds {
+			if t.AsMap {
+				w.Str(f.Name)
+			}
+			f.Write(w, v.Field(f.I))
+		}
+	}
+}
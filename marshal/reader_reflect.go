@@ -14,6 +14,8 @@ func (r *Reader) Read(i interface{}) error {
 	}
 	var count uint32
 	switch o := i.(type) {
+	case *bool:
+		*o = r.Bool()
 	case *int8:
 		*o = r.Int8()
 	case *uint8:
@@ -200,6 +202,10 @@ func (r *Reader) ReadWithSize(i interface{}, rs func(*Reader) int) error {
 		return r.Err
 	}
 	switch o := i.(type) {
+	case *bool:
+		if sz := rs(r); sz == 1 {
+			*o = r.Bool()
+		}
 	case *int8:
 		if sz := rs(r); sz == 1 {
 			*o = r.Int8()
@@ -312,12 +318,16 @@ func (r *Reader) ReadTail(i interface{}) error {
 	case *[]float64:
 		*o = make([]float64, len(r.Body)/8)
 		r.Float64sl(*o)
+	case IReadTailer:
+		o.IReadTail(o, r)
 	case IReader:
 		o.IRead(o, r)
 	case []IReader:
 		for i := range o {
 			o[i].IRead(o[i], r)
 		}
+	case IShortReadTailer:
+		o.IReadTail(r)
 	case IShortReader:
 		o.IRead(r)
 	case []IShortReader:
@@ -383,6 +393,7 @@ type TReader struct {
 	Type       reflect.Type
 	Implements bool
 	Elem       *TReader
+	Key        *TReader
 	Fixed      func(*Reader, reflect.Value)
 	Tail       func(*Reader, reflect.Value)
 	Auto       func(*Reader, reflect.Value)
@@ -398,6 +409,10 @@ type TReader struct {
 func (t *TReader) SetSize(v reflect.Value, sz int) (bool, error) {
 	switch t.Type.Kind() {
 	case reflect.Ptr:
+		// pointer to type with methods is handled by its own SzSet and CntSet
+		if t.Elem == nil {
+			break
+		}
 		if sz == 0 {
 			if !v.IsNil() {
 				if v.CanSet() {
@@ -474,6 +489,10 @@ func (t *TReader) WithSize(r *Reader, v reflect.Value, szrd func(*Reader) int) {
 func (t *TReader) SetCount(v reflect.Value, cnt int) error {
 	switch t.Type.Kind() {
 	case reflect.Ptr:
+		// pointer to type with methods is handled by its own SzSet and CntSet
+		if t.Elem == nil {
+			break
+		}
 		if cnt == 0 {
 			if !v.IsNil() {
 				if v.CanSet() {
@@ -547,6 +566,10 @@ func (t *TReader) fillautotail() {
 	if t.Tail == nil {
 		t.Tail = t.Fixed
 	}
+	// struct with own methods is single element, as struct filled with reflection
+	if t.Implements && t.Cnt < 0 && t.CntSet == nil && t.Type.Kind() == reflect.Struct {
+		t.Cnt = 1
+	}
 	if t.CntSet != nil {
 		t.Auto = func(r *Reader, v reflect.Value) {
 			t.WithCount(r, v, (*Reader).IntUint32)
@@ -661,7 +684,16 @@ func (t *TReader) Fill() {
 		return
 	}
 
+	if rt == ttime {
+		t.FillTime(TimeEpoch)
+		return
+	}
+
 	switch rt.Kind() {
+	case reflect.Bool:
+		t.Sz = 1
+		t.Cnt = 1
+		t.Fixed = (*Reader).BoolVal
 	case reflect.String:
 		t.AutoCount = func(r *Reader, v reflect.Value, sz int) {
 			v.SetString(r.String(sz))
@@ -741,6 +773,10 @@ func (t *TReader) Fill() {
 	case reflect.Slice:
 		t.Elem = _reader(rt.Elem())
 		t.FillSlice()
+	case reflect.Map:
+		t.Key = _reader(rt.Key())
+		t.Elem = _reader(rt.Elem())
+		t.FillMap()
 	case reflect.Struct:
 		t.FillStruct()
 	case reflect.Interface:
@@ -776,7 +812,7 @@ func (t *TReader) FillPtr() {
 		}
 	}
 	t.Tail = func(r *Reader, v reflect.Value) {
-		if r.Err == nil {
+		if r.Err != nil {
 			return
 		}
 		if len(r.Body) > 0 {
@@ -952,18 +988,77 @@ func (t *TReader) FillSlice() {
 	}
 }
 
+func (t *TReader) readPair(r *Reader, m reflect.Value) {
+	k := reflect.New(t.Key.Type).Elem()
+	el := reflect.New(t.Elem.Type).Elem()
+	t.Key.Auto(r, k)
+	t.Elem.Auto(r, el)
+	if r.Err == nil {
+		m.SetMapIndex(k, el)
+	}
+}
+
+// FillMap reads key value pairs into new map. As for slices, map is left nil
+// if there is no pairs.
+func (t *TReader) FillMap() {
+	t.AutoCount = func(r *Reader, v reflect.Value, cnt int) {
+		if cnt == 0 {
+			if v.Len() != 0 {
+				v.Set(reflect.Zero(t.Type))
+			}
+			return
+		}
+		m := reflect.MakeMapWithSize(t.Type, cnt)
+		for i := 0; i < cnt && r.Err == nil; i++ {
+			t.readPair(r, m)
+		}
+		v.Set(m)
+	}
+	t.Tail = func(r *Reader, v reflect.Value) {
+		if len(r.Body) == 0 {
+			if v.Len() != 0 {
+				v.Set(reflect.Zero(t.Type))
+			}
+			return
+		}
+		m := reflect.MakeMap(t.Type)
+		for len(r.Body) > 0 && r.Err == nil {
+			t.readPair(r, m)
+		}
+		v.Set(m)
+	}
+}
+
 type FieldReader struct {
 	*TReader
 	I      int
 	NoSize bool
+	Opt    bool
 	Tag    reflect.StructTag
 	SzRd   func(*Reader) int
 	CntRd  func(*Reader) int
 }
 
+// readOpt reads presence flag of pointer field, and allocates or resets pointer accordingly
+func readOpt(r *Reader, v reflect.Value) bool {
+	present := r.Bool()
+	if r.Err != nil {
+		return false
+	}
+	if !present {
+		v.Set(reflect.Zero(v.Type()))
+	} else if v.IsNil() {
+		v.Set(reflect.New(v.Type().Elem()))
+	}
+	return present
+}
+
 func (sw *TReader) structFixed(r *Reader, v reflect.Value) {
 	for _, fs := range sw.Flds {
 		fv := v.Field(fs.I)
+		if fs.Opt && !readOpt(r, fv) {
+			continue
+		}
 		if fs.SzRd != nil {
 			fs.WithSize(r, fv, fs.SzRd)
 		} else if fs.CntRd != nil {
@@ -979,6 +1074,9 @@ func (sw *TReader) structFixed(r *Reader, v reflect.Value) {
 func (sw *TReader) structTail(r *Reader, v reflect.Value) {
 	for _, fs := range sw.Flds {
 		fv := v.Field(fs.I)
+		if fs.Opt && !readOpt(r, fv) {
+			continue
+		}
 		if fs.SzRd != nil {
 			fs.WithSize(r, fv, fs.SzRd)
 		} else if fs.CntRd != nil {
@@ -1006,9 +1104,10 @@ Fields:
 		if nosize {
 			log.Panicf("Only last field could be marked as size(no) or cnt(no) %+v", rt)
 		}
-		fr := FieldReader{I: i}
+		fr := FieldReader{I: i, Tag: fld.Tag}
 		ipro := fld.Tag.Get("iproto")
 		var ber bool
+		var unit string
 
 		for _, m := range strings.Split(ipro, ",") {
 			if m == "skip" {
@@ -1016,6 +1115,19 @@ Fields:
 			} else if m == "ber" {
 				ber = true
 				size = -1
+			} else if m == "opt" {
+				if fld.Type.Kind() != reflect.Ptr {
+					log.Panicf("Could not apply 'opt' for type %+v of field %s", fld.Type, fld.Name)
+				}
+				fr.Opt = true
+			} else if strings.HasPrefix(m, "time(") {
+				unit = m[5 : len(m)-1]
+				if err := checkTimeUnit(unit); err != nil {
+					log.Panicf("%s for field %s", err, fld.Name)
+				}
+				if fld.Type != ttime && fld.Type != tduration {
+					log.Panicf("Could not apply 'time(%s)' for type %+v of field %s", unit, fld.Type, fld.Name)
+				}
 			} else if strings.HasPrefix(m, "size(") {
 				if fr.TReader == nil {
 					fr.TReader = _reader(fld.Type)
@@ -1073,7 +1185,7 @@ Fields:
 					fr.CntRd = (*Reader).Intvar
 				case "i8":
 					if size >= 0 {
-						size += 2
+						size += 1
 					}
 					fr.CntRd = (*Reader).IntUint8
 				case "i16":
@@ -1105,7 +1217,11 @@ Fields:
 			log.Panicf("Sorry, but you shall not use both size() and cnt() iproto tag directive for field %s", fld.Name)
 		}
 
-		if fr.TReader == nil {
+		if unit != "" {
+			fr.TReader = &TReader{Type: fld.Type, Sz: -1, Cnt: -1}
+			fr.FillTime(unit)
+			fr.fillautotail()
+		} else if fr.TReader == nil {
 			fr.TReader = _reader(fld.Type)
 		}
 
@@ -1113,7 +1229,9 @@ Fields:
 			continue
 		}
 
-		if size >= 0 {
+		if fr.Sz < 0 {
+			size = -1
+		} else if size >= 0 {
 			size += fr.Sz
 		}
 
@@ -0,0 +1,122 @@
+package marshal
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// time.Time and time.Duration are encoded as int64 in one of units selected with
+// time() iproto tag directive:
+//
+//	time(sec)   - seconds, since unix epoch for time.Time
+//	time(ms)    - milliseconds, since unix epoch for time.Time
+//	time(epoch) - nanoseconds, since iproto.Epoch origin for time.Time
+//
+// time(epoch) is used when there is no directive, so time.Duration is kept
+// encoded as plain int64, and time.Time is compatible with iproto.Epoch.
+// Zero time.Time is encoded as 0, and 0 is decoded as zero time.Time.
+
+const (
+	TimeSec   = "sec"
+	TimeMs    = "ms"
+	TimeEpoch = "epoch"
+)
+
+// epoch is origin of iproto.Epoch
+var epoch = time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var ttime = reflect.TypeOf(time.Time{})
+var tduration = reflect.TypeOf(time.Duration(0))
+
+func checkTimeUnit(unit string) error {
+	switch unit {
+	case TimeSec, TimeMs, TimeEpoch:
+		return nil
+	}
+	return fmt.Errorf("Could not understand directive time(%s)", unit)
+}
+
+// TimeInt returns tm encoded in unit
+func TimeInt(tm time.Time, unit string) int64 {
+	if tm.IsZero() {
+		return 0
+	}
+	switch unit {
+	case TimeSec:
+		return tm.Unix()
+	case TimeMs:
+		return tm.UnixMilli()
+	}
+	return int64(tm.Sub(epoch))
+}
+
+// IntTime returns time decoded from i in unit
+func IntTime(i int64, unit string) time.Time {
+	if i == 0 {
+		return time.Time{}
+	}
+	switch unit {
+	case TimeSec:
+		return time.Unix(i, 0).UTC()
+	case TimeMs:
+		return time.UnixMilli(i).UTC()
+	}
+	return epoch.Add(time.Duration(i))
+}
+
+// DurationInt returns d encoded in unit
+func DurationInt(d time.Duration, unit string) int64 {
+	switch unit {
+	case TimeSec:
+		return int64(d / time.Second)
+	case TimeMs:
+		return int64(d / time.Millisecond)
+	}
+	return int64(d)
+}
+
+// IntDuration returns duration decoded from i in unit
+func IntDuration(i int64, unit string) time.Duration {
+	switch unit {
+	case TimeSec:
+		return time.Duration(i) * time.Second
+	case TimeMs:
+		return time.Duration(i) * time.Millisecond
+	}
+	return time.Duration(i)
+}
+
+func (t *TWriter) FillTime(unit string) {
+	t.Implements = true
+	t.Sz = 8
+	t.Cnt = 1
+	if t.Type == ttime {
+		t.Write = func(w *Writer, v reflect.Value) {
+			w.Int64(TimeInt(v.Interface().(time.Time), unit))
+		}
+	} else {
+		t.Write = func(w *Writer, v reflect.Value) {
+			w.Int64(DurationInt(time.Duration(v.Int()), unit))
+		}
+	}
+}
+
+func (t *TReader) FillTime(unit string) {
+	t.Implements = true
+	t.Sz = 8
+	t.Cnt = 1
+	if t.Type == ttime {
+		t.Fixed = func(r *Reader, v reflect.Value) {
+			if i := r.Int64(); r.Err == nil {
+				v.Set(reflect.ValueOf(IntTime(i, unit)))
+			}
+		}
+	} else {
+		t.Fixed = func(r *Reader, v reflect.Value) {
+			if i := r.Int64(); r.Err == nil {
+				v.SetInt(int64(IntDuration(i, unit)))
+			}
+		}
+	}
+}
@@ -78,8 +78,19 @@ func (w *Writer) Int8(i int8) {
 	return
 }
 
-func varu64size(i uint64) (j int) {
-	for j = 0; i > 1<<7; j++ {
+func (w *Writer) Bool(b bool) {
+	l := w.ensure(1)
+	if b {
+		w.buf[l] = 1
+	} else {
+		w.buf[l] = 0
+	}
+	return
+}
+
+// Varsize64 returns length of i encoded with Uint64var
+func Varsize64(i uint64) (j int) {
+	for j = 0; i >= 1<<7; j++ {
 		i >>= 7
 	}
 	return j + 1
@@ -133,7 +144,7 @@ func (w *Writer) Intvar(i int) {
 }
 
 func (w *Writer) IntUint64(i int) {
-	w.Uint32(uint32(i))
+	w.Uint64(uint64(i))
 }
 
 func (w *Writer) IntUint32(i int) {
@@ -190,6 +201,10 @@ func (w *Writer) Int64Val(v reflect.Value) {
 	w.Int64(int64(v.Int()))
 }
 
+func (w *Writer) BoolVal(v reflect.Value) {
+	w.Bool(v.Bool())
+}
+
 func (w *Writer) Uint8Val(v reflect.Value) {
 	w.Uint8(uint8(v.Uint()))
 }
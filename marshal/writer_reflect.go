@@ -3,6 +3,7 @@ package marshal
 import (
 	"log"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -11,6 +12,8 @@ func (w *Writer) Write(i interface{}) {
 	switch o := i.(type) {
 	case nil:
 		return
+	case bool:
+		w.Bool(o)
 	case uint8:
 		w.Uint8(o)
 	case int8:
@@ -102,6 +105,8 @@ func (w *Writer) WriteTail(i interface{}) {
 	switch o := i.(type) {
 	case nil:
 		return
+	case bool:
+		w.Bool(o)
 	case uint8:
 		w.Uint8(o)
 	case int8:
@@ -171,6 +176,9 @@ func (w *Writer) WriteWithSize(i interface{}, ws func(*Writer, int)) {
 	switch o := i.(type) {
 	case nil:
 		return
+	case bool:
+		ws(w, 1)
+		w.Bool(o)
 	case uint8:
 		ws(w, 1)
 		w.Uint8(o)
@@ -257,6 +265,7 @@ type TWriter struct {
 	Type       reflect.Type
 	Implements bool
 	Elem       *TWriter
+	Key        *TWriter
 	Write      func(*Writer, reflect.Value)
 	WriteAuto  func(*Writer, reflect.Value)
 	Sz         int
@@ -281,8 +290,11 @@ func (t *TWriter) Size(v reflect.Value) int {
 		if v.IsNil() {
 			return 0
 		}
-		t = t.Elem
-		v = v.Elem()
+		// pointer to type with methods is handled by its own SzGet and CntGet
+		if t.Elem != nil {
+			t = t.Elem
+			v = v.Elem()
+		}
 	case reflect.Interface:
 		if v.IsNil() {
 			return 0
@@ -329,8 +341,11 @@ func (t *TWriter) Count(v reflect.Value) int {
 		if v.IsNil() {
 			return 0
 		}
-		t = t.Elem
-		v = v.Elem()
+		// pointer to type with methods is handled by its own SzGet and CntGet
+		if t.Elem != nil {
+			t = t.Elem
+			v = v.Elem()
+		}
 	case reflect.Interface:
 		if v.IsNil() {
 			return 0
@@ -360,6 +375,10 @@ func (t *TWriter) WithCount(w *Writer, v reflect.Value, cntwr func(*Writer, int)
 }
 
 func (t *TWriter) fillauto() {
+	// struct with own methods is single element, as struct filled with reflection
+	if t.Implements && t.Cnt < 0 && t.CntGet == nil && t.Type != nil && t.Type.Kind() == reflect.Struct {
+		t.Cnt = 1
+	}
 	if t.WriteAuto == nil {
 		if t.CntGet != nil {
 			t.WriteAuto = func(w *Writer, v reflect.Value) {
@@ -448,7 +467,16 @@ func (t *TWriter) Fill() {
 		return
 	}
 
+	if rt == ttime {
+		t.FillTime(TimeEpoch)
+		return
+	}
+
 	switch rt.Kind() {
+	case reflect.Bool:
+		t.Write = (*Writer).BoolVal
+		t.Sz = 1
+		t.Cnt = 1
 	case reflect.String:
 		t.Write = (*Writer).StringVal
 		t.SzGet = reflect.Value.Len
@@ -502,6 +530,10 @@ func (t *TWriter) Fill() {
 	case reflect.Slice:
 		t.Elem = _writer(rt.Elem())
 		t.FillSlice()
+	case reflect.Map:
+		t.Key = _writer(rt.Key())
+		t.Elem = _writer(rt.Elem())
+		t.FillMap()
 	case reflect.Struct:
 		t.FillStruct()
 	case reflect.Interface:
@@ -651,6 +683,45 @@ func (t *TWriter) FillSlice() {
 	}
 }
 
+// mapKeys returns map keys sorted, when they are ordered, so equal maps are encoded equally
+func mapKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	var less func(a, b reflect.Value) bool
+	switch v.Type().Key().Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		less = func(a, b reflect.Value) bool { return a.Int() < b.Int() }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		less = func(a, b reflect.Value) bool { return a.Uint() < b.Uint() }
+	case reflect.Float32, reflect.Float64:
+		less = func(a, b reflect.Value) bool { return a.Float() < b.Float() }
+	case reflect.String:
+		less = func(a, b reflect.Value) bool { return a.String() < b.String() }
+	default:
+		return keys
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	return keys
+}
+
+// FillMap encodes map as key value pairs, so it is prefixed with count of pairs
+func (t *TWriter) FillMap() {
+	t.CntGet = reflect.Value.Len
+	if t.Key.Sz >= 0 && t.Elem.Sz >= 0 {
+		t.SzGet = func(v reflect.Value) int { return v.Len() * (t.Key.Sz + t.Elem.Sz) }
+	}
+	t.Write = func(w *Writer, v reflect.Value) {
+		// map keys and values are not addressable, so copy them
+		k := reflect.New(t.Key.Type).Elem()
+		el := reflect.New(t.Elem.Type).Elem()
+		for _, key := range mapKeys(v) {
+			k.Set(key)
+			el.Set(v.MapIndex(key))
+			t.Key.WriteAuto(w, k)
+			t.Elem.WriteAuto(w, el)
+		}
+	}
+}
+
 func (t *TWriter) FillPtr() {
 	t.Write = func(w *Writer, v reflect.Value) {
 		if !v.IsNil() {
@@ -666,6 +737,7 @@ type FieldWriter struct {
 	*TWriter
 	I      int
 	NoSize bool
+	Opt    bool
 	Tag    reflect.StructTag
 	SzWr   func(*Writer, int)
 	CntWr  func(*Writer, int)
@@ -674,6 +746,12 @@ type FieldWriter struct {
 func (t *TWriter) writeStruct(w *Writer, v reflect.Value) {
 	for _, fs := range t.Flds {
 		fv := v.Field(fs.I)
+		if fs.Opt {
+			w.Bool(!fv.IsNil())
+			if fv.IsNil() {
+				continue
+			}
+		}
 		if fs.SzWr != nil {
 			fs.WithSize(w, fv, fs.SzWr)
 		} else if fs.CntWr != nil {
@@ -704,6 +782,7 @@ Fields:
 		ipro := fld.Tag.Get("iproto")
 		fw := FieldWriter{I: i, Tag: fld.Tag}
 		var ber bool
+		var unit string
 
 		for _, m := range strings.Split(ipro, ",") {
 			if m == "skip" {
@@ -711,6 +790,19 @@ Fields:
 			} else if m == "ber" {
 				ber = true
 				size = -1
+			} else if m == "opt" {
+				if fld.Type.Kind() != reflect.Ptr {
+					log.Panicf("Could not apply 'opt' for type %+v of field %s", fld.Type, fld.Name)
+				}
+				fw.Opt = true
+			} else if strings.HasPrefix(m, "time(") {
+				unit = m[5 : len(m)-1]
+				if err := checkTimeUnit(unit); err != nil {
+					log.Panicf("%s for field %s", err, fld.Name)
+				}
+				if fld.Type != ttime && fld.Type != tduration {
+					log.Panicf("Could not apply 'time(%s)' for type %+v of field %s", unit, fld.Type, fld.Name)
+				}
 			} else if strings.HasPrefix(m, "size(") {
 				if fw.TWriter == nil {
 					fw.TWriter = _writer(fld.Type)
@@ -768,7 +860,7 @@ Fields:
 					fw.CntWr = (*Writer).Intvar
 				case "i8":
 					if size >= 0 {
-						size += 2
+						size += 1
 					}
 					fw.CntWr = (*Writer).IntUint8
 				case "i16":
@@ -800,7 +892,11 @@ Fields:
 			log.Panicf("Sorry, but you shall not use both size() and cnt() iproto tag directive for field %s", fld.Name)
 		}
 
-		if fw.TWriter == nil {
+		if unit != "" {
+			fw.TWriter = &TWriter{Type: fld.Type, Sz: -1, Cnt: -1}
+			fw.FillTime(unit)
+			fw.fillauto()
+		} else if fw.TWriter == nil {
 			fw.TWriter = _writer(fld.Type)
 		}
 
@@ -808,7 +904,9 @@ Fields:
 			continue
 		}
 
-		if size >= 0 {
+		if fw.Sz < 0 {
+			size = -1
+		} else if size >= 0 {
 			size += fw.Sz
 		}
 
@@ -822,6 +920,10 @@ Fields:
 					fw.TWriter = &TWriter{}
 					*fw.TWriter = *BerSlWriter
 					fw.TWriter.Type = fld.Type
+					// arrays are never prefixed with count, as reader knows their length
+					fw.TWriter.Cnt = fld.Type.Len()
+					fw.TWriter.CntGet = nil
+					fw.TWriter.WriteAuto = fw.TWriter.Write
 				default:
 					log.Panicf("Could not apply 'ber' for array [%d]%+v", fld.Type.Len(), fld.Type.Elem())
 				}
@@ -861,7 +963,7 @@ var BerWriter = &TWriter{
 	WriteAuto:  (*Writer).VarVal,
 	Sz:         -1,
 	SzGet: func(v reflect.Value) int {
-		return varu64size(v.Uint())
+		return Varsize64(v.Uint())
 	},
 	Cnt: 1,
 }
@@ -876,7 +978,7 @@ var BerSlWriter = &TWriter{
 		l := v.Len()
 		s := 0
 		for i := 0; i < l; i++ {
-			s += varu64size(v.Index(i).Uint())
+			s += Varsize64(v.Index(i).Uint())
 		}
 		return s
 	},
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+)
+
+const (
+	Client = "client"
+	Server = "server"
+)
+
+type instruments struct {
+	requests    CounterVec
+	latency     HistogramVec
+	inFlight    GaugeVec
+	connErrors  CounterVec
+	connects    CounterVec
+	queueDepth  GaugeVec
+	connections GaugeVec
+	batchReqs   HistogramVec
+	batchBytes  HistogramVec
+}
+
+var (
+	BatchRequestsBuckets = []float64{1, 2, 4, 8, 16, 32, 64, 128, 256}
+	BatchBytesBuckets    = []float64{64, 256, 1024, 4096, 16384, 65536, 262144}
+)
+
+func (c *Collector) instruments() *instruments {
+	c.iprOnce.Do(func() {
+		c.ipr = &instruments{
+			requests: c.Counter("iproto_requests_total",
+				"Requests by side, end point name, message type and return code", "side", "name", "msg", "code"),
+			latency: c.Histogram("iproto_request_duration_seconds",
+				"Time from request sent to response ready", nil, "side", "name", "msg"),
+			inFlight: c.Gauge("iproto_in_flight",
+				"Requests sent to connection and not answered yet", "side", "name", "conn"),
+			connErrors: c.Counter("iproto_client_connection_errors_total",
+				"Connection errors by stage", "name", "when"),
+			connects: c.Counter("iproto_client_connects_total",
+				"Established connections, including reconnects", "name"),
+			queueDepth: c.Gauge("iproto_queue_depth",
+				"Requests waiting in end point queue", "side", "name"),
+			connections: c.Gauge("iproto_server_connections",
+				"Currently accepted connections", "name"),
+			batchReqs: c.Histogram("iproto_client_batch_requests",
+				"Requests written with one flush", BatchRequestsBuckets, "name"),
+			batchBytes: c.Histogram("iproto_client_batch_bytes",
+				"Bytes of requests written with one flush", BatchBytesBuckets, "name"),
+		}
+	})
+	return c.ipr
+}
+
+func formatMsg(msg iproto.RequestType) string {
+	return strconv.FormatUint(uint64(msg), 10)
+}
+
+func formatCode(code iproto.RetCode) string {
+	return "0x" + strconv.FormatUint(uint64(code), 16)
+}
+
+// ObserveRequest records response code and latency
+func (c *Collector) ObserveRequest(side, name string, msg iproto.RequestType, code iproto.RetCode, elapsed time.Duration) {
+	ins := c.instruments()
+	m := formatMsg(msg)
+	ins.requests.With(side, name, m, formatCode(code)).Inc()
+	ins.latency.With(side, name, m).Observe(elapsed.Seconds())
+}
+
+// Wrap returns service which records every request passed to s
+func (c *Collector) Wrap(side, name string, s iproto.Service) iproto.Service {
+	return iproto.StatWrap(s, func(r *iproto.Request, elapsed time.Duration) {
+		c.ObserveRequest(side, name, r.Msg, r.Response.Code, elapsed)
+	})
+}
+
+func (c *Collector) ConnError(name, when string) {
+	c.instruments().connErrors.With(name, when).Inc()
+}
+
+func (c *Collector) Connected(name string) {
+	c.instruments().connects.With(name).Inc()
+}
+
+// TrackInFlight registers gauge reading count of requests in fly of connection
+func (c *Collector) TrackInFlight(side, name, conn string, f func() int) {
+	c.instruments().inFlight.Func(func() float64 { return float64(f()) }, side, name, conn)
+}
+
+func (c *Collector) UntrackInFlight(side, name, conn string) {
+	c.instruments().inFlight.Delete(side, name, conn)
+}
+
+// TrackQueue registers gauge reading queue depth of end point
+func (c *Collector) TrackQueue(side, name string, f func() int) {
+	c.instruments().queueDepth.Func(func() float64 { return float64(f()) }, side, name)
+}
+
+func (c *Collector) ConnectionsChanged(name string, delta int) {
+	c.instruments().connections.With(name).Add(float64(delta))
+}
+
+// ObserveBatch records size of requests batch flushed by client connection
+func (c *Collector) ObserveBatch(name string, requests, bytes int) {
+	ins := c.instruments()
+	ins.batchReqs.With(name).Observe(float64(requests))
+	ins.batchBytes.With(name).Observe(float64(bytes))
+}
@@ -0,0 +1,137 @@
+package metrics_test
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/metrics"
+	nt "github.com/funny-falcon/go-iproto/net"
+	"github.com/funny-falcon/go-iproto/net/iprototest"
+	"github.com/funny-falcon/go-iproto/net/server"
+)
+
+const msgTest = iproto.RequestType(17)
+
+// sample finds value of sample with name and labels given as name=value
+func sample(c *metrics.Collector, name string, labels ...string) (v float64, count uint64, found bool) {
+	c.Each(func(s metrics.Sample) {
+		if s.Name != name || len(s.Labels) != len(labels) {
+			return
+		}
+		for i, l := range s.Labels {
+			if l.Name+"="+l.Value != labels[i] {
+				return
+			}
+		}
+		v, count, found = s.Value, s.Count, true
+	})
+	return
+}
+
+func TestWrap(t *testing.T) {
+	var c metrics.Collector
+	s := c.Wrap(metrics.Server, "test", iproto.SF(func(r *iproto.Request) {
+		r.RespondBytes(0x102, nil)
+	}))
+	iproto.CallMsgBody(s, msgTest, nil)
+	iproto.CallMsgBody(s, msgTest, nil)
+
+	if v, _, ok := sample(&c, "iproto_requests_total", "side=server", "name=test", "msg=17", "code=0x102"); !ok || v != 2 {
+		t.Errorf("Requests counter %v %v, expect 2", v, ok)
+	}
+	if _, cnt, ok := sample(&c, "iproto_request_duration_seconds", "side=server", "name=test", "msg=17"); !ok || cnt != 2 {
+		t.Errorf("Latency count %v %v, expect 2", cnt, ok)
+	}
+}
+
+func TestObserveBatch(t *testing.T) {
+	var c metrics.Collector
+	c.ObserveBatch("test", 3, 100)
+	if v, cnt, ok := sample(&c, "iproto_client_batch_requests", "name=test"); !ok || cnt != 1 || v != 3 {
+		t.Errorf("Batch requests %v %v %v, expect 3 in 1", v, cnt, ok)
+	}
+	if v, cnt, ok := sample(&c, "iproto_client_batch_bytes", "name=test"); !ok || cnt != 1 || v != 100 {
+		t.Errorf("Batch bytes %v %v %v, expect 100 in 1", v, cnt, ok)
+	}
+}
+
+func TestTrackInFlight(t *testing.T) {
+	var c metrics.Collector
+	c.TrackInFlight(metrics.Client, "test", "1", func() int { return 0 })
+	// gauge's func is replaced while it is collected
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10000; i++ {
+			c.WriteText(&bytes.Buffer{})
+		}
+	}()
+	for i := 0; i < 10000; i++ {
+		n := i
+		c.TrackInFlight(metrics.Client, "test", "1", func() int { return n })
+	}
+	wg.Wait()
+	if v, _, ok := sample(&c, "iproto_in_flight", "side=client", "name=test", "conn=1"); !ok || v != 9999 {
+		t.Errorf("In flight %v %v, expect 9999", v, ok)
+	}
+	c.UntrackInFlight(metrics.Client, "test", "1")
+	if _, _, ok := sample(&c, "iproto_in_flight", "side=client", "name=test", "conn=1"); ok {
+		t.Errorf("In flight is not untracked")
+	}
+}
+
+func TestClientServerMetrics(t *testing.T) {
+	var cc, sc metrics.Collector
+	srv := iprototest.NewServer(nt.RC4byte)
+	defer srv.Close()
+	srv.Script(msgTest, iprototest.Reply{Code: 0x102})
+
+	cfg := srv.Config()
+	cfg.Name = "cli"
+	cfg.Metrics = &cc
+	cli := cfg.NewServer()
+	iproto.Run(cli)
+	defer cli.Stop()
+
+	proxy := (&server.Config{Network: "tcp", Address: "127.0.0.1:0", EndPoint: cli, Metrics: &sc, Logger: iproto.NopLogger{}}).NewServer()
+	if err := proxy.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Stop()
+	pcfg := srv.Config()
+	pcfg.Address = proxy.Addr().String()
+	pcli := pcfg.NewServer()
+	iproto.Run(pcli)
+	defer pcli.Stop()
+
+	if res := iproto.CallMsgBody(pcli, msgTest, nil); res.Code != 0x102 {
+		t.Fatalf("Request failed with %x", res.Code)
+	}
+
+	if v, _, ok := sample(&cc, "iproto_requests_total", "side=client", "name=cli", "msg=17", "code=0x102"); !ok || v != 1 {
+		t.Errorf("Client requests counter %v %v, expect 1", v, ok)
+	}
+	if v, _, ok := sample(&cc, "iproto_client_connects_total", "name=cli"); !ok || v != 1 {
+		t.Errorf("Client connects %v %v, expect 1", v, ok)
+	}
+	if v, _, ok := sample(&cc, "iproto_in_flight", "side=client", "name=cli", "conn=1"); !ok || v != 0 {
+		t.Errorf("Client in flight %v %v, expect 0", v, ok)
+	}
+	addr := "name=127.0.0.1:0"
+	if v, _, ok := sample(&sc, "iproto_requests_total", "side=server", addr, "msg=17", "code=0x102"); !ok || v != 1 {
+		t.Errorf("Server requests counter %v %v, expect 1", v, ok)
+	}
+	if v, _, ok := sample(&sc, "iproto_server_connections", addr); !ok || v != 1 {
+		t.Errorf("Server connections %v %v, expect 1", v, ok)
+	}
+
+	var b bytes.Buffer
+	sc.WriteText(&b)
+	if !strings.Contains(b.String(), "# TYPE iproto_server_connections gauge\n") {
+		t.Errorf("No server connections in text:\n%s", b.String())
+	}
+}
@@ -0,0 +1,327 @@
+/*
+Package metrics collects counters, gauges and histograms of iproto clients and servers.
+Collector is not bound to any metrics registry: it could be served in Prometheus text format
+with ServeHTTP, or its samples could be passed to any registry with Each.
+*/
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type Kind uint8
+
+const (
+	KindCounter = Kind(iota + 1)
+	KindGauge
+	KindHistogram
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindCounter:
+		return "counter"
+	case KindGauge:
+		return "gauge"
+	case KindHistogram:
+		return "histogram"
+	}
+	return "untyped"
+}
+
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// Sample is a single value of a metric, passed by Collector.Each
+type Sample struct {
+	Name   string
+	Help   string
+	Kind   Kind
+	Labels []Label
+	Value  float64
+	// Buckets holds cumulative counts for histograms, Value is a sum of observations for them
+	Buckets []Bucket
+	Count   uint64
+}
+
+type Label struct {
+	Name, Value string
+}
+
+type Bucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+type Collector struct {
+	m        sync.Mutex
+	families map[string]*family
+	ipr      *instruments
+	iprOnce  sync.Once
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    Kind
+	labels  []string
+	buckets []float64
+	m       sync.Mutex
+	series  map[string]*series
+}
+
+type series struct {
+	values []string
+	val    uint64
+	fn     func() float64
+	hcnt   []uint64
+	count  uint64
+}
+
+func (c *Collector) family(name, help string, kind Kind, buckets []float64, labels []string) *family {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.families == nil {
+		c.families = make(map[string]*family)
+	}
+	f := c.families[name]
+	if f == nil {
+		f = &family{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: make(map[string]*series)}
+		c.families[name] = f
+	}
+	return f
+}
+
+func (f *family) with(values []string) *series {
+	key := strings.Join(values, "\xff")
+	f.m.Lock()
+	s := f.series[key]
+	if s == nil {
+		s = &series{values: append([]string(nil), values...)}
+		if f.kind == KindHistogram {
+			s.hcnt = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	f.m.Unlock()
+	return s
+}
+
+func (f *family) delete(values []string) {
+	f.m.Lock()
+	delete(f.series, strings.Join(values, "\xff"))
+	f.m.Unlock()
+}
+
+func (s *series) add(v float64) {
+	for {
+		old := atomic.LoadUint64(&s.val)
+		if atomic.CompareAndSwapUint64(&s.val, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// value reads fn if it is set, fn should be loaded under family's lock
+func (s *series) value(fn func() float64) float64 {
+	if fn != nil {
+		return fn()
+	}
+	return math.Float64frombits(atomic.LoadUint64(&s.val))
+}
+
+type CounterVec struct{ f *family }
+type Counter struct{ s *series }
+
+func (c *Collector) Counter(name, help string, labels ...string) CounterVec {
+	return CounterVec{c.family(name, help, KindCounter, nil, labels)}
+}
+
+func (v CounterVec) With(values ...string) Counter {
+	return Counter{v.f.with(values)}
+}
+
+func (c Counter) Inc() {
+	c.s.add(1)
+}
+
+func (c Counter) Add(v float64) {
+	c.s.add(v)
+}
+
+type GaugeVec struct{ f *family }
+type Gauge struct{ s *series }
+
+func (c *Collector) Gauge(name, help string, labels ...string) GaugeVec {
+	return GaugeVec{c.family(name, help, KindGauge, nil, labels)}
+}
+
+func (v GaugeVec) With(values ...string) Gauge {
+	return Gauge{v.f.with(values)}
+}
+
+// Func makes gauge which value is read with f at collect time
+func (v GaugeVec) Func(f func() float64, values ...string) {
+	s := v.f.with(values)
+	v.f.m.Lock()
+	s.fn = f
+	v.f.m.Unlock()
+}
+
+func (v GaugeVec) Delete(values ...string) {
+	v.f.delete(values)
+}
+
+func (g Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.s.val, math.Float64bits(v))
+}
+
+func (g Gauge) Add(v float64) {
+	g.s.add(v)
+}
+
+type HistogramVec struct{ f *family }
+type Histogram struct {
+	s       *series
+	buckets []float64
+}
+
+// Histogram creates histogram with buckets upper bounds, DefaultBuckets are used if buckets is nil
+func (c *Collector) Histogram(name, help string, buckets []float64, labels ...string) HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return HistogramVec{c.family(name, help, KindHistogram, buckets, labels)}
+}
+
+func (v HistogramVec) With(values ...string) Histogram {
+	return Histogram{v.f.with(values), v.f.buckets}
+}
+
+func (h Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.s.hcnt) {
+		atomic.AddUint64(&h.s.hcnt[i], 1)
+	}
+	atomic.AddUint64(&h.s.count, 1)
+	h.s.add(v)
+}
+
+// Each passes every sample to f, families are sorted by name and series by labels
+func (c *Collector) Each(f func(Sample)) {
+	c.m.Lock()
+	fams := make([]*family, 0, len(c.families))
+	for _, fam := range c.families {
+		fams = append(fams, fam)
+	}
+	c.m.Unlock()
+	sort.Slice(fams, func(i, j int) bool { return fams[i].name < fams[j].name })
+
+	for _, fam := range fams {
+		fam.m.Lock()
+		keys := make([]string, 0, len(fam.series))
+		for key := range fam.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		all := make([]*series, len(keys))
+		fns := make([]func() float64, len(keys))
+		for i, key := range keys {
+			all[i] = fam.series[key]
+			fns[i] = all[i].fn
+		}
+		fam.m.Unlock()
+
+		for i, s := range all {
+			smp := Sample{Name: fam.name, Help: fam.help, Kind: fam.kind, Value: s.value(fns[i])}
+			for i, name := range fam.labels {
+				if i < len(s.values) {
+					smp.Labels = append(smp.Labels, Label{name, s.values[i]})
+				}
+			}
+			if fam.kind == KindHistogram {
+				var cum uint64
+				for i, b := range fam.buckets {
+					cum += atomic.LoadUint64(&s.hcnt[i])
+					smp.Buckets = append(smp.Buckets, Bucket{b, cum})
+				}
+				smp.Count = atomic.LoadUint64(&s.count)
+			}
+			f(smp)
+		}
+	}
+}
+
+// WriteText writes all samples in Prometheus text exposition format
+func (c *Collector) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	last := ""
+	c.Each(func(s Sample) {
+		if s.Name != last {
+			last = s.Name
+			bw.WriteString("# HELP " + s.Name + " " + escape(s.Help, false) + "\n")
+			bw.WriteString("# TYPE " + s.Name + " " + s.Kind.String() + "\n")
+		}
+		if s.Kind != KindHistogram {
+			writeLine(bw, s.Name, s.Labels, s.Value)
+			return
+		}
+		for _, b := range s.Buckets {
+			le := Label{"le", formatFloat(b.UpperBound)}
+			writeLine(bw, s.Name+"_bucket", append(s.Labels[:len(s.Labels):len(s.Labels)], le), float64(b.Count))
+		}
+		writeLine(bw, s.Name+"_bucket", append(s.Labels[:len(s.Labels):len(s.Labels)], Label{"le", "+Inf"}), float64(s.Count))
+		writeLine(bw, s.Name+"_sum", s.Labels, s.Value)
+		writeLine(bw, s.Name+"_count", s.Labels, float64(s.Count))
+	})
+	return bw.Flush()
+}
+
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteText(w)
+}
+
+func writeLine(w *bufio.Writer, name string, labels []Label, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l.Name + "=\"" + escape(l.Value, true) + "\"")
+		}
+		w.WriteByte('}')
+	}
+	w.WriteString(" " + formatFloat(v) + "\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escape(s string, quote bool) string {
+	if !strings.ContainsAny(s, "\\\n\"") {
+		return s
+	}
+	s = strings.Replace(s, "\\", `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quote {
+		s = strings.Replace(s, "\"", `\"`, -1)
+	}
+	return s
+}
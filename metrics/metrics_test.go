@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	var c Collector
+	c.Counter("req_total", "Requests", "msg").With("17").Add(2)
+	c.Gauge("depth", "Queue \"depth\"", "name").Func(func() float64 { return 3 }, `a"b`)
+	h := c.Histogram("lat", "Latency", []float64{0.1, 1}).With()
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(2)
+
+	var b bytes.Buffer
+	c.WriteText(&b)
+	need := `# HELP depth Queue "depth"
+# TYPE depth gauge
+depth{name="a\"b"} 3
+# HELP lat Latency
+# TYPE lat histogram
+lat_bucket{le="0.1"} 1
+lat_bucket{le="1"} 2
+lat_bucket{le="+Inf"} 3
+lat_sum 2.55
+lat_count 3
+# HELP req_total Requests
+# TYPE req_total counter
+req_total{msg="17"} 2
+`
+	if b.String() != need {
+		t.Errorf("Text format mismatch\ngot:\n%s\nneed:\n%s", b.String(), need)
+	}
+}
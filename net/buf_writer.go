@@ -8,7 +8,9 @@ import (
 type BufWriter struct {
 	w        io.Writer
 	buf      []byte
+	size     int
 	wr       int
+	written  int64
 	timeout  time.Duration
 	d        SetDeadliner
 	dChecked bool
@@ -22,11 +24,15 @@ func (w *BufWriter) Write(body []byte) (err error) {
 			return err
 		}
 		if bl > len(w.buf)/4 {
-			return w.write(body)
+			if err = w.write(body); err == nil {
+				w.written += int64(bl)
+			}
+			return
 		}
 	}
 	copy(w.buf[w.wr:w.wr+bl], body)
 	w.wr += bl
+	w.written += int64(bl)
 	return
 }
 
@@ -39,6 +45,7 @@ func (w *BufWriter) WriteUint32(i uint32) (err error) {
 
 	bin_le.PutUint32(w.buf[w.wr:w.wr+4], i)
 	w.wr += 4
+	w.written += 4
 	return
 }
 
@@ -54,21 +61,38 @@ func (w *BufWriter) Write3Uint32(i, j, k uint32) (err error) {
 	bin_le.PutUint32(w.buf[wr+4:wr+8], j)
 	bin_le.PutUint32(w.buf[wr+8:wr+12], k)
 	w.wr = wr + 12
+	w.written += 12
 	return
 }
 
 func (w *BufWriter) WriteByte(i byte) (err error) {
-	if w.wr+4 > len(w.buf) {
+	if w.wr+1 > len(w.buf) {
 		if err = w.Flush(); err != nil {
 			return
 		}
 	}
 
 	w.buf[w.wr] = i
-	w.wr += 4
+	w.wr += 1
+	w.written++
 	return
 }
 
+// SetSize sets size of buffer, it should be called before first write
+func (w *BufWriter) SetSize(size int) {
+	w.size = size
+}
+
+// Buffered returns number of bytes written but not flushed
+func (w *BufWriter) Buffered() int {
+	return w.wr
+}
+
+// Written returns total number of bytes written, flushed or not
+func (w *BufWriter) Written() int64 {
+	return w.written
+}
+
 func (w *BufWriter) Flush() (err error) {
 	if w.wr > 0 {
 		if err = w.write(w.buf[:w.wr]); err != nil {
@@ -78,7 +102,10 @@ func (w *BufWriter) Flush() (err error) {
 		w.wr = 0
 	}
 	if w.buf == nil {
-		w.buf = make([]byte, 4096)
+		if w.size <= 0 {
+			w.size = 4096
+		}
+		w.buf = make([]byte, w.size)
 	}
 	return
 }
@@ -0,0 +1,308 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/sbox"
+)
+
+type Role uint8
+
+const (
+	Master = Role(iota + 1)
+	Replica
+)
+
+type NodeConfig struct {
+	ServerConfig
+	Role Role
+}
+
+type ClusterConfig struct {
+	Nodes []NodeConfig
+
+	// IsWrite tells which requests should go to master. By default all but sbox select are writes.
+	IsWrite func(iproto.RequestType) bool
+
+	// Penalty is a time a node is not used after it answered sbox.RcNonMaster or sbox.RcReadOnly
+	Penalty time.Duration
+}
+
+var DefaultPenalty = 5 * time.Second
+
+const maxClusterNodes = 64
+
+type clusterNode struct {
+	*Server
+	role    Role
+	penalty int64
+}
+
+func (n *clusterNode) healthy(now int64) bool {
+	return n.AnyConnected() && atomic.LoadInt64(&n.penalty) <= now
+}
+
+// Cluster is a shard of servers with master and replicas.
+// Writes are routed to master, reads are spread over healthy replicas.
+// When master is disconnected or answers it is not master, writes are sent to other nodes,
+// and the node which accepted write is remembered as a new master.
+type Cluster struct {
+	ClusterConfig
+	nodes   []*clusterNode
+	master  int32
+	rr      uint32
+	timeout time.Duration
+	runned  bool
+}
+
+var _ iproto.EndPoint = (*Cluster)(nil)
+
+// Validate checks number of nodes and configs of nodes
+func (cfg *ClusterConfig) Validate() error {
+	if len(cfg.Nodes) == 0 {
+		return fmt.Errorf("iproto cluster: no nodes")
+	}
+	if len(cfg.Nodes) > maxClusterNodes {
+		return fmt.Errorf("iproto cluster: %d nodes, at most %d are supported", len(cfg.Nodes), maxClusterNodes)
+	}
+	for i := range cfg.Nodes {
+		if err := cfg.Nodes[i].Validate(); err != nil {
+			return fmt.Errorf("node %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// NewCluster validates configs of nodes and creates cluster
+func NewCluster(cfg ClusterConfig) (c *Cluster, err error) {
+	if err = cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg.newCluster(), nil
+}
+
+// NewCluster panics on invalid config, use package level NewCluster to get an error instead
+func (cfg ClusterConfig) NewCluster() (c *Cluster) {
+	c, err := NewCluster(cfg)
+	if err != nil {
+		log.Panic(err)
+	}
+	return c
+}
+
+func (cfg ClusterConfig) newCluster() (c *Cluster) {
+	if cfg.IsWrite == nil {
+		cfg.IsWrite = isWrite
+	}
+	if cfg.Penalty == 0 {
+		cfg.Penalty = DefaultPenalty
+	}
+	c = &Cluster{ClusterConfig: cfg, master: -1}
+	for i, ncfg := range cfg.Nodes {
+		n := &clusterNode{Server: ncfg.ServerConfig.NewServer(), role: ncfg.Role}
+		if n.role == 0 {
+			n.role = Replica
+		}
+		if n.role == Master && c.master < 0 {
+			c.master = int32(i)
+		}
+		if t := n.DefaultTimeout(); t > c.timeout {
+			c.timeout = t
+		}
+		c.nodes = append(c.nodes, n)
+	}
+	if c.master < 0 {
+		c.master = 0
+	}
+	return
+}
+
+func isWrite(msg iproto.RequestType) bool {
+	return !sbox.Idempotent(msg)
+}
+
+var ErrClusterChild = errors.New("iproto cluster: could not be a child end point")
+
+// Run starts cluster as EndPoint, error of Start is logged and cluster stays not runned
+func (c *Cluster) Run(ch chan *iproto.Request) {
+	err := ErrClusterChild
+	if ch == nil {
+		err = c.Start()
+	}
+	if err != nil {
+		iproto.DefaultLogger.Error("Cluster is not runned", "err", err)
+	}
+}
+
+// Start runs nodes of cluster. If some node fails to run, nodes already started are stopped.
+func (c *Cluster) Start() error {
+	if c.runned {
+		return iproto.ErrAlreadyRunned
+	}
+	for i, n := range c.nodes {
+		if err := iproto.Run(n.Server); err != nil {
+			for _, s := range c.nodes[:i] {
+				s.Stop()
+			}
+			return fmt.Errorf("iproto cluster: node %d: %w", i, err)
+		}
+	}
+	c.runned = true
+	return nil
+}
+
+func (c *Cluster) Stop() {
+	for _, n := range c.nodes {
+		n.Stop()
+	}
+	c.runned = false
+}
+
+func (c *Cluster) Runned() bool {
+	return c.runned
+}
+
+func (c *Cluster) DefaultTimeout() time.Duration {
+	return c.timeout
+}
+
+// Master returns a node which is currently considered as a master
+func (c *Cluster) Master() *Server {
+	return c.nodes[atomic.LoadInt32(&c.master)].Server
+}
+
+func (c *Cluster) Send(r *iproto.Request) {
+	bm := &clusterBookmark{c: c, write: c.IsWrite(r.Msg), node: -1}
+	if r.ChainBookmark(bm) {
+		c.route(r, bm)
+	}
+}
+
+func (c *Cluster) route(r *iproto.Request, bm *clusterBookmark) {
+	var i int
+	if bm.write {
+		i = c.pickWrite(bm.tried)
+	} else {
+		i = c.pickRead(bm.tried)
+	}
+	if i < 0 {
+		r.IOError()
+		return
+	}
+	bm.node = i
+	bm.tried |= 1 << uint(i)
+	c.nodes[i].Send(r)
+}
+
+func (c *Cluster) pickWrite(tried uint64) int {
+	now := time.Now().UnixNano()
+	m := int(atomic.LoadInt32(&c.master))
+	if tried&(1<<uint(m)) == 0 && c.nodes[m].healthy(now) {
+		return m
+	}
+	for _, role := range [...]Role{Master, Replica} {
+		for i, n := range c.nodes {
+			if tried&(1<<uint(i)) == 0 && n.role == role && n.healthy(now) {
+				return i
+			}
+		}
+	}
+	if tried == 0 {
+		/* nothing is healthy: let master's queue deal with request */
+		return m
+	}
+	return -1
+}
+
+func (c *Cluster) pickRead(tried uint64) int {
+	now := time.Now().UnixNano()
+	l := len(c.nodes)
+	start := int(atomic.AddUint32(&c.rr, 1))
+	var cands [maxClusterNodes]int
+	for _, role := range [...]Role{Replica, Master} {
+		/* rotate among suitable nodes only, so nodes of other role do not skew the spread */
+		k := 0
+		for i, n := range c.nodes {
+			if tried&(1<<uint(i)) == 0 && n.role == role && n.healthy(now) {
+				cands[k] = i
+				k++
+			}
+		}
+		if k > 0 {
+			return cands[start%k]
+		}
+	}
+	for j := 0; j < l; j++ {
+		if i := (start + j) % l; tried&(1<<uint(i)) == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *Cluster) penalize(i int) {
+	atomic.StoreInt64(&c.nodes[i].penalty, time.Now().Add(c.Penalty).UnixNano())
+	if next := c.pickWrite(1 << uint(i)); next >= 0 {
+		atomic.CompareAndSwapInt32(&c.master, int32(i), int32(next))
+	}
+}
+
+// accepted tells whether node performed write: it answered with success,
+// or it is configured as master and answered with user level error.
+// Replica could answer with error without checking whether it is master.
+func (c *Cluster) accepted(i int, code iproto.RetCode) bool {
+	if code == iproto.RcOK {
+		return true
+	}
+	return c.nodes[i].role == Master && code&iproto.RcKindMask != iproto.RcInternal
+}
+
+type clusterBookmark struct {
+	iproto.Bookmark
+	c     *Cluster
+	write bool
+	node  int
+	tried uint64
+}
+
+func (bm *clusterBookmark) Respond(res *iproto.Response) {
+	c := bm.c
+	switch res.Code {
+	case sbox.RcNonMaster, sbox.RcReadOnly:
+		c.penalize(bm.node)
+	case iproto.RcIOError:
+		if bm.write {
+			return
+		}
+	default:
+		if bm.write && c.accepted(bm.node, res.Code) {
+			atomic.StoreInt32(&c.master, int32(bm.node))
+		}
+		return
+	}
+	if bm.write && c.pickWrite(bm.tried) < 0 {
+		return
+	}
+	if !bm.write && c.pickRead(bm.tried) < 0 {
+		return
+	}
+	r := bm.Request
+	if !r.ResetToNew() {
+		return
+	}
+	go bm.resend(r)
+}
+
+func (bm *clusterBookmark) resend(r *iproto.Request) {
+	r.Lock()
+	ok := r.State() == iproto.RsNew
+	r.Unlock()
+	if ok {
+		bm.c.route(r, bm)
+	}
+}
@@ -0,0 +1,197 @@
+package client_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	nt "github.com/funny-falcon/go-iproto/net"
+	"github.com/funny-falcon/go-iproto/net/client"
+	"github.com/funny-falcon/go-iproto/net/iprototest"
+	"github.com/funny-falcon/go-iproto/sbox"
+)
+
+const (
+	msgWrite = iproto.RequestType(13)
+	msgRead  = iproto.RequestType(17)
+)
+
+func isWrite(msg iproto.RequestType) bool {
+	return msg == msgWrite
+}
+
+func node(srv *iprototest.Server, role client.Role) client.NodeConfig {
+	cfg := srv.Config()
+	cfg.Name = srv.Address
+	return client.NodeConfig{ServerConfig: cfg, Role: role}
+}
+
+func runCluster(t *testing.T, cfg client.ClusterConfig) *client.Cluster {
+	cfg.IsWrite = isWrite
+	c, err := client.NewCluster(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iproto.Run(c)
+	t.Cleanup(c.Stop)
+	// wait for all nodes to connect
+	time.Sleep(50 * time.Millisecond)
+	return c
+}
+
+func testServers(t *testing.T, n int) []*iprototest.Server {
+	srvs := make([]*iprototest.Server, n)
+	for i := range srvs {
+		srvs[i] = iprototest.NewServer(nt.RC4byte)
+		t.Cleanup(srvs[i].Close)
+	}
+	return srvs
+}
+
+func TestClusterTooManyNodes(t *testing.T) {
+	var cfg client.ClusterConfig
+	for i := 0; i < 65; i++ {
+		cfg.Nodes = append(cfg.Nodes, client.NodeConfig{ServerConfig: client.ServerConfig{Address: "127.0.0.1:1"}})
+	}
+	if _, err := client.NewCluster(cfg); err == nil {
+		t.Errorf("Cluster with 65 nodes should not be created")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("NewCluster method should panic with 65 nodes")
+		}
+	}()
+	cfg.NewCluster()
+}
+
+func TestClusterNoNodes(t *testing.T) {
+	if _, err := client.NewCluster(client.ClusterConfig{}); err == nil {
+		t.Errorf("Cluster without nodes should not be created")
+	}
+}
+
+func TestClusterStart(t *testing.T) {
+	srvs := testServers(t, 2)
+	cfg := client.ClusterConfig{Nodes: []client.NodeConfig{node(srvs[0], client.Replica), node(srvs[1], client.Master)}}
+	c, err := client.NewCluster(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Run(make(chan *iproto.Request))
+	if c.Runned() {
+		t.Errorf("Cluster should not run as a child end point")
+	}
+	if err = c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Stop)
+	if err = c.Start(); err != iproto.ErrAlreadyRunned {
+		t.Errorf("Second Start should return ErrAlreadyRunned, got %v", err)
+	}
+	if err = iproto.Run(c); err != iproto.ErrAlreadyRunned {
+		t.Errorf("Run of running cluster should return ErrAlreadyRunned, got %v", err)
+	}
+
+	c = cfg.NewCluster()
+	iproto.Run(c.Master())
+	t.Cleanup(c.Master().Stop)
+	if err = c.Start(); !errors.Is(err, iproto.ErrAlreadyRunned) {
+		t.Errorf("Start should fail on running node, got %v", err)
+	}
+	if c.Runned() {
+		t.Errorf("Cluster should not be runned when node fails")
+	}
+}
+
+func TestClusterFailover(t *testing.T) {
+	srvs := testServers(t, 2)
+	c := runCluster(t, client.ClusterConfig{
+		Nodes: []client.NodeConfig{node(srvs[0], client.Master), node(srvs[1], client.Replica)},
+	})
+
+	srvs[0].Script(msgWrite, iprototest.Reply{Code: sbox.RcNonMaster})
+	if res := iproto.CallMsgBody(c, msgWrite, nil); res.Code != iproto.RcOK {
+		t.Fatalf("Write should be accepted by replica, got %x", res.Code)
+	}
+	if c.Master().Name() != srvs[1].Address {
+		t.Errorf("Replica should become master, master is %s", c.Master().Name())
+	}
+	iproto.CallMsgBody(c, msgWrite, nil)
+	if n0, n1 := len(srvs[0].RequestsOf(msgWrite)), len(srvs[1].RequestsOf(msgWrite)); n0 != 1 || n1 != 2 {
+		t.Errorf("Writes should go to new master, got %d and %d", n0, n1)
+	}
+}
+
+func TestClusterPenalty(t *testing.T) {
+	srvs := testServers(t, 2)
+	c := runCluster(t, client.ClusterConfig{
+		Nodes:   []client.NodeConfig{node(srvs[0], client.Replica), node(srvs[1], client.Master)},
+		Penalty: 200 * time.Millisecond,
+	})
+
+	srvs[0].Script(msgRead, iprototest.Reply{Code: sbox.RcReadOnly})
+	for i := 0; i < 2; i++ {
+		if res := iproto.CallMsgBody(c, msgRead, nil); res.Code != iproto.RcOK {
+			t.Fatalf("Read should succeed, got %x", res.Code)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		iproto.CallMsgBody(c, msgRead, nil)
+	}
+	if n := len(srvs[0].RequestsOf(msgRead)); n != 1 {
+		t.Errorf("Penalized replica should not be used, got %d reads", n)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	srvs[0].Reset()
+	for i := 0; i < 4; i++ {
+		iproto.CallMsgBody(c, msgRead, nil)
+	}
+	if n := len(srvs[0].RequestsOf(msgRead)); n != 4 {
+		t.Errorf("Replica should be used after penalty, got %d of 4 reads", n)
+	}
+}
+
+func TestClusterReadSpread(t *testing.T) {
+	srvs := testServers(t, 3)
+	c := runCluster(t, client.ClusterConfig{
+		Nodes: []client.NodeConfig{node(srvs[0], client.Master), node(srvs[1], client.Replica), node(srvs[2], client.Replica)},
+	})
+
+	for i := 0; i < 10; i++ {
+		if res := iproto.CallMsgBody(c, msgRead, nil); res.Code != iproto.RcOK {
+			t.Fatalf("Read failed %x", res.Code)
+		}
+	}
+	if n := len(srvs[0].RequestsOf(msgRead)); n != 0 {
+		t.Errorf("Reads should not go to master while replicas are healthy, got %d", n)
+	}
+	if n1, n2 := len(srvs[1].RequestsOf(msgRead)), len(srvs[2].RequestsOf(msgRead)); n1 != 5 || n2 != 5 {
+		t.Errorf("Reads should be spread over replicas, got %d and %d", n1, n2)
+	}
+}
+
+func TestClusterReplicaError(t *testing.T) {
+	srvs := testServers(t, 1)
+	// master is not reachable, so write goes to replica
+	dead := client.NodeConfig{ServerConfig: client.ServerConfig{Name: "dead", Address: "127.0.0.1:1", Timeout: time.Second, Logger: iproto.NopLogger{}}, Role: client.Master}
+	c := runCluster(t, client.ClusterConfig{
+		Nodes: []client.NodeConfig{dead, node(srvs[0], client.Replica)},
+	})
+
+	srvs[0].Script(msgWrite, iprototest.Reply{Code: sbox.RcIllegalParams})
+	if res := iproto.CallMsgBody(c, msgWrite, nil); res.Code != sbox.RcIllegalParams {
+		t.Fatalf("Replica's error should be returned, got %x", res.Code)
+	}
+	if c.Master().Name() != "dead" {
+		t.Errorf("Replica answered with error should not become master, master is %s", c.Master().Name())
+	}
+
+	if res := iproto.CallMsgBody(c, msgWrite, nil); res.Code != iproto.RcOK {
+		t.Fatalf("Write should be accepted by replica, got %x", res.Code)
+	}
+	if c.Master().Name() != srvs[0].Address {
+		t.Errorf("Replica accepted write should become master")
+	}
+}
@@ -1,10 +1,14 @@
 package client
 
 import (
-	"log"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/metrics"
 	"github.com/funny-falcon/go-iproto/net"
 )
 
@@ -22,20 +26,53 @@ type ServerConfig struct {
 	PingInterval time.Duration
 
 	RetCodeType net.RCType
+	// Protocol is a wire protocol, legacy iproto with RetCodeType if nil,
+	// see tarantool.Protocol for Tarantool 1.6+
+	Protocol net.Protocol
+
+	// BatchWindow and BatchBytes control coalescing of requests into one write,
+	// see connection.CConf
+	BatchWindow time.Duration
+	BatchBytes  int
+
+	// MaxResponseSize closes connection, if response with larger body arrives
+	MaxResponseSize int
 
 	Timeout time.Duration
+
+	// TLSConfig enables TLS, set Certificates for mutual TLS
+	TLSConfig *tls.Config
+
+	Metrics *metrics.Collector
+
+	// Logger is iproto.DefaultLogger if nil
+	Logger iproto.Logger
+	// QuietConnections logs established and closed connections with Debug level instead of Info
+	QuietConnections bool
 }
 
 var DefaultReadTimeout = 30 * time.Second
 var DefaultWriteTimeout = 30 * time.Second
 var DefaultPingInterval = 1 * time.Second
 
-func (cfg *ServerConfig) SetDefaults() *ServerConfig {
+var ErrEmptyAddress = errors.New("iproto client: empty address")
+
+// Validate checks config for errors NewServer would panic on
+func (cfg *ServerConfig) Validate() error {
 	if cfg.Address == "" {
-		log.Panic("Could not init iproto.ClientServer with empty address")
+		return ErrEmptyAddress
+	}
+	if cfg.RetCodeType > net.RC0byte {
+		return fmt.Errorf("iproto client: unknown RetCodeType %d", cfg.RetCodeType)
+	}
+	if cfg.Connections < 0 || cfg.BatchBytes < 0 || cfg.MaxResponseSize < 0 {
+		return fmt.Errorf("iproto client: negative Connections, BatchBytes or MaxResponseSize")
 	}
+	return nil
+}
 
-	if cfg.Network == "" {
+func (cfg *ServerConfig) SetDefaults() *ServerConfig {
+	if cfg.Network == "" && cfg.Address != "" {
 		/* try to predict kind of network: if we have port separator, than it is tcp :) */
 		if strings.ContainsRune(cfg.Address, ':') {
 			cfg.Network = "tcp"
@@ -0,0 +1,40 @@
+package client_test
+
+import (
+	"testing"
+
+	nt "github.com/funny-falcon/go-iproto/net"
+	"github.com/funny-falcon/go-iproto/net/client"
+)
+
+func TestValidate(t *testing.T) {
+	bad := map[string]client.ServerConfig{
+		"empty address":       {},
+		"unknown rc type":     {Address: "127.0.0.1:1", RetCodeType: nt.RC0byte + 1},
+		"negative conns":      {Address: "127.0.0.1:1", Connections: -1},
+		"negative batch":      {Address: "127.0.0.1:1", BatchBytes: -1},
+		"negative max answer": {Address: "127.0.0.1:1", MaxResponseSize: -1},
+	}
+	for name, cfg := range bad {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: config should be rejected", name)
+		}
+		if serv, err := client.New(cfg); serv != nil || err == nil {
+			t.Errorf("%s: New should return error", name)
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: NewServer should panic", name)
+				}
+			}()
+			cfg.NewServer()
+		}()
+	}
+	if err := (&client.ServerConfig{}).Validate(); err != client.ErrEmptyAddress {
+		t.Errorf("Empty address should fail with ErrEmptyAddress, got %v", err)
+	}
+	if serv, err := client.New(client.ServerConfig{Address: "127.0.0.1:1"}); serv == nil || err != nil {
+		t.Errorf("Valid config is rejected: %v", err)
+	}
+}
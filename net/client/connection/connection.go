@@ -1,10 +1,13 @@
 package connection
 
 import (
+	"crypto/tls"
+	"errors"
 	"io"
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/funny-falcon/go-iproto"
@@ -29,12 +32,58 @@ const (
 	Write
 )
 
+func (w ErrorWhen) String() string {
+	switch w {
+	case Dial:
+		return "dial"
+	case Read:
+		return "read"
+	case Write:
+		return "write"
+	}
+	return "unknown"
+}
+
 type Error struct {
 	Conn  *Connection
 	When  ErrorWhen
 	Error error
 }
 
+// Err returns connection failure as *OpError, or nil if there were no failure
+func (e Error) Err() error {
+	if e.Error == nil {
+		return nil
+	}
+	return &OpError{When: e.When, Address: e.Conn.Address, Err: e.Error}
+}
+
+// OpError is a connection failure. It matches iproto.ErrIOError with errors.Is,
+// cause requests in fly are answered with RcIOError on such failure.
+type OpError struct {
+	When    ErrorWhen
+	Address string
+	Err     error
+}
+
+func (e *OpError) Error() string {
+	return "iproto " + e.When.String() + " " + e.Address + ": " + e.Err.Error()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+func (e *OpError) Is(target error) bool {
+	return iproto.ErrIOError.Is(target)
+}
+
+// Timeout reports whether failure is caused by timeout
+func (e *OpError) Timeout() bool {
+	var t interface{ Timeout() bool }
+	return errors.As(e.Err, &t) && t.Timeout()
+}
+
 type ConnState uint32
 
 const (
@@ -56,6 +105,21 @@ type CConf struct {
 	DialTimeout  time.Duration
 
 	RetCodeType nt.RCType
+	// Protocol is nt.Legacy with RetCodeType if nil
+	Protocol nt.Protocol
+
+	TLSConfig *tls.Config
+
+	// BatchWindow delays flush of written requests while new ones arrive within window
+	// started by first unflushed request
+	BatchWindow time.Duration
+	// BatchBytes flushes batch when it reaches this size, it is also a size of write buffer
+	BatchBytes int
+	// OnBatch is called on every flush with count and size of flushed requests
+	OnBatch func(requests, bytes int)
+
+	// MaxResponseSize closes connection, if response with larger body arrives
+	MaxResponseSize int
 
 	ConnErr chan<- Error
 }
@@ -70,6 +134,12 @@ type Connection struct {
 
 	closeWrite chan bool
 	readErr    error
+	// readDone is closed when read side is closed, so writer stops without waiting for ping
+	readDone chan struct{}
+	// writing is closed when connection is established, and writeDone when writer exits
+	writing   chan struct{}
+	writeDone chan struct{}
+	batches   chan []*iproto.Request
 
 	inFly RequestHolder
 
@@ -78,8 +148,8 @@ type Connection struct {
 
 	loopNotify chan notifyAction
 
-	reader nt.HeaderReader
-	writer nt.HeaderWriter
+	reader nt.FrameReader
+	writer nt.FrameWriter
 }
 
 var _ iproto.EndPoint = (*Connection)(nil)
@@ -90,6 +160,10 @@ func NewConnection(conf *CConf, id uint64) (conn *Connection) {
 		Id:    id,
 
 		loopNotify: make(chan notifyAction, 2),
+		readDone:   make(chan struct{}),
+		writing:    make(chan struct{}),
+		writeDone:  make(chan struct{}),
+		batches:    make(chan []*iproto.Request),
 		State:      CsNew,
 	}
 	conn.inFly.init()
@@ -100,35 +174,91 @@ func NewConnection(conf *CConf, id uint64) (conn *Connection) {
 /* default 5 seconds interval for Connection */
 const DialTimeout = 5 * time.Second
 
-func (conn *Connection) Loop() {
+func (conn *Connection) dial() (nt.NetConn, error) {
 	dialer := net.Dialer{Timeout: DialTimeout}
-	conn.State = CsDialing
-	if netconn, err := dialer.Dial(conn.Network, conn.Address); err != nil {
+	if conn.DialTimeout > 0 {
+		dialer.Timeout = conn.DialTimeout
+	}
+	if conn.TLSConfig == nil {
+		netconn, err := dialer.Dial(conn.Network, conn.Address)
+		if err != nil {
+			return nil, err
+		}
+		return netconn.(nt.NetConn), nil
+	}
+
+	raw, err := dialer.Dial(conn.Network, conn.Address)
+	if err != nil {
+		return nil, err
+	}
+	cfg := conn.TLSConfig
+	if cfg.ServerName == "" && !cfg.InsecureSkipVerify {
+		cfg = cfg.Clone()
+		if host, _, err := net.SplitHostPort(conn.Address); err == nil {
+			cfg.ServerName = host
+		} else {
+			cfg.ServerName = conn.Address
+		}
+	}
+	tc := tls.Client(raw, cfg)
+	raw.SetDeadline(time.Now().Add(dialer.Timeout))
+	if err = tc.Handshake(); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	raw.SetDeadline(time.Time{})
+	return nt.NewTLSConn(tc, raw), nil
+}
+
+func (conn *Connection) Loop() {
+	conn.setState(CsDialing)
+	if netconn, err := conn.dial(); err != nil {
 		conn.ConnErr <- Error{conn, Dial, err}
-		conn.State = CsClosed
+		conn.setState(CsClosed)
 	} else {
-		conn.conn = netconn.(nt.NetConn)
-		conn.reader.Init(conn.conn, conn.ReadTimeout, conn.RetCodeType)
-		conn.writer.Init(conn.conn, conn.WriteTimeout, conn.RetCodeType)
-		if err = conn.writer.Ping(); err == nil {
-			if err = conn.writer.Flush(); err == nil {
-				err = conn.reader.ReadPing()
+		conn.conn = netconn
+		proto := conn.protocol()
+		conn.setup(proto)
+		if err = proto.Handshake(conn.conn, conn.reader, conn.DialTimeout); err == nil {
+			if err = conn.writer.Ping(); err == nil {
+				if err = conn.writer.Flush(); err == nil {
+					err = conn.reader.ReadPing()
+				}
 			}
 		}
 		if err != nil {
 			conn.conn.Close()
 			conn.ConnErr <- Error{conn, Dial, err}
-			conn.State = CsClosed
+			conn.setState(CsClosed)
 			return
 		}
+		/* so SendBatch succeeds as soon as server knows connection is established */
+		close(conn.writing)
 		conn.ConnErr <- Error{conn, Dial, nil}
-		conn.State = CsConnected
+		conn.setState(CsConnected)
 		go conn.readLoop()
 		go conn.writeLoop()
 		go conn.controlLoop()
 	}
 }
 
+// setup creates reader and writer of protocol with configured limits
+func (conn *Connection) setup(proto nt.Protocol) {
+	conn.reader = proto.NewReader(conn.conn, conn.ReadTimeout)
+	conn.writer = proto.NewWriter(conn.conn, conn.WriteTimeout)
+	conn.reader.SetMaxBody(conn.MaxResponseSize)
+	if conn.BatchBytes > 0 {
+		conn.writer.SetBufferSize(conn.BatchBytes)
+	}
+}
+
+func (conn *Connection) protocol() nt.Protocol {
+	if conn.Protocol != nil {
+		return conn.Protocol
+	}
+	return nt.Legacy{RCType: conn.RetCodeType}
+}
+
 /* RunWithConn is for testing purposes */
 func (conn *Connection) RunWithConn(netconn io.ReadWriteCloser) {
 	switch nc := netconn.(type) {
@@ -137,6 +267,8 @@ func (conn *Connection) RunWithConn(netconn io.ReadWriteCloser) {
 	default:
 		conn.conn = nt.RwcWrapper{ReadWriteCloser: netconn}
 	}
+	conn.setup(conn.protocol())
+	close(conn.writing)
 	conn.ConnErr <- Error{conn, Dial, nil}
 	go conn.readLoop()
 	go conn.writeLoop()
@@ -144,7 +276,7 @@ func (conn *Connection) RunWithConn(netconn io.ReadWriteCloser) {
 }
 
 func (conn *Connection) controlLoopExit() {
-	if conn.State&CsWriteClosed == 0 {
+	if conn.LoadState()&CsWriteClosed == 0 {
 		conn.conn.CloseWrite()
 	}
 	conn.ConnErr <- Error{conn, Read, conn.readErr}
@@ -159,23 +291,21 @@ func (conn *Connection) controlLoop() {
 
 		switch action {
 		case writeClosed:
-			conn.State &= CsClosed
-			conn.State |= CsWriteClosed
+			conn.setState(conn.LoadState()&CsClosed | CsWriteClosed)
 		case readClosed:
-			conn.State &= CsClosed
-			conn.State |= CsReadClosed
-			if conn.State&CsWriteClosed == 0 {
+			conn.setState(conn.LoadState()&CsClosed | CsReadClosed)
+			if conn.LoadState()&CsWriteClosed == 0 {
 				conn.conn.CloseWrite()
 			}
 		case readEmpty:
 		}
 
-		if conn.State&CsWriteClosed != 0 {
+		if state := conn.LoadState(); state&CsWriteClosed != 0 {
 			if !closeReadCalled && conn.inFly.count() == 0 {
 				conn.conn.CloseRead()
 				closeReadCalled = true
 			}
-			if conn.State&CsReadClosed != 0 {
+			if state&CsReadClosed != 0 {
 				break
 			}
 		}
@@ -184,7 +314,7 @@ func (conn *Connection) controlLoop() {
 
 func (conn *Connection) flushInFly() {
 	reqs := conn.inFly.getAll()
-	conn.inFly = RequestHolder{}
+	conn.inFly.reset()
 
 	code := iproto.RcIOError
 	if conn.shutdown {
@@ -206,9 +336,16 @@ func (conn *Connection) readLoop() {
 	r := conn.reader
 
 	defer conn.notifyLoop(readClosed)
+	defer close(conn.readDone)
 
 	for {
 		if res, conn.readErr = r.ReadResponse(); conn.readErr != nil {
+			/* request of too large response is failed precisely, others are failed on close */
+			if tl, ok := conn.readErr.(*nt.FrameTooLarge); ok && tl.Id != 0 && tl.Id != iproto.PingRequestId {
+				if ireq := conn.inFly.remove(tl.Id); ireq != nil {
+					ireq.RespondFail(iproto.RcProtocolError)
+				}
+			}
 			break
 		}
 
@@ -219,7 +356,7 @@ func (conn *Connection) readLoop() {
 		if ireq := conn.inFly.remove(res.Id); ireq != nil {
 			ireq.RespondBytes(res.Code, res.Body)
 		}
-		if conn.State&CsWriteClosed != 0 && conn.inFly.put >= conn.inFly.got {
+		if conn.LoadState()&CsWriteClosed != 0 && conn.inFly.count() == 0 {
 			conn.notifyLoop(readEmpty)
 		}
 	}
@@ -229,6 +366,8 @@ const fakePingInterval = 1 * time.Hour
 
 func (conn *Connection) writeLoop() {
 	var err error
+	var batch, batchBytes int
+	var batchEnd time.Time
 	var pingTicker *time.Ticker
 
 	w := conn.writer
@@ -241,9 +380,10 @@ func (conn *Connection) writeLoop() {
 	}
 
 	defer func() {
+		close(conn.writeDone)
 		pingTicker.Stop()
 		if err == nil {
-			if err = w.Flush(); err == nil {
+			if err = conn.flush(w, batch, batchBytes); err == nil {
 				conn.conn.CloseWrite()
 			}
 		}
@@ -252,12 +392,53 @@ func (conn *Connection) writeLoop() {
 	}()
 
 	var req *Request
+	/* write writes request in fly and flushes batch when it reaches BatchBytes */
+	write := func(request *iproto.Request) error {
+		if req == nil {
+			req = conn.inFly.getNext(conn)
+		}
+		if !request.SetInFly(req) {
+			return nil
+		}
+		request.Lock()
+		if !request.IsInFly() {
+			request.Unlock()
+			return nil
+		}
+		requestHeader := nt.Request{
+			Msg:  request.Msg,
+			Id:   req.fakeId,
+			Body: request.Body,
+		}
+		request.Unlock()
+
+		req = nil
+
+		written := w.Written()
+		if err := w.WriteRequest(requestHeader); err != nil {
+			return err
+		}
+		if batch == 0 && conn.BatchWindow > 0 {
+			batchEnd = time.Now().Add(conn.BatchWindow)
+		}
+		batch++
+		batchBytes += int(w.Written() - written)
+		if conn.BatchBytes > 0 && batchBytes >= conn.BatchBytes {
+			err := conn.flush(w, batch, batchBytes)
+			batch, batchBytes = 0, 0
+			return err
+		}
+		return nil
+	}
+
+	window := time.NewTimer(fakePingInterval)
+	window.Stop()
 
 Loop:
 	for {
 		var request *iproto.Request
+		var requests []*iproto.Request
 		var ping bool
-		var requestHeader nt.Request
 
 		if conn.Stopped() {
 			conn.shutdown = true
@@ -266,44 +447,52 @@ Loop:
 
 		select {
 		case request = <-conn.ReceiveChan():
+		case requests = <-conn.batches:
 		default:
-			if err = w.Flush(); err != nil {
+			if batch > 0 && conn.BatchWindow > 0 {
+				var exit bool
+				if request, requests, exit = conn.waitBatch(window, batchEnd); exit {
+					conn.shutdown = true
+					break Loop
+				}
+			}
+			if request != nil || requests != nil {
+				break
+			}
+			if err = conn.flush(w, batch, batchBytes); err != nil {
 				break Loop
 			}
+			batch, batchBytes = 0, 0
 			select {
 			case <-pingTicker.C:
 				ping = true
 			case request = <-conn.ReceiveChan():
+			case requests = <-conn.batches:
 			case <-conn.ExitChan():
 				conn.shutdown = true
 				break Loop
+			case <-conn.readDone:
+				break Loop
 			}
 		}
 
-		if ping {
+		switch {
+		case ping:
 			err = w.Ping()
-		} else {
-			if req == nil {
-				req = conn.inFly.getNext(conn)
-			}
-			if !request.SetInFly(req) {
-				continue
-			}
-			request.Lock()
-			if !request.IsInFly() {
-				request.Unlock()
-				continue
-			}
-			requestHeader = nt.Request{
-				Msg:  request.Msg,
-				Id:   req.fakeId,
-				Body: request.Body,
+		case requests != nil:
+			for i, request := range requests {
+				if !request.SetPending() {
+					continue
+				}
+				if err = write(request); err != nil {
+					for _, rest := range requests[i+1:] {
+						rest.IOError()
+					}
+					break
+				}
 			}
-			request.Unlock()
-
-			req = nil
-
-			err = w.WriteRequest(requestHeader)
+		default:
+			err = write(request)
 		}
 		if err != nil {
 			break
@@ -311,8 +500,52 @@ Loop:
 	}
 }
 
+// waitBatch waits for next request or batch until batch window ends
+func (conn *Connection) waitBatch(window *time.Timer, end time.Time) (request *iproto.Request, requests []*iproto.Request, exit bool) {
+	wait := end.Sub(time.Now())
+	if wait <= 0 {
+		return
+	}
+	window.Reset(wait)
+	select {
+	case request = <-conn.ReceiveChan():
+	case requests = <-conn.batches:
+	case <-window.C:
+		return
+	case <-conn.ExitChan():
+		exit = true
+	}
+	if !window.Stop() {
+		<-window.C
+	}
+	return
+}
+
+// SendBatch passes new requests to writer at once, so they are written together before next flush.
+// It returns false without touching requests, if connection is not established or is closed.
+func (conn *Connection) SendBatch(reqs []*iproto.Request) bool {
+	select {
+	case <-conn.writing:
+	default:
+		return false
+	}
+	select {
+	case conn.batches <- reqs:
+		return true
+	case <-conn.writeDone:
+		return false
+	}
+}
+
+func (conn *Connection) flush(w nt.FrameWriter, requests, bytes int) error {
+	if requests > 0 && conn.OnBatch != nil {
+		conn.OnBatch(requests, bytes)
+	}
+	return w.Flush()
+}
+
 func (conn *Connection) Closed() bool {
-	return conn.State&CsClosed != 0
+	return conn.LoadState()&CsClosed != 0
 }
 
 func (conn *Connection) LocalAddr() net.Addr {
@@ -322,3 +555,20 @@ func (conn *Connection) LocalAddr() net.Addr {
 func (conn *Connection) RemoteAddr() net.Addr {
 	return conn.conn.RemoteAddr()
 }
+
+func (conn *Connection) Connected() bool {
+	return conn.LoadState() == CsConnected
+}
+
+// LoadState reads State atomically, State is changed by goroutines of connection
+func (conn *Connection) LoadState() ConnState {
+	return ConnState(atomic.LoadUint32((*uint32)(&conn.State)))
+}
+
+func (conn *Connection) setState(state ConnState) {
+	atomic.StoreUint32((*uint32)(&conn.State), uint32(state))
+}
+
+func (conn *Connection) InFlight() int {
+	return int(conn.inFly.count())
+}
@@ -0,0 +1,208 @@
+package connection_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	nt "github.com/funny-falcon/go-iproto/net"
+	"github.com/funny-falcon/go-iproto/net/client/connection"
+	"github.com/funny-falcon/go-iproto/net/iprototest"
+	"github.com/funny-falcon/go-iproto/tarantool"
+)
+
+const msgTest = iproto.RequestType(31)
+
+// batches records calls of OnBatch
+type batches struct {
+	sync.Mutex
+	got [][2]int
+}
+
+func (b *batches) add(requests, bytes int) {
+	b.Lock()
+	b.got = append(b.got, [2]int{requests, bytes})
+	b.Unlock()
+}
+
+func (b *batches) all() [][2]int {
+	b.Lock()
+	defer b.Unlock()
+	return append([][2]int(nil), b.got...)
+}
+
+// pipeLoop runs connection over already established net.Conn
+type pipeLoop struct {
+	conn *connection.Connection
+	nc   net.Conn
+}
+
+func (p pipeLoop) Loop() {
+	p.conn.RunWithConn(p.nc)
+}
+
+func runConn(t *testing.T, conf *connection.CConf, nc net.Conn) (*connection.Connection, *batches, <-chan connection.Error) {
+	var b batches
+	conf.OnBatch = b.add
+	errs := make(chan connection.Error, 16)
+	conf.ConnErr = errs
+	conn := connection.NewConnection(conf, 1)
+	conn.Init(pipeLoop{conn, nc})
+	conn.Timeout = time.Second
+	iproto.Run(conn)
+	if e := <-errs; e.When != connection.Dial || e.Error != nil {
+		t.Fatalf("Connection is not established %+v", e)
+	}
+	t.Cleanup(func() { nc.Close() })
+	return conn, &b, errs
+}
+
+func sendN(conn iproto.Service, n int, body []byte) (reses []iproto.Chan) {
+	for i := 0; i < n; i++ {
+		_, res := iproto.SendMsgBody(conn, msgTest, iproto.Body(body))
+		reses = append(reses, res)
+	}
+	return
+}
+
+func TestFlushByWindow(t *testing.T) {
+	srv, nc := iprototest.Pipe(nt.RC4byte)
+	defer srv.Close()
+	conn, b, _ := runConn(t, &connection.CConf{RetCodeType: nt.RC4byte, BatchWindow: 100 * time.Millisecond}, nc)
+
+	for _, res := range sendN(conn, 3, []byte("abcd")) {
+		if r := <-res; r.Code != iproto.RcOK {
+			t.Fatalf("Request failed with %x", r.Code)
+		}
+	}
+	if got := b.all(); len(got) != 1 || got[0] != [2]int{3, 3 * 16} {
+		t.Errorf("Requests within window should be flushed at once, got %v", got)
+	}
+}
+
+func TestFlushByBytes(t *testing.T) {
+	srv, nc := iprototest.Pipe(nt.RC4byte)
+	defer srv.Close()
+	conf := &connection.CConf{RetCodeType: nt.RC4byte, BatchWindow: time.Second, BatchBytes: 64}
+	conn, b, _ := runConn(t, conf, nc)
+
+	start := time.Now()
+	for _, res := range sendN(conn, 4, make([]byte, 20)) {
+		if r := <-res; r.Code != iproto.RcOK {
+			t.Fatalf("Request failed with %x", r.Code)
+		}
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Full batch should not wait for window end, waited %v", d)
+	}
+	if got := b.all(); len(got) != 2 || got[0] != [2]int{2, 64} || got[1] != [2]int{2, 64} {
+		t.Errorf("Batches should be flushed by size, got %v", got)
+	}
+}
+
+func TestSendBatch(t *testing.T) {
+	srv, nc := iprototest.Pipe(nt.RC4byte)
+	defer srv.Close()
+	conn, b, errs := runConn(t, &connection.CConf{RetCodeType: nt.RC4byte}, nc)
+
+	var reqs []*iproto.Request
+	var reses []iproto.Chan
+	for i := 0; i < 3; i++ {
+		res := make(iproto.Chan, 1)
+		reqs = append(reqs, &iproto.Request{Msg: msgTest, Body: []byte("ab"), Responder: res})
+		reses = append(reses, res)
+	}
+	if !conn.SendBatch(reqs) {
+		t.Fatalf("Established connection should accept batch")
+	}
+	for _, res := range reses {
+		if r := <-res; r.Code != iproto.RcOK {
+			t.Fatalf("Request failed with %x", r.Code)
+		}
+	}
+	if got := b.all(); len(got) != 1 || got[0] != [2]int{3, 3 * 14} {
+		t.Errorf("Batch should be flushed at once, got %v", got)
+	}
+
+	nc.Close()
+	if e := <-errs; e.When != connection.Write {
+		t.Fatalf("Write side should be closed, got %+v", e)
+	}
+	if conn.SendBatch(reqs) {
+		t.Errorf("Closed connection should not accept batch")
+	}
+	notRunned := connection.NewConnection(&connection.CConf{}, 2)
+	if notRunned.SendBatch(reqs) {
+		t.Errorf("Not established connection should not accept batch")
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	srv, nc := iprototest.Pipe(nt.RC4byte)
+	defer srv.Close()
+	srv.Script(msgTest, iprototest.Reply{NoReply: true}, iprototest.Reply{Body: make([]byte, 100)})
+	conn, _, _ := runConn(t, &connection.CConf{RetCodeType: nt.RC4byte, MaxResponseSize: 10}, nc)
+
+	_, waiting := iproto.SendMsgBody(conn, msgTest, nil)
+	if !srv.Wait(1, time.Second) {
+		t.Fatalf("Request is not received")
+	}
+	if res := iproto.CallMsgBody(conn, msgTest, nil); res.Code != iproto.RcProtocolError {
+		t.Errorf("Request of too large response should fail with RcProtocolError, got %x", res.Code)
+	}
+	if res := <-waiting; res.Code != iproto.RcIOError {
+		t.Errorf("Too large response should close connection, got %x", res.Code)
+	}
+}
+
+func TestBatchBytesOfProtocol(t *testing.T) {
+	proto := &tarantool.Protocol{}
+	var expect bytes.Buffer
+	w := proto.NewWriter(&expect, 0)
+	w.WriteRequest(nt.Request{Msg: msgTest, Id: 1, Body: []byte("abcd")})
+	w.Flush()
+
+	cli, srv := net.Pipe()
+	defer srv.Close()
+	go io.Copy(io.Discard, srv)
+	conn, b, _ := runConn(t, &connection.CConf{Protocol: proto}, cli)
+	conn.Timeout = 50 * time.Millisecond
+
+	if res := iproto.CallMsgBody(conn, msgTest, iproto.Body("abcd")); res.Code != iproto.RcTimeout {
+		t.Fatalf("Request without answer should time out, got %x", res.Code)
+	}
+	if got := b.all(); len(got) != 1 || got[0] != [2]int{1, expect.Len()} {
+		t.Errorf("Batch bytes should be size of tarantool frame %d, got %v", expect.Len(), got)
+	}
+}
+
+func TestOpError(t *testing.T) {
+	conn := connection.NewConnection(&connection.CConf{Address: "127.0.0.1:1"}, 1)
+	if err := (connection.Error{Conn: conn, When: connection.Read}).Err(); err != nil {
+		t.Errorf("Error without failure should be nil, got %v", err)
+	}
+
+	err := connection.Error{Conn: conn, When: connection.Write, Error: os.ErrDeadlineExceeded}.Err()
+	var op *connection.OpError
+	if !errors.As(err, &op) || op.When != connection.Write || op.Address != "127.0.0.1:1" {
+		t.Fatalf("Failure should be *OpError, got %#v", err)
+	}
+	if !errors.Is(err, iproto.ErrIOError) || !iproto.IsInternal(err) || errors.Is(err, iproto.ErrTimeout) {
+		t.Errorf("OpError should match ErrIOError")
+	}
+	if !errors.Is(err, os.ErrDeadlineExceeded) || !op.Timeout() {
+		t.Errorf("OpError should unwrap to cause and report timeout")
+	}
+	if msg := err.Error(); msg != "iproto write 127.0.0.1:1: "+os.ErrDeadlineExceeded.Error() {
+		t.Errorf("Wrong message %q", msg)
+	}
+	if op = (&connection.OpError{When: connection.Dial, Err: io.EOF}); op.Timeout() {
+		t.Errorf("EOF is not a timeout")
+	}
+}
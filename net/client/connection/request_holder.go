@@ -45,7 +45,7 @@ func (h *RequestHolder) init() {
 }
 
 func (h *RequestHolder) getNext(conn *Connection) (req *Request) {
-	h.got++
+	atomic.AddUint64(&h.got, 1)
 	for {
 		id := atomic.AddUint32(&h.curId, 1)
 		big := id >> rowLogN
@@ -96,14 +96,14 @@ func (h *RequestHolder) remove(fakeId uint32) (ireq *iproto.Request) {
 	ireq = req.Request
 	req.Unlock()
 
-	h.put++
+	atomic.AddUint64(&h.put, 1)
 	return
 }
 
 func (h *RequestHolder) getAll() (reqs []*Request) {
 	h.Lock()
 	defer h.Unlock()
-	reqs = make([]*Request, h.got-h.put)
+	reqs = make([]*Request, h.count())
 	i := 0
 	for _, row := range h.reqs {
 		for j := range row.reqs {
@@ -118,6 +118,17 @@ func (h *RequestHolder) getAll() (reqs []*Request) {
 	return
 }
 
+// reset forgets all requests, counters are zeroed atomically, since count is called concurrently
+func (h *RequestHolder) reset() {
+	h.Lock()
+	h.reqs, h.cur, h.last = nil, nil, nil
+	h.big, h.lastBig = 0, 0
+	atomic.StoreUint32(&h.curId, 0)
+	h.Unlock()
+	atomic.StoreUint64(&h.put, 0)
+	atomic.StoreUint64(&h.got, 0)
+}
+
 func (h *RequestHolder) count() uint {
 	put := atomic.LoadUint64(&h.put)
 	got := atomic.LoadUint64(&h.got)
@@ -1,10 +1,14 @@
 package client
 
 import (
+	"io"
 	"log"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/metrics"
 	"github.com/funny-falcon/go-iproto/net/client/connection"
 )
 
@@ -39,7 +43,8 @@ type Server struct {
 	curId       uint64
 	needConns   int
 	dialing     int
-	established int
+	// established is changed by loop only, but read with AnyConnected from other goroutines
+	established int32
 	dying       int
 
 	connErr     chan connection.Error
@@ -48,11 +53,38 @@ type Server struct {
 	lastErrTime time.Time
 
 	reconnecter *time.Ticker
+	lastErr     atomic.Value
+	// conns is a copy of connections published by loop for InFlight and SendBatch
+	conns     atomic.Value
+	nextBatch uint32
+
+	metrics *metrics.Collector
+	stat    iproto.Service
+
+	logger iproto.Logger
+	quiet  bool
 }
 
 var _ iproto.EndPoint = (*Server)(nil)
 
-func (cfg ServerConfig) NewServer() (serv *Server) {
+// New validates config and creates server
+func New(cfg ServerConfig) (*Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg.newServer(), nil
+}
+
+// NewServer panics on invalid config, use New to get an error instead
+func (cfg ServerConfig) NewServer() *Server {
+	serv, err := New(cfg)
+	if err != nil {
+		log.Panic(err)
+	}
+	return serv
+}
+
+func (cfg ServerConfig) newServer() (serv *Server) {
 	cfg.SetDefaults()
 
 	serv = &Server{
@@ -72,38 +104,114 @@ func (cfg ServerConfig) NewServer() (serv *Server) {
 				ReadTimeout:  cfg.ReadTimeout,
 				WriteTimeout: cfg.WriteTimeout,
 				RetCodeType:  cfg.RetCodeType,
+				TLSConfig:    cfg.TLSConfig,
+				Protocol:     cfg.Protocol,
+				BatchWindow:  cfg.BatchWindow,
+				BatchBytes:   cfg.BatchBytes,
+
+				MaxResponseSize: cfg.MaxResponseSize,
 			},
 		},
 		connErr:     make(chan connection.Error, 4),
 		actions:     make(chan action, 1),
 		connections: make(map[uint64]*connection.Connection),
+		logger:      cfg.Logger,
+		quiet:       cfg.QuietConnections,
+	}
+	if serv.logger == nil {
+		serv.logger = iproto.DefaultLogger
 	}
 
 	serv.SimplePoint.Init(serv)
 	serv.ConnErr = serv.connErr
 
+	if cfg.Metrics != nil {
+		serv.metrics = cfg.Metrics
+		serv.stat = cfg.Metrics.Wrap(metrics.Client, cfg.Name, point{serv})
+		cfg.Metrics.TrackQueue(metrics.Client, cfg.Name, serv.QueueLen)
+		name := cfg.Name
+		serv.OnBatch = func(requests, bytes int) {
+			cfg.Metrics.ObserveBatch(name, requests, bytes)
+		}
+	}
+
 	return
 }
 
+func (serv *Server) Send(r *iproto.Request) {
+	if serv.stat != nil {
+		serv.stat.Send(r)
+	} else {
+		serv.SimplePoint.Send(r)
+	}
+}
+
+// SendBatch writes requests with one connection before its next flush.
+// If there is no established connection, requests are sent one by one.
+func (serv *Server) SendBatch(reqs []*iproto.Request) {
+	if serv.stat != nil {
+		iproto.SendBatch(serv.stat, reqs)
+	} else {
+		serv.sendBatch(reqs)
+	}
+}
+
+func (serv *Server) sendBatch(reqs []*iproto.Request) {
+	if len(reqs) == 0 {
+		return
+	}
+	for _, r := range reqs {
+		r.Lock()
+		r.SetTimeout(serv.Timeout)
+		r.Unlock()
+	}
+	conns, _ := serv.conns.Load().([]*connection.Connection)
+	if n := len(conns); n > 0 {
+		start := int(atomic.AddUint32(&serv.nextBatch, 1))
+		for i := 0; i < n; i++ {
+			if conns[(start+i)%n].SendBatch(reqs) {
+				return
+			}
+		}
+	}
+	for _, r := range reqs {
+		serv.SimplePoint.Send(r)
+	}
+}
+
+// point sends requests wrapped with stat directly to connections
+type point struct {
+	*Server
+}
+
+func (p point) Send(r *iproto.Request) {
+	p.SimplePoint.Send(r)
+}
+
+func (p point) SendBatch(reqs []*iproto.Request) {
+	p.sendBatch(reqs)
+}
+
 func (serv *Server) fixConnections() {
-	needConn := serv.needConns - (serv.dialing + serv.established)
+	needConn := serv.needConns - (serv.dialing + int(serv.established))
 	for ; needConn > 0; needConn-- {
 		serv.curId++
 		conn := connection.NewConnection(&serv.CConf, serv.curId)
 		serv.connections[serv.curId] = conn
 		serv.RunChild(conn)
 		serv.dialing++
+		serv.publishConns()
 	}
 	if needConn < 0 {
 		for _, conn := range serv.connections {
-			switch conn.State {
+			switch conn.LoadState() {
 			case connection.CsDialing:
 				conn.Stop()
 				serv.dialing--
 				needConn++
 			case connection.CsConnected:
 				conn.Stop()
-				serv.established--
+				atomic.AddInt32(&serv.established, -1)
 				needConn++
 			}
 			if needConn == 0 {
@@ -134,7 +242,7 @@ func (serv *Server) Loop() {
 			serv.fixConnections()
 		}
 
-		if serv.exiting && serv.established+serv.dialing == 0 {
+		if serv.exiting && int(serv.established)+serv.dialing == 0 {
 			serv.reconnecter.Stop()
 			break
 		}
@@ -149,42 +257,82 @@ func (serv *Server) onAction(action action) {
 	}
 }
 
+// LastError returns last connection failure as *connection.OpError, or nil
+func (serv *Server) LastError() error {
+	err, _ := serv.lastErr.Load().(error)
+	return err
+}
+
 func (serv *Server) onConnError(connErr connection.Error) {
 	conn := connErr.Conn
+	if err := connErr.Err(); err != nil && connErr.Error != io.EOF {
+		serv.lastErr.Store(err)
+	}
 	switch connErr.When {
 	case connection.Dial:
 		serv.dialing--
 		if connErr.Error == nil {
-			log.Printf("%s: established connection %v -> %v", serv.conf.Name, conn.LocalAddr(), conn.RemoteAddr())
-			serv.established++
+			serv.logConn("Established", conn)
+			atomic.AddInt32(&serv.established, 1)
+			if serv.metrics != nil {
+				serv.metrics.Connected(serv.conf.Name)
+				serv.metrics.TrackInFlight(metrics.Client, serv.conf.Name, strconv.FormatUint(conn.Id, 10), conn.InFlight)
+			}
 		} else {
+			if serv.metrics != nil {
+				serv.metrics.ConnError(serv.conf.Name, connErr.When.String())
+			}
 			now := time.Now()
 			if now.Sub(serv.lastErrTime) > 2*time.Second {
 				serv.lastErrTime = now
-				log.Printf("%s: could not connect to %s", serv.conf.Name, serv.conf.Address)
+				serv.logger.Warn("Could not connect", "server", serv.conf.Name, "conn", conn.Id, "err", connErr.Err())
 			}
 			if _, ok := serv.connections[conn.Id]; !ok {
 				log.Panicf("Unknown connection failed %+v", conn)
 			}
 			delete(serv.connections, conn.Id)
+			serv.publishConns()
 			if serv.established == 0 && serv.Standalone() {
 				serv.AllDisconnected()
 			}
 		}
 	case connection.Write:
-		log.Printf("%s: write side closed %v -> %v", serv.conf.Name, conn.LocalAddr(), conn.RemoteAddr())
-		serv.established--
+		serv.logConn("Write side closed", conn, "err", connErr.Error)
+		if serv.metrics != nil && connErr.Error != nil {
+			serv.metrics.ConnError(serv.conf.Name, connErr.When.String())
+		}
+		atomic.AddInt32(&serv.established, -1)
 		serv.dying++
 		if serv.established == 0 && serv.Standalone() {
 			serv.AllDisconnected()
 		}
 	case connection.Read:
-		log.Printf("%s: read side closed %v -> %v", serv.conf.Name, conn.LocalAddr(), conn.RemoteAddr())
+		if connErr.Error != nil && connErr.Error != io.EOF {
+			serv.logger.Warn("Read side closed", "server", serv.conf.Name, "conn", conn.Id, "remote", conn.RemoteAddr(), "err", connErr.Error)
+		} else {
+			serv.logConn("Read side closed", conn, "err", connErr.Error)
+		}
 		serv.dying--
+		if serv.metrics != nil {
+			if connErr.Error != nil && connErr.Error != io.EOF {
+				serv.metrics.ConnError(serv.conf.Name, connErr.When.String())
+			}
+			serv.metrics.UntrackInFlight(metrics.Client, serv.conf.Name, strconv.FormatUint(conn.Id, 10))
+		}
 		if _, ok := serv.connections[conn.Id]; !ok {
 			log.Panicf("Unknown connection failed %+v", conn)
 		}
 		delete(serv.connections, conn.Id)
+		serv.publishConns()
+	}
+}
+
+func (serv *Server) logConn(msg string, conn *connection.Connection, args ...any) {
+	args = append([]any{"server", serv.conf.Name, "conn", conn.Id, "local", conn.LocalAddr(), "remote", conn.RemoteAddr()}, args...)
+	if serv.quiet {
+		serv.logger.Debug(msg, args...)
+	} else {
+		serv.logger.Info(msg, args...)
 	}
 }
 
@@ -208,6 +356,27 @@ Loop:
 	}
 }
 
+func (serv *Server) publishConns() {
+	conns := make([]*connection.Connection, 0, len(serv.connections))
+	for _, conn := range serv.connections {
+		conns = append(conns, conn)
+	}
+	serv.conns.Store(conns)
+}
+
+// InFlight is a count of requests sent by all connections and waiting for response
+func (serv *Server) InFlight() (n int) {
+	conns, _ := serv.conns.Load().([]*connection.Connection)
+	for _, conn := range conns {
+		n += conn.InFlight()
+	}
+	return
+}
+
 func (serv *Server) AnyConnected() bool {
-	return serv.established > 0
+	return atomic.LoadInt32(&serv.established) > 0
+}
+
+func (serv *Server) Connected() bool {
+	return serv.AnyConnected()
 }
@@ -0,0 +1,184 @@
+package client_test
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/metrics"
+	nt "github.com/funny-falcon/go-iproto/net"
+	"github.com/funny-falcon/go-iproto/net/client"
+	"github.com/funny-falcon/go-iproto/net/client/connection"
+	"github.com/funny-falcon/go-iproto/net/iprototest"
+)
+
+type batchData struct {
+	N uint32
+}
+
+func (batchData) IMsg() iproto.RequestType { return msgRead }
+
+func TestCallBatch(t *testing.T) {
+	srv := iprototest.NewServer(nt.RC4byte)
+	defer srv.Close()
+	srv.Script(msgRead, iprototest.Reply{Code: 0x102})
+
+	var c metrics.Collector
+	cfg := srv.Config()
+	cfg.Name = "cli"
+	cfg.Metrics = &c
+	cli := cfg.NewServer()
+	iproto.Run(cli)
+	defer cli.Stop()
+	for start := time.Now(); !cli.AnyConnected(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Client is not connected")
+		}
+	}
+
+	const n = 200
+	reqs := make([]iproto.RequestData, n)
+	for i := range reqs {
+		reqs[i] = batchData{uint32(i)}
+	}
+	ress := iproto.CallBatch(cli, reqs)
+	if len(ress) != n || ress[0].Code != 0x102 || ress[1].Code != iproto.RcOK || ress[n-1].Code != iproto.RcOK {
+		t.Fatalf("Wrong batch results %+v", ress)
+	}
+	if got := srv.RequestsOf(msgRead); len(got) != n {
+		t.Errorf("Server received %d requests, expect %d", len(got), n)
+	}
+	var flushes, counted int
+	c.Each(func(s metrics.Sample) {
+		switch s.Name {
+		case "iproto_client_batch_requests":
+			flushes = int(s.Count)
+			if s.Value != n {
+				t.Errorf("Batch has %v requests, expect %d", s.Value, n)
+			}
+		case "iproto_requests_total":
+			counted += int(s.Value)
+		}
+	})
+	if flushes != 1 {
+		t.Errorf("Batch should be written with one flush, got %d flushes", flushes)
+	}
+	if counted != n {
+		t.Errorf("Metrics counted %d requests of batch, expect %d", counted, n)
+	}
+}
+
+func TestLastError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	cli := (&client.ServerConfig{Address: addr, Timeout: time.Second, Logger: iproto.NopLogger{}}).NewServer()
+	if cli.LastError() != nil {
+		t.Errorf("New server should have no error")
+	}
+	iproto.Run(cli)
+	defer cli.Stop()
+	for start := time.Now(); cli.LastError() == nil; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Dial failure is not recorded")
+		}
+	}
+	err = cli.LastError()
+	var op *connection.OpError
+	if !errors.As(err, &op) || op.When != connection.Dial || op.Address != addr {
+		t.Errorf("Last error should be *OpError of dial, got %#v", err)
+	}
+	if !errors.Is(err, iproto.ErrIOError) {
+		t.Errorf("Dial failure should match ErrIOError")
+	}
+	if res := iproto.CallMsgBody(cli, msgRead, nil); !errors.Is(res.Err(), iproto.ErrIOError) {
+		t.Errorf("Request to disconnected server should fail with RcIOError, got %x", res.Code)
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	srv := iprototest.NewServer(nt.RC4byte)
+	defer srv.Close()
+	srv.Script(msgRead, iprototest.Reply{Body: make([]byte, 100)})
+
+	cfg := srv.Config()
+	cfg.MaxResponseSize = 10
+	cli := cfg.NewServer()
+	iproto.Run(cli)
+	defer cli.Stop()
+
+	if res := iproto.CallMsgBody(cli, msgRead, nil); res.Code != iproto.RcProtocolError {
+		t.Errorf("Request of too large response should fail with RcProtocolError, got %x", res.Code)
+	}
+	var tl *nt.FrameTooLarge
+	for start := time.Now(); !errors.As(cli.LastError(), &tl); time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Last error should be FrameTooLarge, got %v", cli.LastError())
+		}
+	}
+	if tl.Msg != msgRead || tl.Size != 104 || tl.Max != 10 {
+		t.Errorf("Wrong frame error %+v", tl)
+	}
+}
+
+// logger records messages with level
+type logger struct {
+	sync.Mutex
+	events []string
+}
+
+func (l *logger) add(level, msg string) {
+	l.Lock()
+	l.events = append(l.events, level+" "+msg)
+	l.Unlock()
+}
+
+func (l *logger) String() string {
+	l.Lock()
+	defer l.Unlock()
+	return strings.Join(l.events, ",")
+}
+
+func (l *logger) Debug(msg string, args ...any) { l.add("DEBUG", msg) }
+func (l *logger) Info(msg string, args ...any)  { l.add("INFO", msg) }
+func (l *logger) Warn(msg string, args ...any)  { l.add("WARN", msg) }
+func (l *logger) Error(msg string, args ...any) { l.add("ERROR", msg) }
+
+func TestQuietConnections(t *testing.T) {
+	for _, quiet := range []bool{false, true} {
+		srv := iprototest.NewServer(nt.RC4byte)
+		var log logger
+		cfg := srv.Config()
+		cfg.Logger = &log
+		cfg.QuietConnections = quiet
+		cli := cfg.NewServer()
+		iproto.Run(cli)
+		if res := iproto.CallMsgBody(cli, msgRead, nil); res.Code != iproto.RcOK {
+			t.Fatalf("Request failed %x", res.Code)
+		}
+		srv.Close()
+		for start := time.Now(); !strings.Contains(log.String(), "Write side closed"); time.Sleep(time.Millisecond) {
+			if time.Since(start) > time.Second {
+				t.Fatalf("Closed connection is not logged: %s", log.String())
+			}
+		}
+		cli.Stop()
+
+		level, other := "INFO", "DEBUG"
+		if quiet {
+			level, other = other, level
+		}
+		ev := log.String()
+		if !strings.HasPrefix(ev, level+" Established,") || !strings.Contains(ev, level+" Write side closed") || strings.Contains(ev, other+" Write side closed") {
+			t.Errorf("Connections should be logged with %s level when QuietConnections is %v: %s", level, quiet, ev)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package net
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"time"
 
@@ -19,9 +20,22 @@ type Request struct {
 
 type Response iproto.Response
 
+// FrameTooLarge is returned by HeaderReader, when body length in header exceeds maximum
+type FrameTooLarge struct {
+	Msg  iproto.RequestType
+	Id   uint32
+	Size uint32
+	Max  int
+}
+
+func (e *FrameTooLarge) Error() string {
+	return fmt.Sprintf("iproto: frame body %d exceeds maximum %d (msg %d, id %d)", e.Size, e.Max, e.Msg, e.Id)
+}
+
 type HeaderReader struct {
-	r  SliceReader
-	rc RCType
+	r       SliceReader
+	rc      RCType
+	maxBody int
 }
 
 func (h *HeaderReader) Init(conn io.Reader, timeout time.Duration, rc RCType) {
@@ -29,6 +43,23 @@ func (h *HeaderReader) Init(conn io.Reader, timeout time.Duration, rc RCType) {
 	h.rc = rc
 }
 
+// SetMaxBody limits body length of frames, zero means no limit
+func (h *HeaderReader) SetMaxBody(max int) {
+	h.maxBody = max
+}
+
+func (h *HeaderReader) checkBody(head []byte, body_len uint32) error {
+	if h.maxBody > 0 && uint64(body_len) > uint64(h.maxBody) {
+		return &FrameTooLarge{
+			Msg:  iproto.RequestType(bin_le.Uint32(head[:4])),
+			Id:   bin_le.Uint32(head[8:12]),
+			Size: body_len,
+			Max:  h.maxBody,
+		}
+	}
+	return nil
+}
+
 func (h *HeaderReader) ReadRequest() (req Request, err error) {
 	var head, body []byte
 	if head, err = h.r.Read(12); err != nil {
@@ -36,6 +67,9 @@ func (h *HeaderReader) ReadRequest() (req Request, err error) {
 	}
 
 	body_len := bin_le.Uint32(head[4:8])
+	if err = h.checkBody(head, body_len); err != nil {
+		return
+	}
 	if body, err = h.r.Read(int(body_len)); err != nil {
 		return
 	}
@@ -59,6 +93,9 @@ func (h *HeaderReader) ReadResponse() (res Response, err error) {
 
 	msg := iproto.RequestType(bin_le.Uint32(head[:4]))
 	body_len := bin_le.Uint32(head[4:8])
+	if err = h.checkBody(head, body_len); err != nil {
+		return
+	}
 
 	if msg != iproto.Ping {
 		switch h.rc {
@@ -165,13 +202,13 @@ func (h *HeaderWriter) WriteResponse(res Response) (err error) {
 		return
 	}
 
-	switch h.rc {
-	case RC0byte:
-	case RC1byte:
+	switch {
+	case retCodeLen == 0:
+	case h.rc == RC1byte:
 		if err = h.w.WriteByte(byte(res.Code)); err != nil {
 			return
 		}
-	case RC4byte:
+	case h.rc == RC4byte:
 		if err = h.w.WriteUint32(uint32(res.Code)); err != nil {
 			return
 		}
@@ -183,6 +220,19 @@ func (h *HeaderWriter) WriteResponse(res Response) (err error) {
 	return
 }
 
+// SetBufferSize sets size of write buffer, it should be called before first write
+func (h *HeaderWriter) SetBufferSize(size int) {
+	h.w.SetSize(size)
+}
+
+func (h *HeaderWriter) Buffered() int {
+	return h.w.Buffered()
+}
+
+func (h *HeaderWriter) Written() int64 {
+	return h.w.Written()
+}
+
 func (h *HeaderWriter) Flush() error {
 	return h.w.Flush()
 }
@@ -0,0 +1,113 @@
+package net
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/funny-falcon/go-iproto"
+)
+
+func writeResponses(t *testing.T, rc RCType, ress ...Response) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w HeaderWriter
+	w.Init(&buf, 0, rc)
+	for _, res := range ress {
+		if err := w.WriteResponse(res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readResponses(t *testing.T, rc RCType, data []byte, n int) (ress []Response) {
+	t.Helper()
+	var r HeaderReader
+	r.Init(bytes.NewReader(data), 0, rc)
+	for i := 0; i < n; i++ {
+		res, err := r.ReadResponse()
+		if err != nil {
+			t.Fatalf("Response %d: %v", i, err)
+		}
+		ress = append(ress, res)
+	}
+	return
+}
+
+func TestWriteResponseRC1(t *testing.T) {
+	data := writeResponses(t, RC1byte,
+		Response{Msg: 1, Id: 2, Code: 3, Body: []byte("ab")},
+		Response{Msg: 4, Id: 5, Code: 6, Body: []byte("cd")},
+	)
+	expect := []byte{
+		1, 0, 0, 0, 3, 0, 0, 0, 2, 0, 0, 0, 3, 'a', 'b',
+		4, 0, 0, 0, 3, 0, 0, 0, 5, 0, 0, 0, 6, 'c', 'd',
+	}
+	if !bytes.Equal(data, expect) {
+		t.Fatalf("Written %v, expect %v", data, expect)
+	}
+	ress := readResponses(t, RC1byte, data, 2)
+	if ress[1].Msg != 4 || ress[1].Id != 5 || ress[1].Code != 6 || string(ress[1].Body) != "cd" {
+		t.Errorf("Wrong second response %+v", ress[1])
+	}
+}
+
+func TestWritePingResponse(t *testing.T) {
+	for _, rc := range []RCType{RC0byte, RC1byte, RC4byte} {
+		data := writeResponses(t, rc,
+			Response{Msg: iproto.Ping, Id: iproto.PingRequestId},
+			Response{Msg: 7, Id: 8, Body: []byte("x")},
+		)
+		// ping response is a bare header without return code
+		expect := []byte{0, 0xff, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}
+		if !bytes.Equal(data[:12], expect) {
+			t.Errorf("rc %d: ping written as %v, expect %v", rc, data[:12], expect)
+		}
+		ress := readResponses(t, rc, data, 2)
+		if ress[0].Msg != iproto.Ping || len(ress[0].Body) != 0 {
+			t.Errorf("rc %d: wrong ping %+v", rc, ress[0])
+		}
+		if ress[1].Msg != 7 || ress[1].Id != 8 || string(ress[1].Body) != "x" {
+			t.Errorf("rc %d: response after ping is broken %+v", rc, ress[1])
+		}
+	}
+}
+
+func TestMaxBody(t *testing.T) {
+	var buf bytes.Buffer
+	var w HeaderWriter
+	w.Init(&buf, 0, RC4byte)
+	w.WriteRequest(Request{Msg: 1, Id: 2, Body: []byte("abcd")})
+	w.WriteRequest(Request{Msg: 3, Id: 4, Body: []byte("abcde")})
+	w.Flush()
+
+	var r HeaderReader
+	r.Init(bytes.NewReader(buf.Bytes()), 0, RC4byte)
+	r.SetMaxBody(4)
+	if req, err := r.ReadRequest(); err != nil || string(req.Body) != "abcd" {
+		t.Fatalf("Request at limit should be read, got %+v %v", req, err)
+	}
+	_, err := r.ReadRequest()
+	tl, ok := err.(*FrameTooLarge)
+	if !ok || tl.Msg != 3 || tl.Id != 4 || tl.Size != 5 || tl.Max != 4 {
+		t.Errorf("Request over limit should fail with FrameTooLarge, got %#v", err)
+	}
+
+	data := writeResponses(t, RC4byte,
+		Response{Msg: 5, Id: 6, Body: []byte("ab")},
+		Response{Msg: 7, Id: 8, Body: []byte("abc")},
+	)
+	r.Init(bytes.NewReader(data), 0, RC4byte)
+	// return code is counted in body length
+	r.SetMaxBody(6)
+	if res, err := r.ReadResponse(); err != nil || string(res.Body) != "ab" {
+		t.Fatalf("Response at limit should be read, got %+v %v", res, err)
+	}
+	_, err = r.ReadResponse()
+	if tl, ok = err.(*FrameTooLarge); !ok || tl.Msg != 7 || tl.Id != 8 || tl.Size != 7 || tl.Max != 6 {
+		t.Errorf("Response over limit should fail with FrameTooLarge, got %#v", err)
+	}
+}
@@ -0,0 +1,297 @@
+/*
+Package iprototest provides fake iproto server for unit tests.
+
+	srv := iprototest.NewServer(net.RC4byte)
+	defer srv.Close()
+	srv.Handle(17, func(req net.Request) iprototest.Reply {
+		return iprototest.Reply{Body: tuples}
+	})
+	srv.Script(13, iprototest.Reply{Code: sbox.RcDuplicate}, iprototest.Reply{Disconnect: true})
+
+	box := srv.Config().NewServer()
+	iproto.Run(box)
+
+Pings are answered automatically and are not recorded.
+*/
+package iprototest
+
+import (
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	nt "github.com/funny-falcon/go-iproto/net"
+	"github.com/funny-falcon/go-iproto/net/client"
+)
+
+var _ = log.Print
+
+// Reply describes how request is answered
+type Reply struct {
+	Code iproto.RetCode
+	Body []byte
+	// Delay postpones answer
+	Delay time.Duration
+	// NoReply leaves request without answer
+	NoReply bool
+	// Disconnect closes connection instead of answering
+	Disconnect bool
+}
+
+type Handler func(req nt.Request) Reply
+
+type Server struct {
+	// Network and Address server is listening on, empty for Pipe only servers
+	Network string
+	Address string
+	RCType  nt.RCType
+	// Default answers requests without handler and script, it replies RcOK with empty body if nil
+	Default Handler
+
+	listener net.Listener
+
+	m        sync.Mutex
+	handlers map[iproto.RequestType]Handler
+	scripts  map[iproto.RequestType][]Reply
+	received []nt.Request
+	notify   chan struct{}
+	conns    map[io.Closer]bool
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+func newServer(rc nt.RCType) *Server {
+	return &Server{
+		RCType:   rc,
+		handlers: make(map[iproto.RequestType]Handler),
+		scripts:  make(map[iproto.RequestType][]Reply),
+		notify:   make(chan struct{}),
+		conns:    make(map[io.Closer]bool),
+	}
+}
+
+// NewServer starts fake server listening on loopback with a random port
+func NewServer(rc nt.RCType) *Server {
+	srv := newServer(rc)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Panicf("iprototest: could not listen: %v", err)
+	}
+	srv.listener = l
+	srv.Network = "tcp"
+	srv.Address = l.Addr().String()
+	srv.wg.Add(1)
+	go srv.acceptLoop()
+	return srv
+}
+
+// Pipe starts fake server serving one end of net.Pipe, and returns other end.
+// It could be passed to connection.Connection.RunWithConn.
+func Pipe(rc nt.RCType) (*Server, net.Conn) {
+	srv := newServer(rc)
+	cli, conn := net.Pipe()
+	srv.ServeConn(conn)
+	return srv, cli
+}
+
+// Config returns client config pointing to server, its Logger discards messages
+func (srv *Server) Config() client.ServerConfig {
+	return client.ServerConfig{
+		Network:     srv.Network,
+		Address:     srv.Address,
+		RetCodeType: srv.RCType,
+		Timeout:     time.Second,
+		Logger:      iproto.NopLogger{},
+	}
+}
+
+func (srv *Server) Handle(msg iproto.RequestType, h Handler) {
+	srv.m.Lock()
+	srv.handlers[msg] = h
+	srv.m.Unlock()
+}
+
+// Script queues replies for msg, they are used in order before handler
+func (srv *Server) Script(msg iproto.RequestType, replies ...Reply) {
+	srv.m.Lock()
+	srv.scripts[msg] = append(srv.scripts[msg], replies...)
+	srv.m.Unlock()
+}
+
+// Requests returns all received requests except pings
+func (srv *Server) Requests() []nt.Request {
+	srv.m.Lock()
+	defer srv.m.Unlock()
+	return append([]nt.Request(nil), srv.received...)
+}
+
+// RequestsOf returns received requests with msg
+func (srv *Server) RequestsOf(msg iproto.RequestType) (reqs []nt.Request) {
+	srv.m.Lock()
+	defer srv.m.Unlock()
+	for _, req := range srv.received {
+		if req.Msg == msg {
+			reqs = append(reqs, req)
+		}
+	}
+	return
+}
+
+// Wait waits until at least n requests are received, it returns false on timeout
+func (srv *Server) Wait(n int, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for {
+		srv.m.Lock()
+		got, notify := len(srv.received), srv.notify
+		srv.m.Unlock()
+		if got >= n {
+			return true
+		}
+		select {
+		case <-notify:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// Reset forgets received requests and scripted replies
+func (srv *Server) Reset() {
+	srv.m.Lock()
+	srv.received = nil
+	srv.scripts = make(map[iproto.RequestType][]Reply)
+	srv.m.Unlock()
+}
+
+// Disconnect abruptly closes all current connections
+func (srv *Server) Disconnect() {
+	srv.m.Lock()
+	for conn := range srv.conns {
+		conn.Close()
+	}
+	srv.m.Unlock()
+}
+
+// Close stops listening, closes connections and waits for them to finish
+func (srv *Server) Close() {
+	srv.m.Lock()
+	srv.closed = true
+	srv.m.Unlock()
+	if srv.listener != nil {
+		srv.listener.Close()
+	}
+	srv.Disconnect()
+	srv.wg.Wait()
+}
+
+func (srv *Server) acceptLoop() {
+	defer srv.wg.Done()
+	for {
+		conn, err := srv.listener.Accept()
+		if err != nil {
+			return
+		}
+		srv.ServeConn(conn)
+	}
+}
+
+// ServeConn serves iproto on conn until it is closed
+func (srv *Server) ServeConn(conn io.ReadWriteCloser) {
+	srv.m.Lock()
+	if srv.closed {
+		srv.m.Unlock()
+		conn.Close()
+		return
+	}
+	srv.conns[conn] = true
+	srv.wg.Add(1)
+	srv.m.Unlock()
+
+	c := &fakeConn{srv: srv, conn: conn}
+	c.w.Init(conn, 0, srv.RCType)
+	go c.readLoop()
+}
+
+func (srv *Server) reply(req nt.Request) Reply {
+	srv.m.Lock()
+	srv.received = append(srv.received, req)
+	close(srv.notify)
+	srv.notify = make(chan struct{})
+
+	var h Handler
+	if script := srv.scripts[req.Msg]; len(script) > 0 {
+		rep := script[0]
+		srv.scripts[req.Msg] = script[1:]
+		srv.m.Unlock()
+		return rep
+	}
+	if h = srv.handlers[req.Msg]; h == nil {
+		h = srv.Default
+	}
+	srv.m.Unlock()
+
+	if h == nil {
+		return Reply{}
+	}
+	return h(req)
+}
+
+type fakeConn struct {
+	srv  *Server
+	conn io.ReadWriteCloser
+	wm   sync.Mutex
+	w    nt.HeaderWriter
+}
+
+func (c *fakeConn) readLoop() {
+	defer c.srv.wg.Done()
+	defer c.close()
+
+	var r nt.HeaderReader
+	r.Init(c.conn, 0, c.srv.RCType)
+	for {
+		req, err := r.ReadRequest()
+		if err != nil {
+			return
+		}
+		if req.Msg == iproto.Ping {
+			c.write(nt.Response{Msg: iproto.Ping, Id: req.Id})
+			continue
+		}
+
+		rep := c.srv.reply(req)
+		res := nt.Response{Msg: req.Msg, Id: req.Id, Code: rep.Code, Body: rep.Body}
+		switch {
+		case rep.Delay > 0:
+			time.AfterFunc(rep.Delay, func() {
+				if rep.Disconnect {
+					c.close()
+				} else if !rep.NoReply {
+					c.write(res)
+				}
+			})
+		case rep.Disconnect:
+			return
+		case !rep.NoReply:
+			c.write(res)
+		}
+	}
+}
+
+func (c *fakeConn) write(res nt.Response) {
+	c.wm.Lock()
+	if c.w.WriteResponse(res) == nil {
+		c.w.Flush()
+	}
+	c.wm.Unlock()
+}
+
+func (c *fakeConn) close() {
+	c.conn.Close()
+	c.srv.m.Lock()
+	delete(c.srv.conns, c.conn)
+	c.srv.m.Unlock()
+}
@@ -0,0 +1,79 @@
+package iprototest
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	nt "github.com/funny-falcon/go-iproto/net"
+)
+
+func TestRCTypes(t *testing.T) {
+	for _, rc := range []nt.RCType{nt.RC4byte, nt.RC1byte, nt.RC0byte} {
+		srv := NewServer(rc)
+		srv.Handle(17, func(req nt.Request) Reply {
+			return Reply{Code: 2, Body: append([]byte("re:"), req.Body...)}
+		})
+		cli := srv.Config().NewServer()
+		iproto.Run(cli)
+
+		res := iproto.CallMsgBody(cli, 17, iproto.Body("hi"))
+		code := iproto.RetCode(2)
+		if rc == nt.RC0byte {
+			code = iproto.RcOK
+		}
+		if res.Code != code || !bytes.Equal(res.Body, []byte("re:hi")) {
+			t.Errorf("rc %d: unexpected response %x %q", rc, res.Code, res.Body)
+		}
+		if reqs := srv.RequestsOf(17); len(reqs) != 1 || !bytes.Equal(reqs[0].Body, []byte("hi")) {
+			t.Errorf("rc %d: unexpected requests %+v", rc, reqs)
+		}
+
+		cli.Stop()
+		srv.Close()
+	}
+}
+
+func TestScript(t *testing.T) {
+	srv := NewServer(nt.RC4byte)
+	defer srv.Close()
+	srv.Script(13,
+		Reply{Code: 0x202},
+		Reply{Delay: 50 * time.Millisecond, Body: []byte("late")},
+		Reply{NoReply: true},
+		Reply{Disconnect: true},
+	)
+	cfg := srv.Config()
+	cfg.Timeout = 300 * time.Millisecond
+	cfg.PingInterval = 50 * time.Millisecond
+	cli := cfg.NewServer()
+	iproto.Run(cli)
+	defer cli.Stop()
+
+	if res := iproto.CallMsgBody(cli, 13, nil); res.Code != 0x202 {
+		t.Errorf("Code should be scripted, got %x", res.Code)
+	}
+	if res := iproto.CallMsgBody(cli, 13, nil); res.Code != iproto.RcOK || string(res.Body) != "late" {
+		t.Errorf("Delayed reply expected, got %x %q", res.Code, res.Body)
+	}
+	if res := iproto.CallMsgBody(cli, 13, nil); res.Code != iproto.RcTimeout {
+		t.Errorf("Timeout expected, got %x", res.Code)
+	}
+	if res := iproto.CallMsgBody(cli, 13, nil); res.Code != iproto.RcIOError {
+		t.Errorf("IOError expected, got %x", res.Code)
+	}
+	var res *iproto.Response
+	for i := 0; i < 20; i++ {
+		if res = iproto.CallMsgBody(cli, 13, nil); res.Code != iproto.RcIOError {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if res.Code != iproto.RcOK {
+		t.Errorf("Default reply expected after reconnect, got %x", res.Code)
+	}
+	if !srv.Wait(5, time.Second) || len(srv.RequestsOf(13)) != 5 {
+		t.Errorf("Five requests should be recorded, got %d", len(srv.RequestsOf(13)))
+	}
+}
@@ -0,0 +1,66 @@
+package net
+
+import (
+	"io"
+	"time"
+)
+
+// Protocol is a framing of requests and responses on the wire used by client connections.
+// Legacy is 12 byte header iproto of octopus and Tarantool 1.5,
+// package tarantool implements MessagePack framed protocol of Tarantool 1.6+.
+type Protocol interface {
+	// Handshake is called right after dial, before first request,
+	// it could read greeting and authenticate. Framed replies should be read with r,
+	// which is a reader of connection, so bytes buffered after them are not lost.
+	Handshake(conn NetConn, r FrameReader, timeout time.Duration) error
+	NewReader(r io.Reader, timeout time.Duration) FrameReader
+	NewWriter(w io.Writer, timeout time.Duration) FrameWriter
+}
+
+type FrameReader interface {
+	// ReadResponse returns response to ping with Msg == iproto.Ping and Id == iproto.PingRequestId
+	ReadResponse() (Response, error)
+	ReadPing() error
+	// SetMaxBody limits size of frames, zero means no limit
+	SetMaxBody(max int)
+}
+
+type FrameWriter interface {
+	WriteRequest(req Request) error
+	Ping() error
+	Flush() error
+	Buffered() int
+	// Written returns total number of bytes written, it is used to measure size of frames
+	Written() int64
+	// SetBufferSize sets size of write buffer, it should be called before first write
+	SetBufferSize(size int)
+}
+
+// Legacy is a 12 byte header iproto with return code of RCType
+type Legacy struct {
+	RCType RCType
+}
+
+func (p Legacy) Handshake(conn NetConn, r FrameReader, timeout time.Duration) error {
+	return nil
+}
+
+func (p Legacy) NewReader(r io.Reader, timeout time.Duration) FrameReader {
+	h := &HeaderReader{}
+	h.Init(r, timeout, p.RCType)
+	return h
+}
+
+func (p Legacy) NewWriter(w io.Writer, timeout time.Duration) FrameWriter {
+	h := &HeaderWriter{}
+	h.Init(w, timeout, p.RCType)
+	return h
+}
+
+func NewSliceReader(r io.Reader, timeout time.Duration) *SliceReader {
+	return &SliceReader{r: r, size: 8 * 1024, timeout: timeout}
+}
+
+func NewBufWriter(w io.Writer, timeout time.Duration) *BufWriter {
+	return &BufWriter{w: w, timeout: timeout}
+}
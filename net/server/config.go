@@ -1,9 +1,12 @@
 package server
 
 import (
+	"crypto/tls"
+	"fmt"
 	"time"
 
 	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/metrics"
 	"github.com/funny-falcon/go-iproto/net"
 )
 
@@ -12,10 +15,73 @@ type Config struct {
 	Address string
 
 	EndPoint iproto.Service
+	// Middlewares wrap EndPoint, first one is outermost
+	Middlewares []Middleware
 
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 
 	RCType net.RCType
 	RCMap  map[iproto.RetCode]iproto.RetCode
+
+	// DrainPings keeps connections reading while Shutdown drains them:
+	// pings are answered and other requests are rejected with RcShutdown
+	DrainPings bool
+
+	// MaxRequestSize limits request body, larger request is answered with RcProtocolError
+	// and connection is closed
+	MaxRequestSize int
+
+	// MaxConnections and MaxHostConnections limit accepted connections in total and per
+	// remote host, connections over limit are closed right after accept
+	MaxConnections     int
+	MaxHostConnections int
+	// RequestsPerSecond limits request rate per remote host with token bucket of Burst size,
+	// Burst defaults to RequestsPerSecond. Bucket is kept after host disconnects, until it refills.
+	RequestsPerSecond float64
+	Burst             int
+	// MaxInFlight limits requests in fly per connection
+	MaxInFlight int
+	// LimitCode answers requests over RequestsPerSecond or MaxInFlight.
+	// If it is RcOK, reading of connection pauses until request is allowed.
+	LimitCode iproto.RetCode
+
+	// TLSConfig enables TLS on accepted connections.
+	// Set ClientAuth to tls.RequireAndVerifyClientCert for mutual TLS.
+	TLSConfig *tls.Config
+
+	Metrics *metrics.Collector
+
+	// Logger is iproto.DefaultLogger if nil
+	Logger iproto.Logger
+	// QuietConnections logs accepted and closed connections with Debug level instead of Info
+	QuietConnections bool
+}
+
+// Validate checks config for errors NewServer would panic on
+func (cfg *Config) Validate() error {
+	if cfg.EndPoint == nil {
+		return fmt.Errorf("iproto server: EndPoint should be set")
+	}
+	if cfg.RCType > net.RC0byte {
+		return fmt.Errorf("iproto server: unknown RCType %d", cfg.RCType)
+	}
+	if cfg.MaxRequestSize < 0 {
+		return fmt.Errorf("iproto server: negative MaxRequestSize")
+	}
+	if cfg.MaxConnections < 0 || cfg.MaxHostConnections < 0 || cfg.MaxInFlight < 0 {
+		return fmt.Errorf("iproto server: negative connections or in fly limit")
+	}
+	if cfg.RequestsPerSecond < 0 || cfg.Burst < 0 {
+		return fmt.Errorf("iproto server: negative RequestsPerSecond or Burst")
+	}
+	for k, v := range cfg.RCMap {
+		if k&iproto.RcKindMask != iproto.RcInternal {
+			return fmt.Errorf("iproto server: should map internal ret code, not %x", k)
+		}
+		if v&iproto.RcKindMask == iproto.RcInternal {
+			return fmt.Errorf("iproto server: should not map internal ret code %x to internal ret code %x", k, v)
+		}
+	}
+	return nil
 }
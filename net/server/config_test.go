@@ -0,0 +1,42 @@
+package server_test
+
+import (
+	"testing"
+
+	"github.com/funny-falcon/go-iproto"
+	nt "github.com/funny-falcon/go-iproto/net"
+	"github.com/funny-falcon/go-iproto/net/server"
+)
+
+func TestValidate(t *testing.T) {
+	ep := iproto.SF(func(r *iproto.Request) { r.RespondBytes(iproto.RcOK, nil) })
+	bad := map[string]server.Config{
+		"no end point":       {Address: "127.0.0.1:0"},
+		"unknown rc type":    {EndPoint: ep, RCType: nt.RC0byte + 1},
+		"map not internal":   {EndPoint: ep, RCMap: map[iproto.RetCode]iproto.RetCode{0x102: 0x202}},
+		"map to internal":    {EndPoint: ep, RCMap: map[iproto.RetCode]iproto.RetCode{iproto.RcTimeout: iproto.RcIOError}},
+		"negative body size": {EndPoint: ep, MaxRequestSize: -1},
+	}
+	for name, cfg := range bad {
+		cfg := cfg
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: config should be rejected", name)
+		}
+		if serv, err := server.New(&cfg); serv != nil || err == nil {
+			t.Errorf("%s: New should return error", name)
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: NewServer should panic", name)
+				}
+			}()
+			cfg.NewServer()
+		}()
+	}
+
+	cfg := server.Config{EndPoint: ep, RCMap: map[iproto.RetCode]iproto.RetCode{iproto.RcTimeout: 0x102}}
+	if serv, err := server.New(&cfg); serv == nil || err != nil {
+		t.Errorf("Valid config is rejected: %v", err)
+	}
+}
@@ -1,8 +1,11 @@
 package server
 
 import (
+	"crypto/x509"
 	"log"
+	"net"
 	"sync"
+	"sync/atomic"
 
 	"github.com/funny-falcon/go-iproto"
 	nt "github.com/funny-falcon/go-iproto/net"
@@ -41,6 +44,12 @@ type Connection struct {
 	inFly map[uint32]*iproto.Request
 	sync.Mutex
 
+	host      *host
+	inFlySema chan struct{}
+	// stopped is closed by Stop, so readLoop does not wait for limits
+	stopped  chan struct{}
+	stopOnce sync.Once
+
 	loopNotify chan notifyAction
 }
 
@@ -57,6 +66,10 @@ func NewConnection(serv *Server, connection nt.NetConn, id uint64) (conn *Connec
 		state: CsConnected,
 
 		loopNotify: make(chan notifyAction, 2),
+		stopped:    make(chan struct{}),
+	}
+	if serv.MaxInFlight > 0 {
+		conn.inFlySema = make(chan struct{}, serv.MaxInFlight)
 	}
 	return
 }
@@ -68,24 +81,67 @@ func (conn *Connection) Run() {
 }
 
 func (conn *Connection) Stop() {
+	conn.stopOnce.Do(func() { close(conn.stopped) })
 	conn.conn.CloseRead()
 }
 
-func (conn *Connection) Respond(r *iproto.Response) {
-	if r.Code&iproto.RcKindMask == iproto.RcInternal {
-		if conn.RCMap != nil {
-			if repl := conn.RCMap[r.Code]; repl != 0 {
-				r.Code = repl
-				goto CodeEnd
-			}
+// shutdownInFly answers all requests in fly with RcShutdown
+func (conn *Connection) shutdownInFly() int {
+	conn.Lock()
+	reqs := make([]*iproto.Request, 0, len(conn.inFly))
+	for _, req := range conn.inFly {
+		reqs = append(reqs, req)
+	}
+	conn.Unlock()
+	for _, req := range reqs {
+		req.ShutDown()
+	}
+	return len(reqs)
+}
+
+func (conn *Connection) InFlight() (n int) {
+	conn.Lock()
+	n = len(conn.inFly)
+	conn.Unlock()
+	return
+}
+
+func (conn *Connection) RemoteAddr() net.Addr {
+	return conn.conn.RemoteAddr()
+}
+
+func (conn *Connection) LocalAddr() net.Addr {
+	return conn.conn.LocalAddr()
+}
+
+// PeerCertificates returns client certificates of TLS connection, or nil
+func (conn *Connection) PeerCertificates() []*x509.Certificate {
+	if tc, ok := conn.conn.(*nt.TLSConn); ok {
+		return tc.PeerCertificates()
+	}
+	return nil
+}
+
+// retCode maps internal codes with RCMap, or to fatal ones
+func (conn *Connection) retCode(code iproto.RetCode) iproto.RetCode {
+	if code&iproto.RcKindMask == iproto.RcInternal {
+		if repl := conn.RCMap[code]; repl != 0 {
+			return repl
 		}
-		r.Code = (r.Code &^ iproto.RcKindMask) | iproto.RcFatal
+		return (code &^ iproto.RcKindMask) | iproto.RcFatal
 	}
-CodeEnd:
+	return code
+}
+
+func (conn *Connection) Respond(r *iproto.Response) {
+	r.Code = conn.retCode(r.Code)
 
 	conn.Lock()
 	if _, ok := conn.inFly[r.Id]; ok {
 		delete(conn.inFly, r.Id)
+		if conn.inFlySema != nil {
+			<-conn.inFlySema
+		}
 
 		if len(conn.buf) == 0 {
 			select {
@@ -103,7 +159,7 @@ CodeEnd:
 func (conn *Connection) cancelInFly() {
 	conn.Lock()
 	if len(conn.inFly) > 0 {
-		log.Print("Canceling ", len(conn.inFly), " requests ", conn.conn.RemoteAddr())
+		conn.Logger.Warn("Canceling requests", "conn", conn.Id, "remote", conn.conn.RemoteAddr(), "count", len(conn.inFly))
 	}
 	reqs := make([]*iproto.Request, 0, len(conn.inFly))
 	for _, req := range conn.inFly {
@@ -113,12 +169,14 @@ func (conn *Connection) cancelInFly() {
 	for _, req := range reqs {
 		req.Cancel()
 	}
-	conn.Server.connClosed <- conn.Id
 }
 
 func (conn *Connection) closed() {
+	conn.Lock()
 	conn.buf = nil
 	conn.inFly = nil
+	conn.Unlock()
+	conn.logConn("Closed", "conn", conn.Id, "remote", conn.conn.RemoteAddr())
 	conn.Server.connClosed <- conn.Id
 }
 
@@ -161,6 +219,7 @@ func (conn *Connection) readLoop() {
 	var err error
 	var r nt.HeaderReader
 	r.Init(conn.conn, conn.ReadTimeout, conn.RCType)
+	r.SetMaxBody(conn.MaxRequestSize)
 
 	defer conn.notifyLoop(readClosed)
 
@@ -169,6 +228,15 @@ func (conn *Connection) readLoop() {
 
 	for {
 		if req, err = r.ReadRequest(); err != nil {
+			if tl, ok := err.(*nt.FrameTooLarge); ok {
+				conn.Logger.Warn("Request too large", "conn", conn.Id, "remote", conn.conn.RemoteAddr(),
+					"msg", tl.Msg, "id", tl.Id, "size", tl.Size, "max", tl.Max)
+				conn.out <- nt.Response{
+					Id:   tl.Id,
+					Msg:  tl.Msg,
+					Code: iproto.RcProtocolError,
+				}
+			}
 			break
 		}
 
@@ -181,6 +249,35 @@ func (conn *Connection) readLoop() {
 			continue
 		}
 
+		/* duplicate id would replace request in fly, so its response and limit token are lost */
+		conn.Lock()
+		_, dup := conn.inFly[req.Id]
+		conn.Unlock()
+		if dup {
+			conn.Logger.Warn("Duplicate request id", "conn", conn.Id, "remote", conn.conn.RemoteAddr(), "msg", req.Msg, "id", req.Id)
+			conn.out <- nt.Response{
+				Id:   req.Id,
+				Msg:  req.Msg,
+				Code: iproto.RcProtocolError,
+			}
+			continue
+		}
+
+		pass, stop := conn.limit()
+		if stop {
+			break
+		}
+		if !pass {
+			conn.out <- nt.Response{
+				Id:   req.Id,
+				Msg:  req.Msg,
+				Code: conn.retCode(conn.LimitCode),
+			}
+			continue
+		}
+
+		draining := atomic.LoadUint32(&conn.draining) != 0
+
 		if buf == nil {
 			buf = &[16]iproto.Request{}
 		}
@@ -200,6 +297,10 @@ func (conn *Connection) readLoop() {
 		conn.inFly[request.Id] = request
 		conn.Unlock()
 
+		if draining {
+			request.ShutDown()
+			continue
+		}
 		conn.EndPoint.Send(request)
 	}
 }
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// host accounts connections and request rate of one remote address
+type host struct {
+	name string
+	// conns and idle are guarded by Server lock, idle is a time last connection were closed
+	conns int
+	idle  time.Time
+
+	sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func hostName(addr net.Addr) string {
+	if h, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return h
+	}
+	return addr.String()
+}
+
+// take takes one token from bucket, or returns time to wait for it
+func (h *host) take(rate float64, burst int, now time.Time) time.Duration {
+	h.Lock()
+	defer h.Unlock()
+	if h.last.IsZero() {
+		h.tokens = float64(burst)
+	} else {
+		h.tokens = math.Min(h.tokens+now.Sub(h.last).Seconds()*rate, float64(burst))
+	}
+	h.last = now
+	if h.tokens >= 1 {
+		h.tokens--
+		return 0
+	}
+	return time.Duration((1 - h.tokens) / rate * float64(time.Second))
+}
+
+func (cfg *Config) tracksHosts() bool {
+	return cfg.RequestsPerSecond > 0 || cfg.MaxHostConnections > 0
+}
+
+// refill is a time bucket needs to become full, host idle for longer is forgotten
+func (cfg *Config) refill() time.Duration {
+	return time.Duration(float64(cfg.burst()) / cfg.RequestsPerSecond * float64(time.Second))
+}
+
+func (cfg *Config) burst() int {
+	if cfg.Burst > 0 {
+		return cfg.Burst
+	}
+	if b := int(math.Ceil(cfg.RequestsPerSecond)); b > 0 {
+		return b
+	}
+	return 1
+}
+
+// acceptConn checks connection limits and accounts new connection of host, serv should be locked
+func (serv *Server) acceptConn(addr net.Addr) (h *host, ok bool) {
+	if serv.MaxConnections > 0 && len(serv.conns) >= serv.MaxConnections {
+		return nil, false
+	}
+	if !serv.tracksHosts() {
+		return nil, true
+	}
+	serv.forgetIdle(time.Now())
+	name := hostName(addr)
+	if h = serv.hosts[name]; h == nil {
+		h = &host{name: name}
+		serv.hosts[name] = h
+	}
+	if serv.MaxHostConnections > 0 && h.conns >= serv.MaxHostConnections {
+		return nil, false
+	}
+	h.conns++
+	return h, true
+}
+
+// releaseConn accounts closed connection of host, serv should be locked.
+// Host without connections keeps its bucket until it is refilled, so reconnect doesn't reset it.
+func (serv *Server) releaseConn(h *host) {
+	if h == nil {
+		return
+	}
+	if h.conns--; h.conns == 0 {
+		if serv.RequestsPerSecond > 0 {
+			h.idle = time.Now()
+		} else {
+			delete(serv.hosts, h.name)
+		}
+	}
+}
+
+// forgetIdle forgets hosts without connections, which buckets are full, serv should be locked
+func (serv *Server) forgetIdle(now time.Time) {
+	if serv.RequestsPerSecond <= 0 || now.Sub(serv.forgot) < serv.refill() {
+		return
+	}
+	serv.forgot = now
+	for name, h := range serv.hosts {
+		if h.conns == 0 && now.Sub(h.idle) >= serv.refill() {
+			delete(serv.hosts, name)
+		}
+	}
+}
+
+// limit waits for in fly and request rate limits, or returns pass false if request should be
+// answered with LimitCode. It returns stop true if connection is stopped while waiting.
+// Rate token is taken after in fly one, so rejected requests don't spend it.
+func (conn *Connection) limit() (pass bool, stop bool) {
+	if conn.inFlySema != nil {
+		if pass, stop = conn.limitInFly(); !pass {
+			return
+		}
+	}
+	if pass, stop = conn.limitRate(); !pass && conn.inFlySema != nil {
+		<-conn.inFlySema
+	}
+	return
+}
+
+func (conn *Connection) limitInFly() (pass bool, stop bool) {
+	if conn.LimitCode == 0 {
+		select {
+		case conn.inFlySema <- struct{}{}:
+			return true, false
+		case <-conn.stopped:
+			return false, true
+		}
+	}
+	select {
+	case conn.inFlySema <- struct{}{}:
+		return true, false
+	default:
+		return false, false
+	}
+}
+
+func (conn *Connection) limitRate() (pass bool, stop bool) {
+	if conn.host == nil || conn.RequestsPerSecond <= 0 {
+		return true, false
+	}
+	for {
+		wait := conn.host.take(conn.RequestsPerSecond, conn.burst(), time.Now())
+		if wait == 0 {
+			return true, false
+		}
+		if conn.LimitCode != 0 {
+			return false, false
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-conn.stopped:
+			timer.Stop()
+			return false, true
+		}
+	}
+}
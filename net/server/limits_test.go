@@ -0,0 +1,229 @@
+package server_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	nt "github.com/funny-falcon/go-iproto/net"
+	"github.com/funny-falcon/go-iproto/net/server"
+)
+
+const rcLimit = iproto.RetCode(0x101)
+
+// rawClient sends requests with ids chosen by test
+type rawClient struct {
+	t    *testing.T
+	conn net.Conn
+	w    nt.HeaderWriter
+	r    nt.HeaderReader
+}
+
+func runLimited(t *testing.T, cfg server.Config) (*server.Server, *rawClient) {
+	cfg.Network, cfg.Address = "tcp", "127.0.0.1:0"
+	cfg.Logger = iproto.NopLogger{}
+	serv := cfg.NewServer()
+	if err := serv.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return serv, dialRaw(t, serv)
+}
+
+func dialRaw(t *testing.T, serv *server.Server) *rawClient {
+	conn, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &rawClient{t: t, conn: conn}
+	c.w.Init(conn, 0, nt.RC4byte)
+	c.r.Init(conn, time.Second, nt.RC4byte)
+	return c
+}
+
+func (c *rawClient) send(id uint32) {
+	c.t.Helper()
+	err := c.w.WriteRequest(nt.Request{Msg: msgTest, Id: id})
+	if err == nil {
+		err = c.w.Flush()
+	}
+	if err != nil {
+		c.t.Fatalf("Request %d is not sent: %v", id, err)
+	}
+}
+
+func (c *rawClient) expect(id uint32, code iproto.RetCode) {
+	c.t.Helper()
+	res, err := c.r.ReadResponse()
+	if err != nil {
+		c.t.Fatalf("Response to %d is not read: %v", id, err)
+	}
+	if res.Id != id || res.Code != code {
+		c.t.Fatalf("Got response %d with %x, expect %d with %x", res.Id, res.Code, id, code)
+	}
+}
+
+func waitGot(t *testing.T, s *holdService) {
+	t.Helper()
+	select {
+	case <-s.got:
+	case <-time.After(time.Second):
+		t.Fatalf("Request is not received by service")
+	}
+}
+
+func TestDuplicateIdRejected(t *testing.T) {
+	s := newHoldService()
+	serv, c := runLimited(t, server.Config{EndPoint: s, MaxInFlight: 1, LimitCode: rcLimit})
+	defer serv.Stop()
+
+	c.send(1)
+	waitGot(t, s)
+	c.send(1)
+	c.expect(1, iproto.RcProtocolError)
+	c.send(2)
+	c.expect(2, rcLimit)
+
+	s.release()
+	c.expect(1, iproto.RcOK)
+	// token of answered request is returned
+	c.send(3)
+	waitGot(t, s)
+	s.release()
+	c.expect(3, iproto.RcOK)
+}
+
+func TestDuplicateIdBackPressure(t *testing.T) {
+	s := newHoldService()
+	serv, c := runLimited(t, server.Config{EndPoint: s, MaxInFlight: 1})
+	defer serv.Stop()
+
+	c.send(1)
+	waitGot(t, s)
+	c.send(1)
+	c.expect(1, iproto.RcProtocolError)
+
+	c.send(2)
+	select {
+	case <-s.got:
+		t.Fatalf("Request over MaxInFlight should wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.release()
+	c.expect(1, iproto.RcOK)
+	waitGot(t, s)
+	s.release()
+	c.expect(2, iproto.RcOK)
+}
+
+func TestLimitWaitStopped(t *testing.T) {
+	s := newHoldService()
+	serv, c := runLimited(t, server.Config{EndPoint: s, MaxInFlight: 1})
+
+	c.send(1)
+	waitGot(t, s)
+	c.send(2)
+	time.Sleep(50 * time.Millisecond)
+	serv.Stop()
+	// connections are stopped by server's loop
+	time.Sleep(50 * time.Millisecond)
+	s.release()
+	select {
+	case <-serv.Running:
+	case <-time.After(time.Second):
+		t.Fatalf("Connection waiting for MaxInFlight is not stopped")
+	}
+	select {
+	case <-s.got:
+		t.Errorf("Request waiting for MaxInFlight should not be sent after Stop")
+	default:
+	}
+}
+
+func TestRateWaitStopped(t *testing.T) {
+	s := newHoldService()
+	serv, c := runLimited(t, server.Config{EndPoint: s, RequestsPerSecond: 0.2, Burst: 1})
+
+	c.send(1)
+	waitGot(t, s)
+	s.release()
+	c.expect(1, iproto.RcOK)
+	c.send(2)
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	serv.Stop()
+	select {
+	case <-serv.Running:
+	case <-time.After(time.Second):
+		t.Fatalf("Connection waiting for request rate is not stopped")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Stop waited %v for request rate", d)
+	}
+}
+
+func TestRateSurvivesReconnect(t *testing.T) {
+	s := newHoldService()
+	serv, c := runLimited(t, server.Config{EndPoint: s, RequestsPerSecond: 0.2, Burst: 1, LimitCode: rcLimit})
+	defer serv.Stop()
+
+	c.send(1)
+	waitGot(t, s)
+	s.release()
+	c.expect(1, iproto.RcOK)
+	c.conn.Close()
+	// let server notice closed connection
+	time.Sleep(50 * time.Millisecond)
+
+	c = dialRaw(t, serv)
+	c.send(2)
+	c.expect(2, rcLimit)
+}
+
+func TestRejectedKeepsRate(t *testing.T) {
+	s := newHoldService()
+	serv, c := runLimited(t, server.Config{EndPoint: s, MaxInFlight: 1, RequestsPerSecond: 0.2, Burst: 2, LimitCode: rcLimit})
+	defer serv.Stop()
+
+	c.send(1)
+	waitGot(t, s)
+	c.send(2)
+	c.expect(2, rcLimit)
+	s.release()
+	c.expect(1, iproto.RcOK)
+
+	// request rejected by MaxInFlight didn't take second token
+	c.send(3)
+	waitGot(t, s)
+	s.release()
+	c.expect(3, iproto.RcOK)
+}
+
+func TestMaxRequestSize(t *testing.T) {
+	s := newHoldService()
+	serv, c := runLimited(t, server.Config{EndPoint: s, MaxRequestSize: 8})
+	defer serv.Stop()
+
+	c.send(1)
+	waitGot(t, s)
+	s.release()
+	c.expect(1, iproto.RcOK)
+
+	if err := c.w.WriteRequest(nt.Request{Msg: msgTest, Id: 2, Body: make([]byte, 20)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	c.expect(2, iproto.RcProtocolError)
+	if _, err := c.r.ReadResponse(); err == nil {
+		t.Errorf("Connection should be closed after too large request")
+	}
+	select {
+	case <-s.got:
+		t.Errorf("Too large request should not be sent to end point")
+	default:
+	}
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+)
+
+// Middleware wraps EndPoint's service to intercept requests
+type Middleware func(iproto.Service) iproto.Service
+
+// Chain wraps service with middlewares, first middleware is outermost
+func Chain(s iproto.Service, mws ...Middleware) iproto.Service {
+	for i := len(mws) - 1; i >= 0; i-- {
+		s = mws[i](s)
+	}
+	return s
+}
+
+// ConnectionOf returns connection request were read from, or nil
+func ConnectionOf(r *iproto.Request) *Connection {
+	conn, _ := r.Responder.(*Connection)
+	return conn
+}
+
+// Call is a request seen by Hooks
+type Call struct {
+	Request *iproto.Request
+	Conn    *Connection
+	Start   iproto.Epoch
+}
+
+// Logger returns Logger of server request were read by
+func (c *Call) Logger() iproto.Logger {
+	return loggerOf(c.Conn)
+}
+
+func loggerOf(conn *Connection) iproto.Logger {
+	if conn != nil {
+		return conn.Logger
+	}
+	return iproto.DefaultLogger
+}
+
+type Hooks struct {
+	// Before is called before request is passed further.
+	// If it returns code other than RcOK, request is answered with the code.
+	Before func(c *Call) iproto.RetCode
+	// After is called when response is ready, but before it is passed to connection
+	After func(c *Call, res *iproto.Response, elapsed time.Duration)
+}
+
+func Intercept(h Hooks) Middleware {
+	return func(s iproto.Service) iproto.Service {
+		return &hooked{Service: s, h: h}
+	}
+}
+
+type hooked struct {
+	iproto.Service
+	h Hooks
+}
+
+func (s *hooked) Send(r *iproto.Request) {
+	bm := &hookBookmark{Call: Call{Request: r, Conn: ConnectionOf(r), Start: iproto.NowEpoch()}, h: &s.h}
+	if s.h.Before != nil {
+		if code := s.h.Before(&bm.Call); code != iproto.RcOK {
+			r.RespondFail(code)
+			return
+		}
+	}
+	if s.h.After == nil || r.ChainBookmark(bm) {
+		s.Service.Send(r)
+	}
+}
+
+type hookBookmark struct {
+	iproto.Bookmark
+	Call
+	h *Hooks
+}
+
+func (bm *hookBookmark) Respond(res *iproto.Response) {
+	bm.h.After(&bm.Call, res, bm.Start.Elapsed())
+}
+
+// Logging logs every response with logf, or with server's Logger if logf is nil
+func Logging(logf func(format string, args ...interface{})) Middleware {
+	return Intercept(Hooks{
+		After: func(c *Call, res *iproto.Response, elapsed time.Duration) {
+			var remote interface{}
+			if c.Conn != nil {
+				remote = c.Conn.RemoteAddr()
+			}
+			if logf == nil {
+				c.Logger().Info("Response", "remote", remote, "msg", c.Request.Msg, "id", res.Id, "code", res.Code,
+					"req", len(c.Request.Body), "res", len(res.Body), "elapsed", elapsed)
+				return
+			}
+			logf("%v msg=%d id=%d code=%x req=%d res=%d %v",
+				remote, c.Request.Msg, res.Id, res.Code, len(c.Request.Body), len(res.Body), elapsed)
+		},
+	})
+}
+
+// Recovery answers request with RcInternalError, if service panics while accepting request.
+// Panic is logged with server's Logger. Only panics raised synchronously in Send are caught:
+// ParallelService made by BF recovers panics of its function itself, and answers RcInternalError
+// as well, panic in other goroutine which service starts still crashes the process.
+func Recovery() Middleware {
+	return func(s iproto.Service) iproto.Service {
+		return &recovery{Service: s}
+	}
+}
+
+type recovery struct {
+	iproto.Service
+}
+
+func (s *recovery) Send(r *iproto.Request) {
+	defer s.recover(r)
+	s.Service.Send(r)
+}
+
+func (s *recovery) recover(r *iproto.Request) {
+	if err := recover(); err != nil {
+		btrace := &[2048]byte{}
+		n := runtime.Stack(btrace[:], false)
+		loggerOf(ConnectionOf(r)).Error("Service panic", "msg", r.Msg, "id", r.Id, "panic", err, "stack", string(btrace[:n]))
+		r.RespondFail(iproto.RcInternalError)
+	}
+}
+
+// MaxBodySize answers requests with body larger than size with code.
+// RcProtocolError is used if code is RcOK.
+func MaxBodySize(size int, code iproto.RetCode) Middleware {
+	if code == iproto.RcOK {
+		code = iproto.RcProtocolError
+	}
+	return Intercept(Hooks{
+		Before: func(c *Call) iproto.RetCode {
+			if len(c.Request.Body) > size {
+				return code
+			}
+			return iproto.RcOK
+		},
+	})
+}
+
+type MsgStats struct {
+	Count   uint64
+	Errors  uint64
+	Time    time.Duration
+	MaxTime time.Duration
+}
+
+// Metrics collects per message type statistic
+type Metrics struct {
+	m     sync.Mutex
+	stats map[iproto.RequestType]*MsgStats
+}
+
+func (m *Metrics) Middleware() Middleware {
+	return Intercept(Hooks{After: m.after})
+}
+
+func (m *Metrics) after(c *Call, res *iproto.Response, elapsed time.Duration) {
+	m.m.Lock()
+	if m.stats == nil {
+		m.stats = make(map[iproto.RequestType]*MsgStats)
+	}
+	st := m.stats[c.Request.Msg]
+	if st == nil {
+		st = &MsgStats{}
+		m.stats[c.Request.Msg] = st
+	}
+	st.Count++
+	if !res.Valid() {
+		st.Errors++
+	}
+	st.Time += elapsed
+	if elapsed > st.MaxTime {
+		st.MaxTime = elapsed
+	}
+	m.m.Unlock()
+}
+
+// Snapshot returns copy of collected statistic
+func (m *Metrics) Snapshot() map[iproto.RequestType]MsgStats {
+	m.m.Lock()
+	res := make(map[iproto.RequestType]MsgStats, len(m.stats))
+	for msg, st := range m.stats {
+		res[msg] = *st
+	}
+	m.m.Unlock()
+	return res
+}
@@ -0,0 +1,175 @@
+package server_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/net/client"
+	"github.com/funny-falcon/go-iproto/net/server"
+)
+
+const msgTest = iproto.RequestType(29)
+
+type record struct {
+	sync.Mutex
+	events []string
+}
+
+func (r *record) add(format string, args ...interface{}) {
+	r.Lock()
+	r.events = append(r.events, fmt.Sprintf(format, args...))
+	r.Unlock()
+}
+
+func (r *record) String() string {
+	r.Lock()
+	defer r.Unlock()
+	return strings.Join(r.events, ",")
+}
+
+// logger records messages with level
+type logger struct {
+	record
+}
+
+func (l *logger) Debug(msg string, args ...any) { l.add("DEBUG %s", msg) }
+func (l *logger) Info(msg string, args ...any)  { l.add("INFO %s", msg) }
+func (l *logger) Warn(msg string, args ...any)  { l.add("WARN %s", msg) }
+func (l *logger) Error(msg string, args ...any) { l.add("ERROR %s", msg) }
+
+func hooks(rec *record, name string, code iproto.RetCode) server.Middleware {
+	return server.Intercept(server.Hooks{
+		Before: func(c *server.Call) iproto.RetCode {
+			rec.add("%s before", name)
+			return code
+		},
+		After: func(c *server.Call, res *iproto.Response, elapsed time.Duration) {
+			rec.add("%s after %x", name, res.Code)
+		},
+	})
+}
+
+func recordService(rec *record) iproto.Service {
+	return iproto.SF(func(r *iproto.Request) {
+		rec.add("service")
+		r.RespondBytes(iproto.RcOK, nil)
+	})
+}
+
+func TestChainOrder(t *testing.T) {
+	var rec record
+	s := server.Chain(recordService(&rec), hooks(&rec, "a", iproto.RcOK), hooks(&rec, "b", iproto.RcOK))
+	iproto.CallMsgBody(s, msgTest, nil)
+	if ev, expect := rec.String(), "a before,b before,service,b after 0,a after 0"; ev != expect {
+		t.Errorf("Hooks are called as %s, expect %s", ev, expect)
+	}
+
+	rec.events = nil
+	s = server.Chain(recordService(&rec), hooks(&rec, "a", iproto.RcOK), hooks(&rec, "b", 0x102))
+	if res := iproto.CallMsgBody(s, msgTest, nil); res.Code != 0x102 {
+		t.Errorf("Before's code should be returned, got %x", res.Code)
+	}
+	if ev, expect := rec.String(), "a before,b before,a after 102"; ev != expect {
+		t.Errorf("Hooks are called as %s, expect %s", ev, expect)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	var rec record
+	s := server.Chain(recordService(&rec), server.MaxBodySize(8, iproto.RcOK))
+	if res := iproto.CallMsgBody(s, msgTest, make([]byte, 20)); res.Code != iproto.RcProtocolError {
+		t.Errorf("Large body should be rejected, got %x", res.Code)
+	}
+	if res := iproto.CallMsgBody(s, msgTest, []byte("a")); res.Code != iproto.RcOK {
+		t.Errorf("Small body should pass, got %x", res.Code)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	panicking := iproto.SF(func(r *iproto.Request) {
+		panic("boom")
+	})
+	s := server.Chain(panicking, server.Recovery())
+	if res := iproto.CallMsgBody(s, msgTest, nil); res.Code != iproto.RcInternalError {
+		t.Errorf("Panic should be answered with RcInternalError, got %x", res.Code)
+	}
+}
+
+func TestRecoveryBF(t *testing.T) {
+	var log logger
+	bf := iproto.BF{Logger: &log}.New(func(cx *iproto.Context, r *iproto.Request) (iproto.RetCode, interface{}) {
+		if len(r.Body) > 0 {
+			panic("boom")
+		}
+		return iproto.RcOK, nil
+	})
+	defer bf.Stop()
+	cfg := &server.Config{
+		Network:     "tcp",
+		Address:     "127.0.0.1:0",
+		EndPoint:    bf,
+		Middlewares: []server.Middleware{server.Recovery()},
+		Logger:      iproto.NopLogger{},
+	}
+	serv := cfg.NewServer()
+	if err := serv.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer serv.Stop()
+	cli := (&client.ServerConfig{Address: serv.Addr().String(), Timeout: time.Second, Logger: iproto.NopLogger{}}).NewServer()
+	iproto.Run(cli)
+	defer cli.Stop()
+
+	if res := iproto.CallMsgBody(cli, msgTest, []byte("x")); res.Code != iproto.RcInternalError {
+		t.Errorf("Panic of BF function should be answered with RcInternalError, got %x", res.Code)
+	}
+	if !strings.Contains(log.String(), "ERROR Service panic") {
+		t.Errorf("Panic is not logged with BF's Logger: %s", log.String())
+	}
+	if res := iproto.CallMsgBody(cli, msgTest, nil); res.Code != iproto.RcOK {
+		t.Errorf("Service should work after panic, got %x", res.Code)
+	}
+}
+
+func TestMiddlewareLogger(t *testing.T) {
+	panicking := iproto.SF(func(r *iproto.Request) {
+		if len(r.Body) > 0 {
+			panic("boom")
+		}
+		r.RespondBytes(iproto.RcOK, nil)
+	})
+	var log logger
+	cfg := &server.Config{
+		Network:     "tcp",
+		Address:     "127.0.0.1:0",
+		EndPoint:    panicking,
+		Middlewares: []server.Middleware{server.Logging(nil), server.Recovery()},
+		Logger:      &log,
+	}
+	serv := cfg.NewServer()
+	if err := serv.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer serv.Stop()
+	cli := (&client.ServerConfig{Address: serv.Addr().String(), Timeout: time.Second, Logger: iproto.NopLogger{}}).NewServer()
+	iproto.Run(cli)
+	defer cli.Stop()
+
+	if res := iproto.CallMsgBody(cli, msgTest, nil); res.Code != iproto.RcOK {
+		t.Fatalf("Request failed %x", res.Code)
+	}
+	if res := iproto.CallMsgBody(cli, msgTest, []byte("x")); res.Code != iproto.RcInternalError {
+		t.Fatalf("Panic should be answered with RcInternalError, got %x", res.Code)
+	}
+	ev := log.String()
+	if strings.Count(ev, "INFO Response") != 2 {
+		t.Errorf("Responses are not logged with server's Logger: %s", ev)
+	}
+	if !strings.Contains(ev, "ERROR Service panic") {
+		t.Errorf("Panic is not logged with server's Logger: %s", ev)
+	}
+}
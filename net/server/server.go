@@ -1,12 +1,19 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/metrics"
 	nt "github.com/funny-falcon/go-iproto/net"
 )
 
@@ -17,33 +24,52 @@ type Server struct {
 	listener net.Listener
 
 	closing    bool
+	draining   uint32
 	stop       chan bool
 	connClosed chan uint64
 
 	sync.Mutex
 	conns     map[uint64]*Connection
+	hosts     map[string]*host
+	forgot    time.Time
 	currentId uint64
 }
 
-func (cfg *Config) NewServer() (serv *Server) {
+// New validates config and creates server
+func New(cfg *Config) (*Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg.newServer(), nil
+}
+
+// NewServer panics on invalid config, use New to get an error instead
+func (cfg *Config) NewServer() *Server {
+	serv, err := New(cfg)
+	if err != nil {
+		log.Panic(err)
+	}
+	return serv
+}
+
+func (cfg *Config) newServer() (serv *Server) {
 	serv = &Server{
 		Config: *cfg,
 	}
-	if serv.RCMap != nil {
-		for k, v := range serv.RCMap {
-			if k&iproto.RcKindMask != iproto.RcInternal {
-				log.Panicf("Should map internal ret code %x to non internal code", k)
-			}
-			if v&iproto.RcKindMask == iproto.RcInternal {
-				log.Panicf("Should not map internal ret code %d to internal ret code %d", k, v)
-			}
-		}
+	if serv.Logger == nil {
+		serv.Logger = iproto.DefaultLogger
+	}
+
+	serv.EndPoint = Chain(serv.EndPoint, serv.Middlewares...)
+	if serv.Metrics != nil {
+		serv.EndPoint = serv.Metrics.Wrap(metrics.Server, serv.Address, serv.EndPoint)
 	}
 
 	serv.Running = make(chan bool)
 	serv.stop = make(chan bool, 1)
 	serv.connClosed = make(chan uint64)
 	serv.conns = make(map[uint64]*Connection)
+	serv.hosts = make(map[string]*host)
 
 	return
 }
@@ -55,37 +81,152 @@ func (serv *Server) Run() (err error) {
 	if serv.listener, err = net.Listen(serv.Network, serv.Address); err != nil {
 		return
 	}
-	log.Println("Binded to", serv.Address)
+	serv.Logger.Info("Binded", "address", serv.listener.Addr())
 
 	go serv.listenLoop()
 	go serv.controlLoop()
 	return
 }
 
+func (serv *Server) logConn(msg string, args ...any) {
+	if serv.QuietConnections {
+		serv.Logger.Debug(msg, args...)
+	} else {
+		serv.Logger.Info(msg, args...)
+	}
+}
+
+// Addr returns address server is listening on, it is useful when Address has zero port
+func (serv *Server) Addr() net.Addr {
+	return serv.listener.Addr()
+}
+
 func (serv *Server) Stop() {
 	serv.Lock()
+	if serv.closing {
+		serv.Unlock()
+		return
+	}
 	serv.closing = true
+	if serv.listener == nil {
+		/* never runned */
+		serv.Unlock()
+		return
+	}
 	serv.stop <- true
 	serv.Unlock()
 	serv.listener.Close()
 }
 
+var ErrClosing = errors.New("iproto server is already closing")
+
+// ShutdownPoll is an interval of checking connections for in fly requests in Shutdown
+var ShutdownPoll = 10 * time.Millisecond
+
+// ShutdownFlush is a time given to connections to write RcShutdown answers after Shutdown's ctx is done
+var ShutdownFlush = time.Second
+
+// Shutdown stops accepting connections and waits for in fly requests to be answered.
+// If DrainPings is set, connections are still read: pings are answered and other requests
+// are rejected with RcShutdown. When ctx is done, requests left are answered with RcShutdown,
+// connections are closed, and count of those requests is returned as dropped together with ctx.Err().
+func (serv *Server) Shutdown(ctx context.Context) (dropped int, err error) {
+	serv.Lock()
+	if serv.closing {
+		serv.Unlock()
+		return 0, ErrClosing
+	}
+	serv.closing = true
+	if serv.listener == nil {
+		/* never runned */
+		serv.Unlock()
+		return 0, nil
+	}
+	atomic.StoreUint32(&serv.draining, 1)
+	serv.stop <- !serv.DrainPings
+	serv.Unlock()
+	serv.listener.Close()
+
+	tick := time.NewTicker(ShutdownPoll)
+	defer tick.Stop()
+Wait:
+	for serv.inFly() > 0 {
+		select {
+		case <-tick.C:
+		case <-serv.Running:
+			break Wait
+		case <-ctx.Done():
+			err = ctx.Err()
+			break Wait
+		}
+	}
+
+	serv.Lock()
+	conns := make([]*Connection, 0, len(serv.conns))
+	for _, conn := range serv.conns {
+		conns = append(conns, conn)
+	}
+	serv.Unlock()
+	for _, conn := range conns {
+		if err != nil {
+			dropped += conn.shutdownInFly()
+		}
+		conn.Stop()
+	}
+
+	if err != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), ShutdownFlush)
+		defer cancel()
+	}
+	select {
+	case <-serv.Running:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+		for _, conn := range conns {
+			conn.conn.Close()
+		}
+		<-serv.Running
+	}
+	return
+}
+
+func (serv *Server) inFly() (n int) {
+	serv.Lock()
+	for _, conn := range serv.conns {
+		n += conn.InFlight()
+	}
+	serv.Unlock()
+	return
+}
+
 func (serv *Server) controlLoop() {
 	defer close(serv.Running)
 	for {
 		select {
 		case id := <-serv.connClosed:
 			serv.Lock()
+			if conn, ok := serv.conns[id]; ok {
+				serv.releaseConn(conn.host)
+				if serv.Metrics != nil {
+					serv.Metrics.ConnectionsChanged(serv.Address, -1)
+					serv.Metrics.UntrackInFlight(metrics.Server, serv.Address, strconv.FormatUint(id, 10))
+				}
+			}
 			delete(serv.conns, id)
 			if serv.closing && len(serv.conns) == 0 {
 				serv.Unlock()
 				return
 			}
 			serv.Unlock()
-		case <-serv.stop:
+		case stopConns := <-serv.stop:
 			serv.Lock()
-			for _, conn := range serv.conns {
-				conn.Stop()
+			if stopConns {
+				for _, conn := range serv.conns {
+					conn.Stop()
+				}
 			}
 			if len(serv.conns) == 0 {
 				serv.Unlock()
@@ -105,21 +246,39 @@ func (serv *Server) listenLoop() {
 				serv.Unlock()
 				break
 			} else {
-				log.Printf("Accept on %s:%s failed with %v", serv.Network, serv.Address, err)
+				serv.Logger.Error("Accept failed", "network", serv.Network, "address", serv.Address, "err", err)
 			}
 			serv.Unlock()
 			continue
 		}
-		log.Printf("Accepted %s on %s", conn.RemoteAddr(), conn.LocalAddr())
 		serv.Lock()
 		if serv.closing {
 			serv.Unlock()
 			conn.Close()
 			break
 		}
+		h, ok := serv.acceptConn(conn.RemoteAddr())
+		if !ok {
+			serv.Unlock()
+			serv.logConn("Rejected over limit", "remote", conn.RemoteAddr(), "local", conn.LocalAddr())
+			conn.Close()
+			continue
+		}
 		serv.currentId++
-		connection := NewConnection(serv, conn.(nt.NetConn), serv.currentId)
+		serv.logConn("Accepted", "conn", serv.currentId, "remote", conn.RemoteAddr(), "local", conn.LocalAddr())
+		var netconn nt.NetConn
+		if serv.TLSConfig != nil {
+			netconn = nt.NewTLSConn(tls.Server(conn, serv.TLSConfig), conn)
+		} else {
+			netconn = conn.(nt.NetConn)
+		}
+		connection := NewConnection(serv, netconn, serv.currentId)
+		connection.host = h
 		serv.conns[serv.currentId] = connection
+		if serv.Metrics != nil {
+			serv.Metrics.ConnectionsChanged(serv.Address, 1)
+			serv.Metrics.TrackInFlight(metrics.Server, serv.Address, strconv.FormatUint(serv.currentId, 10), connection.InFlight)
+		}
 		connection.Run()
 		serv.Unlock()
 	}
@@ -0,0 +1,160 @@
+package server_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/net/client"
+	"github.com/funny-falcon/go-iproto/net/server"
+)
+
+// holdService keeps requests until release
+type holdService struct {
+	m    sync.Mutex
+	reqs []*iproto.Request
+	got  chan struct{}
+}
+
+func newHoldService() *holdService {
+	return &holdService{got: make(chan struct{}, 16)}
+}
+
+func (s *holdService) Send(r *iproto.Request) {
+	if r.SetPending() && r.SetInFly(nil) {
+		s.m.Lock()
+		s.reqs = append(s.reqs, r)
+		s.m.Unlock()
+		s.got <- struct{}{}
+	}
+}
+
+func (s *holdService) Runned() bool                  { return true }
+func (s *holdService) DefaultTimeout() time.Duration { return 0 }
+
+func (s *holdService) release() {
+	s.m.Lock()
+	reqs := s.reqs
+	s.reqs = nil
+	s.m.Unlock()
+	for _, r := range reqs {
+		r.RespondBytes(iproto.RcOK, nil)
+	}
+}
+
+func runHold(t *testing.T, s *holdService, n int) (*server.Server, []<-chan *iproto.Response) {
+	serv := (&server.Config{Network: "tcp", Address: "127.0.0.1:0", EndPoint: s, Logger: iproto.NopLogger{}}).NewServer()
+	if err := serv.Run(); err != nil {
+		t.Fatal(err)
+	}
+	cli := (&client.ServerConfig{Address: serv.Addr().String(), Timeout: 5 * time.Second, Logger: iproto.NopLogger{}}).NewServer()
+	iproto.Run(cli)
+	t.Cleanup(cli.Stop)
+
+	var cx iproto.Context
+	var reses []<-chan *iproto.Response
+	for i := 0; i < n; i++ {
+		_, res := cx.SendMsgBody(cli, msgTest, nil)
+		reses = append(reses, res)
+		select {
+		case <-s.got:
+		case <-time.After(time.Second):
+			t.Fatalf("Request is not received by server")
+		}
+	}
+	return serv, reses
+}
+
+func TestShutdownNotRunned(t *testing.T) {
+	serv := (&server.Config{Network: "tcp", Address: "127.0.0.1:0", EndPoint: newHoldService(), Logger: iproto.NopLogger{}}).NewServer()
+	if dropped, err := serv.Shutdown(context.Background()); dropped != 0 || err != nil {
+		t.Errorf("Shutdown of not runned server returned %d %v", dropped, err)
+	}
+	serv = (&server.Config{Network: "tcp", Address: "127.0.0.1:0", EndPoint: newHoldService(), Logger: iproto.NopLogger{}}).NewServer()
+	serv.Stop()
+}
+
+func TestShutdownDrain(t *testing.T) {
+	s := newHoldService()
+	serv, reses := runHold(t, s, 2)
+
+	time.AfterFunc(50*time.Millisecond, s.release)
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	dropped, err := serv.Shutdown(ctx)
+	if dropped != 0 || err != nil {
+		t.Errorf("Graceful shutdown returned %d %v", dropped, err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("Shutdown did not wait for requests in fly: %v", d)
+	}
+	for _, res := range reses {
+		if r := <-res; r.Code != iproto.RcOK {
+			t.Errorf("Request in fly should be answered, got %x", r.Code)
+		}
+	}
+	if _, err = serv.Shutdown(ctx); err != server.ErrClosing {
+		t.Errorf("Second shutdown should fail with ErrClosing, got %v", err)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	s := newHoldService()
+	serv, reses := runHold(t, s, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	dropped, err := serv.Shutdown(ctx)
+	if dropped != 3 || err != context.DeadlineExceeded {
+		t.Errorf("Shutdown by timeout returned %d %v, expect 3 requests dropped", dropped, err)
+	}
+	// internal codes are sent as fatal ones
+	shutdown := iproto.RcShutdown&^iproto.RcKindMask | iproto.RcFatal
+	for _, res := range reses {
+		if r := <-res; r.Code != shutdown {
+			t.Errorf("Dropped request should be answered with RcShutdown, got %x", r.Code)
+		}
+	}
+	s.release()
+}
+
+func TestQuietConnections(t *testing.T) {
+	for _, quiet := range []bool{false, true} {
+		var log logger
+		cfg := &server.Config{
+			Network:          "tcp",
+			Address:          "127.0.0.1:0",
+			EndPoint:         iproto.SF(func(r *iproto.Request) { r.RespondBytes(iproto.RcOK, nil) }),
+			Logger:           &log,
+			QuietConnections: quiet,
+		}
+		serv := cfg.NewServer()
+		if err := serv.Run(); err != nil {
+			t.Fatal(err)
+		}
+		cli := (&client.ServerConfig{Address: serv.Addr().String(), Timeout: time.Second, Logger: iproto.NopLogger{}}).NewServer()
+		iproto.Run(cli)
+		if res := iproto.CallMsgBody(cli, msgTest, nil); res.Code != iproto.RcOK {
+			t.Fatalf("Request failed %x", res.Code)
+		}
+		cli.Stop()
+		for start := time.Now(); !strings.Contains(log.String(), "Closed"); time.Sleep(time.Millisecond) {
+			if time.Since(start) > time.Second {
+				t.Fatalf("Closed connection is not logged: %s", log.String())
+			}
+		}
+		serv.Stop()
+
+		level := "INFO"
+		if quiet {
+			level = "DEBUG"
+		}
+		if ev := log.String(); !strings.HasPrefix(ev, "INFO Binded,"+level+" Accepted,") || !strings.Contains(ev, level+" Closed") {
+			t.Errorf("Connections should be logged with %s level when QuietConnections is %v: %s", level, quiet, ev)
+		}
+	}
+}
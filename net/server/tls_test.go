@@ -0,0 +1,162 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/net/client"
+	"github.com/funny-falcon/go-iproto/net/server"
+)
+
+// testCA issues certificates for loopback server and clients
+type testCA struct {
+	t    *testing.T
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	next int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	ca := &testCA{t: t, pool: x509.NewCertPool()}
+	tmpl := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test ca"},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	ca.cert, ca.key = ca.issue(tmpl, nil, nil)
+	ca.pool.AddCert(ca.cert)
+	return ca
+}
+
+func (ca *testCA) issue(tmpl *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	ca.t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	ca.next++
+	tmpl.SerialNumber = big.NewInt(ca.next)
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	return cert, key
+}
+
+// leaf returns certificate of name for loopback address
+func (ca *testCA) leaf(name string, usage x509.ExtKeyUsage) tls.Certificate {
+	cert, key := ca.issue(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{usage},
+	}, ca.cert, ca.key)
+	return tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key, Leaf: cert}
+}
+
+func runTLS(t *testing.T, cfg *tls.Config, ep iproto.Service) *server.Server {
+	serv := (&server.Config{Network: "tcp", Address: "127.0.0.1:0", EndPoint: ep, TLSConfig: cfg, Logger: iproto.NopLogger{}}).NewServer()
+	if err := serv.Run(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(serv.Stop)
+	return serv
+}
+
+func runTLSClient(t *testing.T, serv *server.Server, cfg *tls.Config) *client.Server {
+	cli := (&client.ServerConfig{Address: serv.Addr().String(), Timeout: time.Second, TLSConfig: cfg, Logger: iproto.NopLogger{}}).NewServer()
+	iproto.Run(cli)
+	t.Cleanup(cli.Stop)
+	return cli
+}
+
+// waitRejected waits until client fails to establish connection
+func waitRejected(t *testing.T, cli *client.Server) error {
+	t.Helper()
+	for start := time.Now(); cli.LastError() == nil; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Connection is not rejected")
+		}
+	}
+	if res := iproto.CallMsgBody(cli, msgTest, nil); res.Code != iproto.RcIOError {
+		t.Errorf("Request of rejected client should fail with RcIOError, got %x", res.Code)
+	}
+	return cli.LastError()
+}
+
+func TestTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serv := runTLS(t, &tls.Config{Certificates: []tls.Certificate{ca.leaf("server", x509.ExtKeyUsageServerAuth)}},
+		iproto.SF(func(r *iproto.Request) {
+			r.RespondBytes(iproto.RcOK, append([]byte("echo "), r.Body...))
+		}))
+
+	cli := runTLSClient(t, serv, &tls.Config{RootCAs: ca.pool})
+	if res := iproto.CallMsgBody(cli, msgTest, iproto.Body("tls")); res.Code != iproto.RcOK || string(res.Body) != "echo tls" {
+		t.Errorf("Unexpected response %x %q", res.Code, res.Body)
+	}
+
+	var unknown x509.UnknownAuthorityError
+	if err := waitRejected(t, runTLSClient(t, serv, &tls.Config{})); !errors.As(err, &unknown) {
+		t.Errorf("Client should not trust unknown server certificate, got %v", err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	peers := make(chan string, 4)
+	serv := runTLS(t, &tls.Config{
+		Certificates: []tls.Certificate{ca.leaf("server", x509.ExtKeyUsageServerAuth)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	}, iproto.SF(func(r *iproto.Request) {
+		var name string
+		if certs := server.ConnectionOf(r).PeerCertificates(); len(certs) > 0 {
+			name = certs[0].Subject.CommonName
+		}
+		peers <- name
+		r.RespondBytes(iproto.RcOK, nil)
+	}))
+
+	waitRejected(t, runTLSClient(t, serv, &tls.Config{RootCAs: ca.pool}))
+
+	cli := runTLSClient(t, serv, &tls.Config{
+		RootCAs:      ca.pool,
+		Certificates: []tls.Certificate{ca.leaf("app", x509.ExtKeyUsageClientAuth)},
+	})
+	if res := iproto.CallMsgBody(cli, msgTest, nil); res.Code != iproto.RcOK {
+		t.Fatalf("Client with certificate should be accepted, got %x", res.Code)
+	}
+	select {
+	case name := <-peers:
+		if name != "app" {
+			t.Errorf("Server connection has peer certificate %q, expect app", name)
+		}
+	default:
+		t.Errorf("Request is not received by server")
+	}
+	if len(peers) != 0 {
+		t.Errorf("Request of rejected client reached server")
+	}
+}
@@ -20,19 +20,15 @@ func (sl *SliceReader) Read(n int) (res []byte, err error) {
 		sl.buf = sl.buf[n:]
 		return
 	}
-	var buf []byte
-	if cap(sl.buf) < n {
-		if n > sl.size {
-			buf = make([]byte, len(sl.buf), n)
-		} else {
-			buf = make([]byte, len(sl.buf), sl.size)
-		}
-		copy(buf, sl.buf)
-	} else {
-		buf = sl.buf
+	buf := sl.buf
+	if cap(buf) < n && cap(buf) < sl.size {
+		buf = sl.grow(buf, n)
 	}
 	l := len(buf)
 	for l < n && err == nil {
+		if l == cap(buf) {
+			buf = sl.grow(buf, n)
+		}
 		var nn int
 		nn, err = sl.read(buf[l:cap(buf)])
 		l += nn
@@ -49,17 +45,32 @@ func (sl *SliceReader) Read(n int) (res []byte, err error) {
 	return
 }
 
+// grow doubles buffer up to n, so large declared length is allocated only as bytes arrive
+func (sl *SliceReader) grow(buf []byte, n int) []byte {
+	c := 2 * cap(buf)
+	if c < sl.size {
+		c = sl.size
+	}
+	if n > sl.size && c > n {
+		c = n
+	}
+	nbuf := make([]byte, len(buf), c)
+	copy(nbuf, buf)
+	return nbuf
+}
+
 func (sl *SliceReader) ReadByte() (res byte, err error) {
 	if len(sl.buf) > 0 {
 		res = sl.buf[0]
 		sl.buf = sl.buf[1:]
 		return
 	}
-	var buf []byte
+	buf := sl.buf
 	var n int
 	if cap(buf) == 0 {
-		buf = make([]byte, len(sl.buf), sl.size)
+		buf = make([]byte, 0, sl.size)
 	}
+	buf = buf[:cap(buf)]
 	n, err = sl.read(buf)
 	if n >= 1 {
 		res = buf[0]
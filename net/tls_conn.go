@@ -0,0 +1,64 @@
+package net
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// TLSConn adapts *tls.Conn to NetConn.
+// TLS could not half-close reading side, so CloseRead sets read deadline in a past
+// and following reads return io.EOF. CloseWrite sends close_notify, which peer reads as io.EOF,
+// and then half-closes underlying connection if it is possible.
+type TLSConn struct {
+	*tls.Conn
+	raw        net.Conn
+	readClosed uint32
+}
+
+func NewTLSConn(conn *tls.Conn, raw net.Conn) *TLSConn {
+	return &TLSConn{Conn: conn, raw: raw}
+}
+
+var pastTime = time.Unix(1, 0)
+
+func (c *TLSConn) Read(b []byte) (n int, err error) {
+	if atomic.LoadUint32(&c.readClosed) != 0 {
+		return 0, io.EOF
+	}
+	if n, err = c.Conn.Read(b); err != nil && atomic.LoadUint32(&c.readClosed) != 0 {
+		err = io.EOF
+	}
+	return
+}
+
+func (c *TLSConn) CloseRead() error {
+	atomic.StoreUint32(&c.readClosed, 1)
+	return c.Conn.SetReadDeadline(pastTime)
+}
+
+func (c *TLSConn) CloseWrite() (err error) {
+	err = c.Conn.CloseWrite()
+	if cw, ok := c.raw.(interface{ CloseWrite() error }); ok {
+		if err2 := cw.CloseWrite(); err == nil {
+			err = err2
+		}
+	}
+	return
+}
+
+func (c *TLSConn) SetReadDeadline(t time.Time) (err error) {
+	err = c.Conn.SetReadDeadline(t)
+	if atomic.LoadUint32(&c.readClosed) != 0 {
+		err = c.Conn.SetReadDeadline(pastTime)
+	}
+	return
+}
+
+// PeerCertificates returns certificates presented by peer, available after handshake
+func (c *TLSConn) PeerCertificates() []*x509.Certificate {
+	return c.Conn.ConnectionState().PeerCertificates
+}
@@ -0,0 +1,125 @@
+package net
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func selfSigned(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// tlsPair returns client and server ends of loopback TLS connection
+func tlsPair(t *testing.T) (cli, srv *TLSConn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := l.Accept()
+		accepted <- c
+	}()
+	raw, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srvRaw := <-accepted
+	if srvRaw == nil {
+		t.Fatal("Connection is not accepted")
+	}
+	cli = NewTLSConn(tls.Client(raw, &tls.Config{InsecureSkipVerify: true}), raw)
+	srv = NewTLSConn(tls.Server(srvRaw, &tls.Config{Certificates: []tls.Certificate{selfSigned(t)}}), srvRaw)
+	t.Cleanup(func() {
+		cli.Close()
+		srv.Close()
+	})
+	return
+}
+
+var _ NetConn = (*TLSConn)(nil)
+
+func TestTLSConnCloseWrite(t *testing.T) {
+	cli, srv := tlsPair(t)
+	go func() {
+		cli.Write([]byte("ping"))
+		cli.CloseWrite()
+	}()
+	srv.SetReadDeadline(time.Now().Add(time.Second))
+	data, err := io.ReadAll(srv)
+	if err != nil || string(data) != "ping" {
+		t.Fatalf("Read %q %v, expect ping and io.EOF after CloseWrite", data, err)
+	}
+
+	// other direction is still open
+	if _, err = srv.Write([]byte("pong")); err != nil {
+		t.Fatalf("Write after peer's CloseWrite: %v", err)
+	}
+	srv.CloseWrite()
+	cli.SetReadDeadline(time.Now().Add(time.Second))
+	if data, err = io.ReadAll(cli); err != nil || string(data) != "pong" {
+		t.Errorf("Read %q %v, expect pong and io.EOF", data, err)
+	}
+}
+
+func TestTLSConnCloseRead(t *testing.T) {
+	cli, srv := tlsPair(t)
+	go cli.Write([]byte("x"))
+	buf := make([]byte, 1)
+	if _, err := io.ReadFull(srv, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := srv.Read(buf)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := srv.CloseRead(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Errorf("Blocked Read returned %v, expect io.EOF", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("CloseRead does not wake blocked Read")
+	}
+
+	// deadline of reader does not reopen reading side
+	srv.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := srv.Read(buf); err != io.EOF {
+		t.Errorf("Read after CloseRead returned %v, expect io.EOF", err)
+	}
+	if _, err := srv.Write([]byte("y")); err != nil {
+		t.Errorf("Write after CloseRead: %v", err)
+	}
+	cli.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(cli, buf); err != nil || buf[0] != 'y' {
+		t.Errorf("Peer read %q %v after CloseRead", buf, err)
+	}
+}
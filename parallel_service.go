@@ -12,19 +12,38 @@ var _ = log.Print
 type BF struct {
 	N       int
 	Timeout time.Duration
+	// Logger reports panics of service function, DefaultLogger is used if nil
+	Logger Logger
+
+	// MaxQueue, MaxQueueBytes, Overflow and OverflowCode bound queue, see SimplePoint
+	MaxQueue      int
+	MaxQueueBytes int
+	Overflow      Overflow
+	OverflowCode  RetCode
+	// Priorities orders waiting requests by priority, see SimplePoint
+	Priorities bool
 }
 
 func (b BF) New(f func(*Context, *Request) (RetCode, interface{})) (serv *ParallelService) {
 	if b.N == 0 {
 		b.N = 1
 	}
+	if b.Logger == nil {
+		b.Logger = DefaultLogger
+	}
 	serv = &ParallelService{
 		SimplePoint: SimplePoint{
-			Timeout: b.Timeout,
+			Timeout:       b.Timeout,
+			MaxQueue:      b.MaxQueue,
+			MaxQueueBytes: b.MaxQueueBytes,
+			Overflow:      b.Overflow,
+			OverflowCode:  b.OverflowCode,
+			Priorities:    b.Priorities,
 		},
-		f:    f,
-		sema: make(chan struct{}, b.N),
-		gens: make(generators, b.N),
+		f:      f,
+		sema:   make(chan struct{}, b.N),
+		gens:   make(generators, b.N),
+		logger: b.Logger,
 	}
 	serv.SimplePoint.Init(serv)
 	for i := 0; i < b.N; i++ {
@@ -40,6 +59,8 @@ type ParallelService struct {
 	f    func(*Context, *Request) (RetCode, interface{})
 	sema chan struct{}
 	gens generators
+
+	logger Logger
 }
 
 func (serv *ParallelService) Loop() {
@@ -47,21 +68,16 @@ func (serv *ParallelService) Loop() {
 	var ok bool
 Loop:
 	for {
+		/* take worker before request, so waiting requests stay ordered in buffer */
 		select {
 		case <-serv.ExitChan():
 			break Loop
 		default:
 			select {
-			case req, ok = <-serv.ReceiveChan():
-				if !ok {
-					break Loop
-				}
+			case <-serv.sema:
 			default:
 				select {
-				case req, ok = <-serv.ReceiveChan():
-					if !ok {
-						break Loop
-					}
+				case <-serv.sema:
 				case <-serv.ExitChan():
 					break Loop
 				}
@@ -70,16 +86,20 @@ Loop:
 
 		select {
 		case <-serv.ExitChan():
-			req.ShutDown()
 			break Loop
 		default:
 			select {
-			case <-serv.sema:
+			case req, ok = <-serv.ReceiveChan():
+				if !ok {
+					break Loop
+				}
 			default:
 				select {
-				case <-serv.sema:
+				case req, ok = <-serv.ReceiveChan():
+					if !ok {
+						break Loop
+					}
 				case <-serv.ExitChan():
-					req.ShutDown()
 					break Loop
 				}
 			}
@@ -101,12 +121,15 @@ Loop:
 	}
 }
 
-func (serv *ParallelService) inc(ctx *ReqContext) {
+func (serv *ParallelService) inc(ctx *ReqContext, req *Request) {
 	if err := recover(); err != nil {
-		log.Print(err)
 		btrace := &[2048]byte{}
 		n := runtime.Stack(btrace[:], false)
-		log.Printf("%s", btrace[:n])
+		args := []any{"panic", err, "stack", string(btrace[:n])}
+		if req != nil {
+			args = append(args, "msg", req.Msg, "id", req.Id)
+		}
+		serv.logger.Error("Service panic", args...)
 	}
 	ctx.Done()
 	ctx.gen.Release()
@@ -114,8 +137,9 @@ func (serv *ParallelService) inc(ctx *ReqContext) {
 }
 
 func (serv *ParallelService) serv(ctx *ReqContext) {
-	defer serv.inc(ctx)
-	if req := ctx.Request; req != nil {
+	req := ctx.Request
+	defer serv.inc(ctx, req)
+	if req != nil {
 		req.Respond(serv.f(&ctx.Context, req))
 	}
 }
@@ -0,0 +1,113 @@
+package iproto_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+)
+
+// orderService runs requests one by one and records first byte of their bodies,
+// request with zero byte waits for release
+type orderService struct {
+	*iproto.ParallelService
+	m       sync.Mutex
+	order   []byte
+	release chan struct{}
+	started chan struct{}
+}
+
+func newOrderService() *orderService {
+	s := &orderService{release: make(chan struct{}), started: make(chan struct{})}
+	s.ParallelService = iproto.BF{N: 1, Priorities: true}.New(func(cx *iproto.Context, r *iproto.Request) (iproto.RetCode, interface{}) {
+		if r.Body[0] == 0 {
+			close(s.started)
+			<-s.release
+			return iproto.RcOK, nil
+		}
+		s.m.Lock()
+		s.order = append(s.order, r.Body[0])
+		s.m.Unlock()
+		return iproto.RcOK, nil
+	})
+	return s
+}
+
+func (s *orderService) send(p iproto.Priority, b byte) iproto.Chan {
+	res := make(iproto.Chan, 1)
+	s.Send(&iproto.Request{Msg: msgGet, Body: []byte{b}, Priority: p, Responder: res})
+	return res
+}
+
+// hold makes service busy, so following requests are queued
+func (s *orderService) hold(t *testing.T) {
+	t.Helper()
+	s.send(iproto.PriorityNormal, 0)
+	<-s.started
+	// buffer's loop takes one request from queue before service is ready to receive,
+	// so filler goes first
+	s.send(iproto.PriorityNormal, 'f')
+	for start := time.Now(); s.QueueLen() != 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Filler is not taken from queue")
+		}
+	}
+}
+
+func (s *orderService) wait(t *testing.T, reses []iproto.Chan) string {
+	t.Helper()
+	close(s.release)
+	for _, res := range reses {
+		select {
+		case <-res:
+		case <-time.After(time.Second):
+			t.Fatalf("Request is not answered")
+		}
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	return string(s.order)
+}
+
+func TestPriorityOrder(t *testing.T) {
+	s := newOrderService()
+	defer s.Stop()
+	s.hold(t)
+
+	var reses []iproto.Chan
+	for _, b := range []byte("bbb") {
+		reses = append(reses, s.send(iproto.PriorityBackground, b))
+	}
+	for _, b := range []byte("nnn") {
+		reses = append(reses, s.send(iproto.PriorityNormal, b))
+	}
+	for _, b := range []byte("iii") {
+		reses = append(reses, s.send(iproto.PriorityInteractive, b))
+	}
+	if order := s.wait(t, reses); order != "fiiinnnbbb" {
+		t.Errorf("Requests are received in order %s, expect higher priorities first", order)
+	}
+}
+
+func TestPriorityStarvation(t *testing.T) {
+	s := newOrderService()
+	defer s.Stop()
+	s.hold(t)
+
+	reses := []iproto.Chan{s.send(iproto.PriorityBackground, 'b')}
+	for i := 0; i < 3*iproto.StarvationLimit; i++ {
+		reses = append(reses, s.send(iproto.PriorityInteractive, 'i'))
+	}
+	order := s.wait(t, reses)
+	pos := -1
+	for i := range order {
+		if order[i] == 'b' {
+			pos = i
+		}
+	}
+	// filler and StarvationLimit interactive requests could go before background one
+	if pos < 0 || pos > iproto.StarvationLimit+1 {
+		t.Errorf("Background request starves, order %s", order)
+	}
+}
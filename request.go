@@ -9,6 +9,8 @@ import (
 	"github.com/funny-falcon/go-iproto/marshal"
 )
 
+var _ = log.Print
+
 // RequestType is a iproto request tag which goes fiRst in a packet
 type RequestType uint32
 
@@ -20,6 +22,28 @@ const (
 	PingRequestId = ^uint32(0)
 )
 
+// Priority orders requests waiting in end point with Priorities enabled
+type Priority int8
+
+const (
+	PriorityBackground  = Priority(-1)
+	PriorityNormal      = Priority(0)
+	PriorityInteractive = Priority(1)
+)
+
+const nPriorities = 3
+
+// class is an index of queue in Buffer
+func (p Priority) class() int {
+	switch {
+	case p < PriorityNormal:
+		return 0
+	case p > PriorityNormal:
+		return 2
+	}
+	return 1
+}
+
 type RequestData interface {
 	IMsg() RequestType
 }
@@ -31,6 +55,7 @@ type Request struct {
 	Body      Body
 	Response  *Response
 	Responder Responder
+	Priority  Priority
 	chain     RequestBookmark
 	sync.Mutex
 	timer    Timer
@@ -111,13 +136,12 @@ func (r *Request) Canceled() bool {
 }
 
 // ResetToPending is for ResendeRs on IOError. It should be called in a Responder.
-// Note, if it returns false, then Responder is already performed
+// Note, if it returns false, then Responder is already performed or it is called outside of Responder
 func (r *Request) ResetToPending() bool {
 	if r.state == RsPrepared {
 		r.state = RsPending
 		return true
 	}
-	log.Panicf("ResetToPending should be called only for performed requests")
 	return false
 }
 
@@ -126,7 +150,6 @@ func (r *Request) ResetToNew() bool {
 		r.state = RsNew
 		return true
 	}
-	log.Panicf("ResetToNew should be called only for performed requests")
 	return false
 }
 
@@ -202,8 +225,9 @@ func (cm *ReqContext) Respond(res *Response) {
 		cm.Cancel()
 	} else if res.Code == RcTimeout {
 		cm.Expire()
-		cm.Request.ResetToPending()
-		cm.Request.SetInFly(nil)
+		if cm.Request.ResetToPending() {
+			cm.Request.SetInFly(nil)
+		}
 	} else {
 		cm.Context.Done()
 	}
@@ -218,6 +242,7 @@ func (cm *ReqContext) Done() {
 
 func (r *Request) Context() (cx *ReqContext) {
 	cx = &ReqContext{}
+	cx.Priority = r.Priority
 	if !r.SetInFly(cx) {
 		return nil
 	}
@@ -267,6 +292,32 @@ func Call(serv Service, r RequestData) *Response {
 	return CallMsgBody(serv, r.IMsg(), r)
 }
 
+// BatchSender is implemented by services which pass several requests further at once,
+// so that client connection writes them with one flush
+type BatchSender interface {
+	SendBatch(reqs []*Request)
+}
+
+// SendBatch passes requests with SendBatch of serv if it is a BatchSender, or sends them one by one
+func SendBatch(serv Service, reqs []*Request) {
+	if bs, ok := serv.(BatchSender); ok {
+		bs.SendBatch(reqs)
+		return
+	}
+	for _, r := range reqs {
+		serv.Send(r)
+	}
+}
+
+// CallBatch sends requests with SendBatch and waits for all responses. Responses are ordered as requests.
+// Client server writes requests with one flush, if it has established connection.
+func CallBatch(serv Service, reqs []RequestData) MultiResponse {
+	multi := &MultiRequest{}
+	multi.TimeoutFrom(serv)
+	multi.SendBatch(serv, reqs)
+	return multi.Results().Sort()
+}
+
 type Body []byte
 
 func (b Body) IWrite(w *marshal.Writer) {
@@ -11,6 +11,8 @@ type RetCode uint32
 // RcShortBody - response with body shorter, than return code
 // RcIOError - socket were disconnected before answere arrives
 // RcCanceled - ...
+// RcCircuitOpen - request were not sent cause CircuitBreaker is open
+// RcOverload - request were not queued cause queue of end point is full
 const (
 	RcOK        = RetCode(0)
 	RcTemporary = RetCode(1)
@@ -28,6 +30,9 @@ const (
 	RcCanceled = RetCode(0xff03)
 	RcIOError  = RetCode(0xfe03)
 	RcTimeout  = RetCode(0xfd03)
+
+	RcCircuitOpen = RetCode(0xfb03)
+	RcOverload    = RetCode(0xfa01)
 )
 
 type Response struct {
@@ -0,0 +1,119 @@
+package iproto
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryService resends requests answered with RcTemporary kind of return code.
+// Requests answered with RcIOError are resent only if Idempotent reports so,
+// cause they could be already performed by a remote side.
+type RetryService struct {
+	Service
+	// Attempts is a total number of sends, including first one
+	Attempts int
+	// Backoff is a base delay before second send. It is doubled on each next attempt.
+	Backoff time.Duration
+	// MaxBackoff limits delay between attempts
+	MaxBackoff time.Duration
+	// Idempotent tells whether request could be resent after RcIOError
+	Idempotent func(RequestType) bool
+}
+
+const (
+	DefaultRetryAttempts   = 3
+	DefaultRetryBackoff    = 10 * time.Millisecond
+	DefaultRetryMaxBackoff = time.Second
+)
+
+func RetryWrap(s Service, idempotent func(RequestType) bool) *RetryService {
+	return &RetryService{Service: s, Idempotent: idempotent}
+}
+
+// IdempotentTypes returns predicate for RetryService.Idempotent which accepts listed request types
+func IdempotentTypes(types ...RequestType) func(RequestType) bool {
+	set := make(map[RequestType]struct{}, len(types))
+	for _, t := range types {
+		set[t] = struct{}{}
+	}
+	return func(t RequestType) bool {
+		_, ok := set[t]
+		return ok
+	}
+}
+
+func (rs *RetryService) Send(r *Request) {
+	bm := &retryBookmark{s: rs, start: NowEpoch()}
+	if r.ChainBookmark(bm) {
+		rs.Service.Send(r)
+	}
+}
+
+func (rs *RetryService) attempts() int {
+	if rs.Attempts > 0 {
+		return rs.Attempts
+	}
+	return DefaultRetryAttempts
+}
+
+func (rs *RetryService) delay(attempt int) time.Duration {
+	base, max := rs.Backoff, rs.MaxBackoff
+	if base <= 0 {
+		base = DefaultRetryBackoff
+	}
+	if max <= 0 {
+		max = DefaultRetryMaxBackoff
+	}
+	d := base << uint(attempt-1)
+	if d > max || d <= 0 {
+		d = max
+	}
+	/* equal jitter: uniformly distributed in [d/2, d] */
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (rs *RetryService) retryable(r *Request, code RetCode) bool {
+	if code == RcIOError {
+		return rs.Idempotent != nil && rs.Idempotent(r.Msg)
+	}
+	return code&RcKindMask == RcTemporary
+}
+
+type retryBookmark struct {
+	Bookmark
+	s       *RetryService
+	start   Epoch
+	attempt int
+}
+
+func (bm *retryBookmark) Respond(res *Response) {
+	r := bm.Request
+	bm.attempt++
+	if bm.attempt >= bm.s.attempts() || !bm.s.retryable(r, res.Code) {
+		return
+	}
+	delay := bm.s.delay(bm.attempt)
+	// retry should not outlive request, so it is limited with request's own timeout
+	deadline, ok := r.Timer().Deadline()
+	if !ok {
+		if timeout := bm.s.DefaultTimeout(); timeout > 0 {
+			deadline, ok = bm.start.Add(timeout), true
+		}
+	}
+	if ok && deadline.Remains() <= delay {
+		return
+	}
+	if !r.ResetToNew() {
+		return
+	}
+	time.AfterFunc(delay, bm.resend)
+}
+
+func (bm *retryBookmark) resend() {
+	bm.Lock()
+	r := bm.Request
+	bm.Unlock()
+	if r != nil && r.State() == RsNew {
+		bm.s.Service.Send(r)
+	}
+}
@@ -0,0 +1,128 @@
+package iproto_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	nt "github.com/funny-falcon/go-iproto/net"
+	"github.com/funny-falcon/go-iproto/net/iprototest"
+)
+
+const (
+	msgRetry = iproto.RequestType(17)
+	rcBusy   = iproto.RetCode(0x101)
+)
+
+func retryServer(t *testing.T, timeout time.Duration) (*iprototest.Server, iproto.EndPoint) {
+	srv := iprototest.NewServer(nt.RC4byte)
+	cfg := srv.Config()
+	cfg.Timeout = timeout
+	cli := cfg.NewServer()
+	iproto.Run(cli)
+	t.Cleanup(func() {
+		cli.Stop()
+		srv.Close()
+	})
+	return srv, cli
+}
+
+func TestRetryAttempts(t *testing.T) {
+	srv, cli := retryServer(t, time.Second)
+	rs := &iproto.RetryService{Service: cli, Backoff: time.Millisecond}
+
+	srv.Script(msgRetry, iprototest.Reply{Code: rcBusy}, iprototest.Reply{Code: rcBusy})
+	if res := iproto.CallMsgBody(rs, msgRetry, nil); res.Code != iproto.RcOK {
+		t.Errorf("Third attempt should succeed, got %x", res.Code)
+	}
+	if n := len(srv.RequestsOf(msgRetry)); n != 3 {
+		t.Errorf("Three sends expected, got %d", n)
+	}
+
+	srv.Reset()
+	rs.Attempts = 2
+	srv.Script(msgRetry, iprototest.Reply{Code: rcBusy}, iprototest.Reply{Code: rcBusy})
+	if res := iproto.CallMsgBody(rs, msgRetry, nil); res.Code != rcBusy {
+		t.Errorf("Last temporary code should be returned, got %x", res.Code)
+	}
+	if n := len(srv.RequestsOf(msgRetry)); n != 2 {
+		t.Errorf("Two sends expected, got %d", n)
+	}
+
+	srv.Reset()
+	srv.Script(msgRetry, iprototest.Reply{Code: 0x102})
+	if res := iproto.CallMsgBody(rs, msgRetry, nil); res.Code != 0x102 {
+		t.Errorf("Fatal code should be returned, got %x", res.Code)
+	}
+	if n := len(srv.RequestsOf(msgRetry)); n != 1 {
+		t.Errorf("Fatal code should not be retried, got %d sends", n)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	srv, cli := retryServer(t, time.Second)
+	rs := &iproto.RetryService{Service: cli, Backoff: 40 * time.Millisecond}
+
+	srv.Script(msgRetry, iprototest.Reply{Code: rcBusy}, iprototest.Reply{Code: rcBusy})
+	start := time.Now()
+	iproto.CallMsgBody(rs, msgRetry, nil)
+	// delays are at least half of 40ms and 80ms
+	if d := time.Since(start); d < 60*time.Millisecond {
+		t.Errorf("Backoff is too short: %v", d)
+	}
+
+	srv.Reset()
+	rs.Backoff, rs.MaxBackoff = time.Second, 20*time.Millisecond
+	srv.Script(msgRetry, iprototest.Reply{Code: rcBusy}, iprototest.Reply{Code: rcBusy})
+	start = time.Now()
+	iproto.CallMsgBody(rs, msgRetry, nil)
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Backoff is not limited by MaxBackoff: %v", d)
+	}
+}
+
+func TestRetryDeadline(t *testing.T) {
+	srv, cli := retryServer(t, time.Second)
+	rs := &iproto.RetryService{Service: cli, Backoff: 300 * time.Millisecond}
+
+	// request's own timeout is shorter than service's one
+	srv.Script(msgRetry, iprototest.Reply{Code: rcBusy})
+	cx := &iproto.Context{}
+	req, res := cx.NewRequest(msgRetry, nil)
+	req.SetTimeout(100 * time.Millisecond)
+	start := time.Now()
+	rs.Send(req)
+	if r := <-res; r.Code != rcBusy {
+		t.Errorf("Temporary code should be returned, got %x", r.Code)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("Retry outlived request timeout: %v", d)
+	}
+	if n := len(srv.RequestsOf(msgRetry)); n != 1 {
+		t.Errorf("Retry should be skipped, got %d sends", n)
+	}
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	srv, cli := retryServer(t, time.Second)
+	rs := &iproto.RetryService{Service: cli, Backoff: time.Millisecond}
+
+	srv.Script(msgRetry, iprototest.Reply{Disconnect: true})
+	if res := iproto.CallMsgBody(rs, msgRetry, nil); res.Code != iproto.RcIOError {
+		t.Errorf("IOError expected, got %x", res.Code)
+	}
+	if n := len(srv.RequestsOf(msgRetry)); n != 1 {
+		t.Errorf("Not idempotent request should not be retried, got %d sends", n)
+	}
+
+	srv.Reset()
+	rs.Idempotent = iproto.IdempotentTypes(msgRetry)
+	rs.Attempts, rs.Backoff = 10, 50*time.Millisecond
+	srv.Script(msgRetry, iprototest.Reply{Disconnect: true})
+	if res := iproto.CallMsgBody(rs, msgRetry, nil); res.Code != iproto.RcOK {
+		t.Errorf("Idempotent request should be retried after reconnect, got %x", res.Code)
+	}
+	if n := len(srv.RequestsOf(msgRetry)); n != 2 {
+		t.Errorf("Two sends expected, got %d", n)
+	}
+}
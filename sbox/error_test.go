@@ -0,0 +1,28 @@
+package sbox_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/sbox"
+)
+
+func TestErrors(t *testing.T) {
+	box := usersBox(user{1, "a@x"})
+
+	_, err := sbox.Select[user](nil, box, sbox.SelectReq{Space: 9, Limit: 1, Keys: uint32(1)})
+	if !errors.Is(err, sbox.ErrIllegalParams) || errors.Is(err, sbox.ErrWrongField) {
+		t.Errorf("Error should match sentinel of its code only, got %v", err)
+	}
+	if !iproto.IsFatal(err) || iproto.IsTemporary(err) {
+		t.Errorf("RcIllegalParams should be fatal, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "illegal params") {
+		t.Errorf("Error message should have name of sbox code: %v", err)
+	}
+	if !iproto.IsTemporary(sbox.ErrLocked) || !errors.Is(iproto.RetCode(0x0601).Err(), sbox.ErrLocked) {
+		t.Errorf("RcLocked should be temporary")
+	}
+}
@@ -12,6 +12,14 @@ import (
 
 var _ = log.Print
 
+// ITupleReader is implemented by types which read themselves from a whole tuple,
+// written as ITupleWriter does. iprotogen generates it for structs.
+type ITupleReader interface {
+	ITupleRead(r *marshal.Reader)
+}
+
+var ituplereader = reflect.TypeOf(new(ITupleReader)).Elem()
+
 func oneFieldTuple(r *marshal.Reader, sz int) bool {
 	var l, s int
 	if l = r.IntUint32(); l >= 1 {
@@ -140,9 +148,23 @@ func (t *TReader) bytesAuto(r *marshal.Reader, v reflect.Value) {
 	}
 }
 
+func (t *TReader) tupleReader(r *marshal.Reader, v reflect.Value) {
+	if !v.CanAddr() {
+		r.Err = fmt.Errorf("Could not read tuple into not addressable %+v", v.Type())
+		return
+	}
+	v.Addr().Interface().(ITupleReader).ITupleRead(r)
+}
+
 func (t *TReader) Fill() {
 	rt := t.Reader.Type
 
+	if reflect.PtrTo(rt).Implements(ituplereader) {
+		t.Fixed = t.tupleReader
+		t.Auto = t.tupleReader
+		return
+	}
+
 	switch rt.Kind() {
 	case reflect.Ptr:
 		elrd := _reader(rt.Elem())
@@ -240,7 +262,7 @@ func (sw *TReader) structAuto(r *marshal.Reader, v reflect.Value) {
 		tail := l - len(flds) + 1
 		last := flds[len(flds)-1]
 		if sw.Tail == TailSplit {
-			llast := len(last.Flds)
+			llast := len(last.Elem.Flds)
 			tail /= llast
 		}
 		last.TReader.SetCount(v.Field(last.I), tail)
@@ -248,6 +270,22 @@ func (sw *TReader) structAuto(r *marshal.Reader, v reflect.Value) {
 	sw.structRead(r, l, v)
 }
 
+// readOpt reads empty field as nil optional pointer
+func readOpt(r *marshal.Reader, fs *marshal.FieldReader, v reflect.Value) {
+	sz := r.Intvar()
+	if r.Err != nil {
+		return
+	}
+	if sz == 0 {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+	if v.IsNil() {
+		v.Set(reflect.New(v.Type().Elem()))
+	}
+	fs.WithSize(r, v, func(*marshal.Reader) int { return sz })
+}
+
 func (sw *TReader) structRead(r *marshal.Reader, k int, v reflect.Value) {
 	flds := sw.Reader.Flds
 	n := len(flds)
@@ -256,6 +294,10 @@ func (sw *TReader) structRead(r *marshal.Reader, k int, v reflect.Value) {
 	}
 	for i := 0; i < n && i < k; i++ {
 		fs := &flds[i]
+		if fs.Opt {
+			readOpt(r, fs, v.Field(fs.I))
+			continue
+		}
 		fs.WithSize(r, v.Field(fs.I), (*marshal.Reader).Intvar)
 	}
 	if k <= n {
@@ -265,22 +307,22 @@ func (sw *TReader) structRead(r *marshal.Reader, k int, v reflect.Value) {
 	case NoTail:
 	case Tail:
 		fs := &flds[n]
-		fv := v.Field(n)
+		fv := v.Field(fs.I)
 		l := fv.Len()
 		for i := 0; i < l && n+i < k; i++ {
 			val := fv.Index(i)
-			fs.WithSize(r, val, (*marshal.Reader).Intvar)
+			fs.Elem.WithSize(r, val, (*marshal.Reader).Intvar)
 		}
 	case TailSplit:
 		fs := &flds[n]
-		fv := v.Field(n)
+		fv := v.Field(fs.I)
 		l := fv.Len()
-		fss := fs.TReader.Flds
+		fss := fs.Elem.Flds
 		fl := len(fss)
 		for i := 0; i < l; i++ {
 			str := fv.Index(i)
 			for j := 0; j < fl && n+i*fl+j < k; j++ {
-				fss[i].WithSize(r, str.Field(i), (*marshal.Reader).Intvar)
+				fss[j].WithSize(r, str.Field(fss[j].I), (*marshal.Reader).Intvar)
 			}
 		}
 	}
@@ -33,3 +33,55 @@ const (
 	RcTupleExists          = iproto.RetCode(0x3702)
 	RcDuplicateKey         = iproto.RetCode(0x3802)
 )
+
+var (
+	ErrReadOnly             = &iproto.Error{Code: RcReadOnly}
+	ErrLocked               = &iproto.Error{Code: RcLocked}
+	ErrMemoryIssue          = &iproto.Error{Code: RcMemoryIssue}
+	ErrNonMaster            = &iproto.Error{Code: RcNonMaster}
+	ErrIllegalParams        = &iproto.Error{Code: RcIllegalParams}
+	ErrSecondaryPort        = &iproto.Error{Code: RcSecondaryPort}
+	ErrBadIntegrity         = &iproto.Error{Code: RcBadIntegrity}
+	ErrUnsupportedCommand   = &iproto.Error{Code: RcUnsupportedCommand}
+	ErrDuplicate            = &iproto.Error{Code: RcDuplicate}
+	ErrWrongField           = &iproto.Error{Code: RcWrongField}
+	ErrWrongNumber          = &iproto.Error{Code: RcWrongNumber}
+	ErrWrongVersion         = &iproto.Error{Code: RcWrongVersion}
+	ErrWalIO                = &iproto.Error{Code: RcWalIO}
+	ErrDoesntExists         = &iproto.Error{Code: RcDoesntExists}
+	ErrStoredProcNotDefined = &iproto.Error{Code: RcStoredProcNotDefined}
+	ErrLuaError             = &iproto.Error{Code: RcLuaError}
+	ErrTupleExists          = &iproto.Error{Code: RcTupleExists}
+	ErrDuplicateKey         = &iproto.Error{Code: RcDuplicateKey}
+)
+
+func init() {
+	for code, name := range map[iproto.RetCode]string{
+		RcReadOnly:             "read only",
+		RcLocked:               "locked",
+		RcMemoryIssue:          "memory issue",
+		RcNonMaster:            "non master",
+		RcIllegalParams:        "illegal params",
+		RcSecondaryPort:        "secondary port",
+		RcBadIntegrity:         "bad integrity",
+		RcUnsupportedCommand:   "unsupported command",
+		RcDuplicate:            "duplicate",
+		RcWrongField:           "wrong field",
+		RcWrongNumber:          "wrong number",
+		RcWrongVersion:         "wrong version",
+		RcWalIO:                "wal io",
+		RcDoesntExists:         "doesn't exists",
+		RcStoredProcNotDefined: "stored procedure not defined",
+		RcLuaError:             "lua error",
+		RcTupleExists:          "tuple exists",
+		RcDuplicateKey:         "duplicate key",
+	} {
+		iproto.RetCodeNames[code] = name
+	}
+}
+
+// Idempotent reports whether request could be safely resent, when it is not known
+// if it were performed. It is suitable for iproto.RetryService.Idempotent .
+func Idempotent(msg iproto.RequestType) bool {
+	return msg == SelectReq{}.IMsg()
+}
@@ -0,0 +1,317 @@
+/*
+Package sboxtest is an in-memory emulator of octopus/box for tests.
+It understands select (17), insert (13), update (19), delete (21) and call (22)
+in the same wire format sbox writes, and answers with sbox Rc* codes.
+
+	box := sboxtest.New()
+	box.AddSpace(0, sboxtest.Index{Fields: []int{0}, Types: []sboxtest.FieldType{sboxtest.Num}},
+		sboxtest.Index{Fields: []int{1}, Types: []sboxtest.FieldType{sboxtest.Str}, Tree: true})
+	res := iproto.Call(box, sbox.StoreReq{Space: 0, Tuple: tuple})
+
+Box is an iproto.Service, so it could be used directly or served with Listen.
+*/
+package sboxtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/net/server"
+	"github.com/funny-falcon/go-iproto/sbox"
+)
+
+var _ = log.Print
+
+var le = binary.LittleEndian
+
+type FieldType uint8
+
+const (
+	// Num is 4 byte unsigned integer
+	Num = FieldType(iota)
+	// Num64 is 8 byte unsigned integer
+	Num64
+	// Str is compared as bytes
+	Str
+)
+
+type Index struct {
+	Fields []int
+	Types  []FieldType
+	// Tree index is ordered and allows select by key prefix, hash index needs full key
+	Tree bool
+	// Unique is implied for hash indexes and for primary index
+	Unique bool
+}
+
+// Tuple is a list of raw fields
+type Tuple [][]byte
+
+// Proc is a stored procedure for call request, it is called with box locked
+type Proc func(args []string) ([]Tuple, iproto.RetCode)
+
+type space struct {
+	indexes []Index
+	tuples  []Tuple
+}
+
+type Box struct {
+	m      sync.Mutex
+	spaces map[uint32]*space
+	procs  map[string]Proc
+}
+
+func New() *Box {
+	return &Box{
+		spaces: make(map[uint32]*space),
+		procs:  make(map[string]Proc),
+	}
+}
+
+// AddSpace creates empty space, first index is primary
+func (b *Box) AddSpace(no uint32, indexes ...Index) {
+	if len(indexes) == 0 {
+		log.Panicf("Space %d should have primary index", no)
+	}
+	for i := range indexes {
+		ind := &indexes[i]
+		if len(ind.Fields) == 0 || len(ind.Fields) != len(ind.Types) {
+			log.Panicf("Index %d of space %d should have same number of fields and types", i, no)
+		}
+		if i == 0 || !ind.Tree {
+			ind.Unique = true
+		}
+	}
+	b.m.Lock()
+	b.spaces[no] = &space{indexes: indexes}
+	b.m.Unlock()
+}
+
+func (b *Box) Proc(name string, p Proc) {
+	b.m.Lock()
+	b.procs[name] = p
+	b.m.Unlock()
+}
+
+// Put stores tuple as insert-or-replace does
+func (b *Box) Put(no uint32, tuple Tuple) iproto.RetCode {
+	b.m.Lock()
+	defer b.m.Unlock()
+	sp := b.spaces[no]
+	if sp == nil {
+		return sbox.RcIllegalParams
+	}
+	_, code := sp.store(tuple, sbox.InsertOrReplace)
+	return code
+}
+
+// Tuples returns copy of space content in primary key order for tree primary index,
+// or in insertion order for hash
+func (b *Box) Tuples(no uint32) []Tuple {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if sp := b.spaces[no]; sp != nil {
+		return append([]Tuple(nil), sp.tuples...)
+	}
+	return nil
+}
+
+func (b *Box) Send(r *iproto.Request) {
+	if r.SetPending() && r.SetInFly(nil) {
+		b.m.Lock()
+		code, body := b.serve(r.Msg, r.Body)
+		b.m.Unlock()
+		r.RespondBytes(code, body)
+	}
+}
+
+func (b *Box) Runned() bool {
+	return true
+}
+
+func (b *Box) DefaultTimeout() time.Duration {
+	return 0
+}
+
+// Listen serves box with net/server, use Addr of returned server if address has zero port.
+// Server logs nothing.
+func (b *Box) Listen(address string) (*server.Server, error) {
+	serv, err := server.New(&server.Config{Network: "tcp", Address: address, EndPoint: b, Logger: iproto.NopLogger{}})
+	if err != nil {
+		return nil, err
+	}
+	if err = serv.Run(); err != nil {
+		return nil, err
+	}
+	return serv, nil
+}
+
+func (ind *Index) key(t Tuple) Tuple {
+	key := make(Tuple, len(ind.Fields))
+	for i, f := range ind.Fields {
+		key[i] = t[f]
+	}
+	return key
+}
+
+func (ind *Index) validField(i int, f []byte) bool {
+	switch ind.Types[i] {
+	case Num:
+		return len(f) == 4
+	case Num64:
+		return len(f) == 8
+	}
+	return true
+}
+
+func (ind *Index) validKey(key Tuple) iproto.RetCode {
+	if len(key) > len(ind.Fields) || (!ind.Tree && len(key) != len(ind.Fields)) {
+		return sbox.RcIllegalParams
+	}
+	for i, f := range key {
+		if !ind.validField(i, f) {
+			return sbox.RcWrongField
+		}
+	}
+	return sbox.RcOK
+}
+
+func (ind *Index) validTuple(t Tuple) iproto.RetCode {
+	for i, f := range ind.Fields {
+		if f >= len(t) {
+			return sbox.RcIllegalParams
+		}
+		if !ind.validField(i, t[f]) {
+			return sbox.RcWrongField
+		}
+	}
+	return sbox.RcOK
+}
+
+// compare compares first len(key) fields of tuple's index key with key
+func (ind *Index) compare(t Tuple, key Tuple) int {
+	for i, k := range key {
+		f := t[ind.Fields[i]]
+		var c int
+		switch ind.Types[i] {
+		case Num:
+			c = cmpUint(uint64(le.Uint32(f)), uint64(le.Uint32(k)))
+		case Num64:
+			c = cmpUint(le.Uint64(f), le.Uint64(k))
+		default:
+			c = bytes.Compare(f, k)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func cmpUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (sp *space) find(ind *Index, key Tuple) (res []Tuple) {
+	for _, t := range sp.tuples {
+		if ind.compare(t, key) == 0 {
+			res = append(res, t)
+		}
+	}
+	if ind.Tree {
+		pk := &sp.indexes[0]
+		sort.SliceStable(res, func(i, j int) bool {
+			if c := ind.compare(res[i], ind.key(res[j])); c != 0 {
+				return c < 0
+			}
+			return pk.compare(res[i], pk.key(res[j])) < 0
+		})
+	}
+	return
+}
+
+func (sp *space) position(key Tuple) int {
+	pk := &sp.indexes[0]
+	for i, t := range sp.tuples {
+		if pk.compare(t, key) == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// check validates tuple and uniqueness of its keys, tuple at position skip is ignored
+func (sp *space) check(t Tuple, skip int) iproto.RetCode {
+	for i := range sp.indexes {
+		if code := sp.indexes[i].validTuple(t); code != sbox.RcOK {
+			return code
+		}
+	}
+	for i := 1; i < len(sp.indexes); i++ {
+		ind := &sp.indexes[i]
+		if !ind.Unique {
+			continue
+		}
+		key := ind.key(t)
+		for j, o := range sp.tuples {
+			if j != skip && ind.compare(o, key) == 0 {
+				return sbox.RcDuplicateKey
+			}
+		}
+	}
+	return sbox.RcOK
+}
+
+func (sp *space) store(t Tuple, mode sbox.InsertMode) (old Tuple, code iproto.RetCode) {
+	if code = sp.indexes[0].validTuple(t); code != sbox.RcOK {
+		return
+	}
+	pos := sp.position(sp.indexes[0].key(t))
+	switch {
+	case pos >= 0 && mode == sbox.Insert:
+		return nil, sbox.RcTupleExists
+	case pos < 0 && mode == sbox.Replace:
+		return nil, sbox.RcDoesntExists
+	}
+	if code = sp.check(t, pos); code != sbox.RcOK {
+		return
+	}
+	if pos >= 0 {
+		old = sp.tuples[pos]
+		sp.tuples[pos] = t
+	} else {
+		sp.insert(t)
+	}
+	return
+}
+
+// insert keeps tuples ordered by tree primary key
+func (sp *space) insert(t Tuple) {
+	pk := &sp.indexes[0]
+	if !pk.Tree {
+		sp.tuples = append(sp.tuples, t)
+		return
+	}
+	key := pk.key(t)
+	i := sort.Search(len(sp.tuples), func(i int) bool { return pk.compare(sp.tuples[i], key) > 0 })
+	sp.tuples = append(sp.tuples, nil)
+	copy(sp.tuples[i+1:], sp.tuples[i:])
+	sp.tuples[i] = t
+}
+
+func (sp *space) remove(pos int) {
+	copy(sp.tuples[pos:], sp.tuples[pos+1:])
+	sp.tuples[len(sp.tuples)-1] = nil
+	sp.tuples = sp.tuples[:len(sp.tuples)-1]
+}
@@ -0,0 +1,158 @@
+package sboxtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/net/client"
+	"github.com/funny-falcon/go-iproto/sbox"
+)
+
+type User struct {
+	Id    uint32
+	Email string
+	Score uint32
+}
+
+func newBox() *Box {
+	box := New()
+	box.AddSpace(0,
+		Index{Fields: []int{0}, Types: []FieldType{Num}, Tree: true},
+		Index{Fields: []int{1}, Types: []FieldType{Str}},
+		Index{Fields: []int{2}, Types: []FieldType{Num}, Tree: true},
+	)
+	return box
+}
+
+func selectUsers(t *testing.T, serv iproto.Service, req sbox.SelectReq) (users []User) {
+	res := iproto.Call(serv, req)
+	if res.Code != sbox.RcOK {
+		t.Fatalf("Select failed with %x", res.Code)
+	}
+	if _, _, err := sbox.ReadMany(res.Body, &users); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestStoreSelect(t *testing.T) {
+	box := newBox()
+	for _, u := range []User{{3, "c@x", 10}, {1, "a@x", 20}, {2, "b@x", 10}} {
+		if res := iproto.Call(box, sbox.StoreReq{Space: 0, Mode: uint16(sbox.Insert), Tuple: u}); res.Code != sbox.RcOK {
+			t.Fatalf("Insert failed with %x", res.Code)
+		}
+	}
+	if res := iproto.Call(box, sbox.StoreReq{Space: 0, Mode: uint16(sbox.Insert), Tuple: User{1, "z@x", 0}}); res.Code != sbox.RcTupleExists {
+		t.Errorf("Insert of existing should fail with RcTupleExists, got %x", res.Code)
+	}
+	if res := iproto.Call(box, sbox.StoreReq{Space: 0, Mode: uint16(sbox.Replace), Tuple: User{7, "z@x", 0}}); res.Code != sbox.RcDoesntExists {
+		t.Errorf("Replace of absent should fail with RcDoesntExists, got %x", res.Code)
+	}
+	if res := iproto.Call(box, sbox.StoreReq{Space: 0, Tuple: User{4, "a@x", 0}}); res.Code != sbox.RcDuplicateKey {
+		t.Errorf("Duplicate of unique key should fail with RcDuplicateKey, got %x", res.Code)
+	}
+
+	users := selectUsers(t, box, sbox.SelectReq{Space: 0, Index: 0, Limit: sbox.SelectAll, Keys: []uint32{2, 3, 5}})
+	if len(users) != 2 || users[0].Email != "b@x" || users[1].Email != "c@x" {
+		t.Errorf("Wrong select by primary key %+v", users)
+	}
+	users = selectUsers(t, box, sbox.SelectReq{Space: 0, Index: 1, Limit: sbox.SelectAll, Keys: "a@x"})
+	if len(users) != 1 || users[0].Id != 1 {
+		t.Errorf("Wrong select by hash key %+v", users)
+	}
+	users = selectUsers(t, box, sbox.SelectReq{Space: 0, Index: 2, Offset: 1, Limit: 5, Keys: uint32(10)})
+	if len(users) != 1 || users[0].Id != 3 {
+		t.Errorf("Wrong select by non unique tree key with offset %+v", users)
+	}
+	if res := iproto.Call(box, sbox.SelectReq{Space: 0, Index: 1, Limit: 1, Keys: uint32(1)}); res.Code != sbox.RcOK {
+		t.Errorf("Select by string key with 4 bytes should pass, got %x", res.Code)
+	}
+	if res := iproto.Call(box, sbox.SelectReq{Space: 0, Index: 0, Limit: 1, Keys: "long key"}); res.Code != sbox.RcWrongField {
+		t.Errorf("Select by wrong key should fail with RcWrongField, got %x", res.Code)
+	}
+	if res := iproto.Call(box, sbox.SelectReq{Space: 9, Index: 0, Limit: 1, Keys: uint32(1)}); res.Code != sbox.RcIllegalParams {
+		t.Errorf("Select from unknown space should fail with RcIllegalParams, got %x", res.Code)
+	}
+}
+
+func TestUpdateDelete(t *testing.T) {
+	box := newBox()
+	box.Put(0, Tuple{{1, 0, 0, 0}, []byte("hello world"), {5, 0, 0, 0}})
+
+	var u User
+	res := iproto.Call(box, sbox.UpdateReq{Space: 0, Return: true, Key: uint32(1), Ops: []sbox.Op{
+		{Field: 2, Op: sbox.OpAdd, Val: uint32(10)},
+		{Field: 2, Op: sbox.OpXor, Val: uint32(1)},
+		{Field: 1, Op: sbox.OpSplice, Val: sbox.Slice{Offset: 0, Length: 5, Val: "bye"}},
+		{Field: 1, Op: sbox.OpSplice, Val: sbox.Slice{Offset: -5, Length: -1, Val: []byte("W")}},
+	}})
+	if _, _, err := sbox.ReadFirst(res.Body, &u); res.Code != sbox.RcOK || err != nil {
+		t.Fatalf("Update failed %x %v", res.Code, err)
+	}
+	if u != (User{1, "bye Wd", 14}) {
+		t.Errorf("Wrong update result %+v", u)
+	}
+
+	res = iproto.Call(box, sbox.UpdateReq{Space: 0, Key: uint32(1), Ops: []sbox.Op{
+		{Field: 3, Op: sbox.OpInsert, Val: "tail"},
+		{Field: 1, Op: sbox.OpDelete, Val: []byte{}},
+		{Field: 0, Op: sbox.OpSet, Val: uint32(2)},
+		{Field: 0, Op: sbox.OpOr, Val: uint32(4)},
+		{Field: 0, Op: sbox.OpAnd, Val: uint32(6)},
+	}})
+	if res.Code != sbox.RcOK {
+		t.Fatalf("Update failed %x", res.Code)
+	}
+	if tuples := box.Tuples(0); len(tuples) != 1 || string(tuples[0][2]) != "tail" || tuples[0][0][0] != 6 {
+		t.Errorf("Wrong tuples after update %q", tuples)
+	}
+	res = iproto.Call(box, sbox.UpdateReq{Space: 0, Key: uint32(6), Ops: []sbox.Op{{Field: 1, Op: sbox.OpAdd, Val: uint64(1)}}})
+	if res.Code != sbox.RcIllegalParams {
+		t.Errorf("Add of wrong size should fail with RcIllegalParams, got %x", res.Code)
+	}
+
+	if res = iproto.Call(box, sbox.DeleteReq{Space: 0, Key: uint32(7)}); res.Code != sbox.RcOK || res.Body[0] != 0 {
+		t.Errorf("Delete of absent should affect nothing %x %v", res.Code, res.Body)
+	}
+	if res = iproto.Call(box, sbox.DeleteReq{Space: 0, Key: uint32(6)}); res.Code != sbox.RcOK || res.Body[0] != 1 {
+		t.Errorf("Delete should affect one tuple %x %v", res.Code, res.Body)
+	}
+	if len(box.Tuples(0)) != 0 {
+		t.Errorf("Space should be empty")
+	}
+}
+
+func TestListenCall(t *testing.T) {
+	box := newBox()
+	box.Proc("echo", func(args []string) ([]Tuple, iproto.RetCode) {
+		var tuple Tuple
+		for _, a := range args {
+			tuple = append(tuple, []byte(a))
+		}
+		return []Tuple{tuple}, sbox.RcOK
+	})
+	serv, err := box.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serv.Stop()
+	cli := client.ServerConfig{Address: serv.Addr().String(), Timeout: time.Second, Logger: iproto.NopLogger{}}.NewServer()
+	iproto.Run(cli)
+	defer cli.Stop()
+
+	var args []string
+	res := iproto.Call(cli, sbox.RPCReq{Name: "echo", Args: []string{"a", "bc"}})
+	if _, _, err := sbox.ReadFirst(res.Body, &args); res.Code != sbox.RcOK || err != nil {
+		t.Fatalf("Call failed %x %v", res.Code, err)
+	}
+	if len(args) != 2 || args[1] != "bc" {
+		t.Errorf("Wrong call result %q", args)
+	}
+	if res = iproto.Call(cli, sbox.RPCReq{Name: "nope"}); res.Code != sbox.RcStoredProcNotDefined {
+		t.Errorf("Unknown procedure should fail with RcStoredProcNotDefined, got %x", res.Code)
+	}
+	if res = iproto.CallMsgBody(cli, 99, nil); res.Code != sbox.RcUnsupportedCommand {
+		t.Errorf("Unknown command should fail with RcUnsupportedCommand, got %x", res.Code)
+	}
+}
@@ -0,0 +1,361 @@
+package sboxtest
+
+import (
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/marshal"
+	"github.com/funny-falcon/go-iproto/sbox"
+)
+
+const (
+	msgSelect = iproto.RequestType(17)
+	msgInsert = iproto.RequestType(13)
+	msgUpdate = iproto.RequestType(19)
+	msgDelete = iproto.RequestType(21)
+	msgCall   = iproto.RequestType(22)
+)
+
+const flagReturn = 1
+
+// codes of update operations on the wire
+const (
+	opSet = iota
+	opAdd
+	opAnd
+	opOr
+	opXor
+	opSplice
+	opDelete
+	opInsert
+)
+
+func (b *Box) serve(msg iproto.RequestType, body []byte) (iproto.RetCode, []byte) {
+	r := marshal.Reader{Body: body}
+	var w marshal.Writer
+	var code iproto.RetCode
+	switch msg {
+	case msgSelect:
+		code = b.selectReq(&r, &w)
+	case msgInsert:
+		code = b.insertReq(&r, &w)
+	case msgUpdate:
+		code = b.updateReq(&r, &w)
+	case msgDelete:
+		code = b.deleteReq(&r, &w)
+	case msgCall:
+		code = b.callReq(&r, &w)
+	default:
+		return sbox.RcUnsupportedCommand, nil
+	}
+	if code != sbox.RcOK {
+		return code, nil
+	}
+	return sbox.RcOK, w.Written()
+}
+
+func readTuple(r *marshal.Reader) (t Tuple) {
+	n := r.IntUint32()
+	for i := 0; i < n && r.Err == nil; i++ {
+		t = append(t, append([]byte(nil), r.Slice(r.Intvar())...))
+	}
+	return
+}
+
+func writeTuple(w *marshal.Writer, t Tuple) {
+	sz := 0
+	for _, f := range t {
+		sz += varLen(len(f)) + len(f)
+	}
+	w.IntUint32(sz)
+	w.IntUint32(len(t))
+	for _, f := range t {
+		w.Intvar(len(f))
+		w.Bytes(f)
+	}
+}
+
+func varLen(n int) (l int) {
+	for l = 1; n >= 0x80; n >>= 7 {
+		l++
+	}
+	return
+}
+
+func writeTuples(w *marshal.Writer, ts []Tuple) {
+	w.IntUint32(len(ts))
+	for _, t := range ts {
+		writeTuple(w, t)
+	}
+}
+
+func (b *Box) space(r *marshal.Reader) (*space, iproto.RetCode) {
+	no := r.Uint32()
+	if r.Err != nil {
+		return nil, sbox.RcIllegalParams
+	}
+	if sp := b.spaces[no]; sp != nil {
+		return sp, sbox.RcOK
+	}
+	return nil, sbox.RcIllegalParams
+}
+
+func (b *Box) selectReq(r *marshal.Reader, w *marshal.Writer) iproto.RetCode {
+	sp, code := b.space(r)
+	if code != sbox.RcOK {
+		return code
+	}
+	indNo := int(r.Uint32())
+	offset := int(r.Uint32())
+	limit := int(r.Uint32())
+	cnt := r.IntUint32()
+	if r.Err != nil || indNo >= len(sp.indexes) {
+		return sbox.RcIllegalParams
+	}
+	ind := &sp.indexes[indNo]
+
+	var res []Tuple
+	for i := 0; i < cnt; i++ {
+		key := readTuple(r)
+		if r.Err != nil {
+			return sbox.RcIllegalParams
+		}
+		if code = ind.validKey(key); code != sbox.RcOK {
+			return code
+		}
+		res = append(res, sp.find(ind, key)...)
+	}
+	if offset < len(res) {
+		res = res[offset:]
+	} else {
+		res = nil
+	}
+	if limit < len(res) {
+		res = res[:limit]
+	}
+	writeTuples(w, res)
+	return sbox.RcOK
+}
+
+func (b *Box) insertReq(r *marshal.Reader, w *marshal.Writer) iproto.RetCode {
+	sp, code := b.space(r)
+	if code != sbox.RcOK {
+		return code
+	}
+	flags := r.Uint32()
+	t := readTuple(r)
+	if r.Err != nil || len(t) == 0 {
+		return sbox.RcIllegalParams
+	}
+	if _, code = sp.store(t, sbox.InsertMode(flags>>1&3)); code != sbox.RcOK {
+		return code
+	}
+	w.IntUint32(1)
+	if flags&flagReturn != 0 {
+		writeTuple(w, t)
+	}
+	return sbox.RcOK
+}
+
+func (b *Box) deleteReq(r *marshal.Reader, w *marshal.Writer) iproto.RetCode {
+	sp, code := b.space(r)
+	if code != sbox.RcOK {
+		return code
+	}
+	flags := r.Uint32()
+	key := readTuple(r)
+	if r.Err != nil {
+		return sbox.RcIllegalParams
+	}
+	if len(key) != len(sp.indexes[0].Fields) {
+		return sbox.RcIllegalParams
+	}
+	if code = sp.indexes[0].validKey(key); code != sbox.RcOK {
+		return code
+	}
+	pos := sp.position(key)
+	if pos < 0 {
+		w.IntUint32(0)
+		return sbox.RcOK
+	}
+	old := sp.tuples[pos]
+	sp.remove(pos)
+	w.IntUint32(1)
+	if flags&flagReturn != 0 {
+		writeTuple(w, old)
+	}
+	return sbox.RcOK
+}
+
+func (b *Box) updateReq(r *marshal.Reader, w *marshal.Writer) iproto.RetCode {
+	sp, code := b.space(r)
+	if code != sbox.RcOK {
+		return code
+	}
+	flags := r.Uint32()
+	key := readTuple(r)
+	if r.Err != nil || len(key) != len(sp.indexes[0].Fields) {
+		return sbox.RcIllegalParams
+	}
+	if code = sp.indexes[0].validKey(key); code != sbox.RcOK {
+		return code
+	}
+	pos := sp.position(key)
+	var t Tuple
+	if pos >= 0 {
+		t = append(Tuple(nil), sp.tuples[pos]...)
+	}
+
+	nops := r.IntUint32()
+	for i := 0; i < nops; i++ {
+		field := int(r.Uint32())
+		op := r.Uint8()
+		arg := append([]byte(nil), r.Slice(r.Intvar())...)
+		if r.Err != nil {
+			return sbox.RcIllegalParams
+		}
+		if t != nil {
+			if t, code = applyOp(t, field, op, arg); code != sbox.RcOK {
+				return code
+			}
+		}
+	}
+	if t == nil {
+		w.IntUint32(0)
+		return sbox.RcOK
+	}
+
+	pk := &sp.indexes[0]
+	if code = pk.validTuple(t); code != sbox.RcOK {
+		return code
+	}
+	if other := sp.position(pk.key(t)); other >= 0 && other != pos {
+		return sbox.RcDuplicateKey
+	}
+	if code = sp.check(t, pos); code != sbox.RcOK {
+		return code
+	}
+	sp.remove(pos)
+	sp.insert(t)
+
+	w.IntUint32(1)
+	if flags&flagReturn != 0 {
+		writeTuple(w, t)
+	}
+	return sbox.RcOK
+}
+
+func applyOp(t Tuple, field int, op byte, arg []byte) (Tuple, iproto.RetCode) {
+	if field > len(t) || (field == len(t) && op != opInsert) {
+		return t, sbox.RcIllegalParams
+	}
+	switch op {
+	case opSet:
+		t[field] = arg
+	case opAdd, opAnd, opOr, opXor:
+		f := t[field]
+		if len(f) != len(arg) {
+			return t, sbox.RcIllegalParams
+		}
+		switch len(f) {
+		case 4:
+			t[field] = make([]byte, 4)
+			le.PutUint32(t[field], uint32(arith(op, uint64(le.Uint32(f)), uint64(le.Uint32(arg)))))
+		case 8:
+			t[field] = make([]byte, 8)
+			le.PutUint64(t[field], arith(op, le.Uint64(f), le.Uint64(arg)))
+		default:
+			return t, sbox.RcIllegalParams
+		}
+	case opSplice:
+		res, ok := splice(t[field], arg)
+		if !ok {
+			return t, sbox.RcIllegalParams
+		}
+		t[field] = res
+	case opDelete:
+		t = append(t[:field:field], t[field+1:]...)
+	case opInsert:
+		t = append(t[:field:field], append(Tuple{arg}, t[field:]...)...)
+	default:
+		return t, sbox.RcIllegalParams
+	}
+	return t, sbox.RcOK
+}
+
+func arith(op byte, a, b uint64) uint64 {
+	switch op {
+	case opAdd:
+		return a + b
+	case opAnd:
+		return a & b
+	case opOr:
+		return a | b
+	}
+	return a ^ b
+}
+
+// splice argument is three sized fields: offset int32, length int32 and value
+func splice(f, arg []byte) ([]byte, bool) {
+	r := marshal.Reader{Body: arg}
+	if r.Intvar() != 4 {
+		return nil, false
+	}
+	offset := int(r.Int32())
+	if r.Intvar() != 4 {
+		return nil, false
+	}
+	length := int(r.Int32())
+	val := r.Slice(r.Intvar())
+	if r.Err != nil {
+		return nil, false
+	}
+
+	l := len(f)
+	if offset < 0 {
+		if -offset > l {
+			return nil, false
+		}
+		offset += l
+	} else if offset > l {
+		offset = l
+	}
+	if length < 0 {
+		if -length > l-offset {
+			length = 0
+		} else {
+			length += l - offset
+		}
+	} else if length > l-offset {
+		length = l - offset
+	}
+
+	res := make([]byte, 0, l-length+len(val))
+	res = append(res, f[:offset]...)
+	res = append(res, val...)
+	return append(res, f[offset+length:]...), true
+}
+
+func (b *Box) callReq(r *marshal.Reader, w *marshal.Writer) iproto.RetCode {
+	r.Uint32()
+	name := r.String(r.Intvar())
+	n := r.IntUint32()
+	if r.Err != nil || n > len(r.Body) {
+		return sbox.RcIllegalParams
+	}
+	args := make([]string, n)
+	for i := range args {
+		args[i] = r.String(r.Intvar())
+	}
+	if r.Err != nil {
+		return sbox.RcIllegalParams
+	}
+	proc := b.procs[name]
+	if proc == nil {
+		return sbox.RcStoredProcNotDefined
+	}
+	res, code := proc(args)
+	if code != sbox.RcOK {
+		return code
+	}
+	writeTuples(w, res)
+	return sbox.RcOK
+}
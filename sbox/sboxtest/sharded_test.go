@@ -0,0 +1,130 @@
+package sboxtest
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/sbox"
+)
+
+type limitRecorder struct {
+	sync.Mutex
+	limits []int32
+}
+
+// record remembers limits of selects sent to box
+func (l *limitRecorder) record(box *Box) iproto.Route {
+	return func(r *iproto.Request) {
+		if r.Msg == (sbox.SelectReq{}).IMsg() {
+			l.Lock()
+			l.limits = append(l.limits, int32(binary.LittleEndian.Uint32(r.Body[12:])))
+			l.Unlock()
+		}
+		box.Send(r)
+	}
+}
+
+func shardedBoxes(t *testing.T, l *limitRecorder) (*iproto.ShardedService, []*Box) {
+	boxes := []*Box{newBox(), newBox()}
+	sharded := iproto.NewSharded(sbox.ShardKey)
+	sharded.Add("a", l.record(boxes[0]))
+	sharded.Add("b", l.record(boxes[1]))
+	for id := uint32(1); id <= 8; id++ {
+		u := User{id, string(rune('a'+id)) + "@x", id}
+		if res := iproto.Call(sharded, sbox.StoreReq{Space: 0, Tuple: u}); res.Code != sbox.RcOK {
+			t.Fatalf("Store failed with %x", res.Code)
+		}
+	}
+	if len(boxes[0].Tuples(0)) == 0 || len(boxes[1].Tuples(0)) == 0 {
+		t.Fatalf("Tuples are not spread over shards: %d and %d", len(boxes[0].Tuples(0)), len(boxes[1].Tuples(0)))
+	}
+	return sharded, boxes
+}
+
+func shardedSelect(t *testing.T, sharded *iproto.ShardedService, req sbox.SelectReq) []User {
+	t.Helper()
+	res := sbox.SelectSharded(nil, sharded, req)
+	if res.Code != sbox.RcOK {
+		t.Fatalf("Sharded select failed with %x", res.Code)
+	}
+	var users []User
+	if _, _, err := sbox.ReadMany(res.Body, &users); err != nil {
+		t.Fatal(err)
+	}
+	return users
+}
+
+func TestSelectSharded(t *testing.T) {
+	var l limitRecorder
+	sharded, _ := shardedBoxes(t, &l)
+	keys := []uint32{1, 2, 3, 4, 5, 6, 7, 8, 9}
+
+	users := shardedSelect(t, sharded, sbox.SelectReq{Space: 0, Limit: sbox.SelectAll, Keys: keys})
+	ids := make([]int, len(users))
+	for i, u := range users {
+		ids[i] = int(u.Id)
+	}
+	sort.Ints(ids)
+	if len(ids) != 8 || ids[0] != 1 || ids[7] != 8 {
+		t.Errorf("Wrong merged select %v", ids)
+	}
+
+	l.limits = nil
+	all := users
+	users = shardedSelect(t, sharded, sbox.SelectReq{Space: 0, Offset: 2, Limit: 3, Keys: keys})
+	if len(users) != 3 || users[0] != all[2] || users[2] != all[4] {
+		t.Errorf("Offset and limit are not applied to merged result: %+v", users)
+	}
+	if len(l.limits) != 2 || l.limits[0] != 5 || l.limits[1] != 5 {
+		t.Errorf("Shards should be asked for offset+limit tuples, got %v", l.limits)
+	}
+
+	users = shardedSelect(t, sharded, sbox.SelectReq{Space: 0, Offset: 7, Limit: 5, Keys: keys})
+	if len(users) != 1 || users[0] != all[7] {
+		t.Errorf("Wrong tail of merged result: %+v", users)
+	}
+	users = shardedSelect(t, sharded, sbox.SelectReq{Space: 0, Offset: 9, Limit: 5, Keys: keys})
+	if len(users) != 0 {
+		t.Errorf("Offset past merged result should give empty result: %+v", users)
+	}
+}
+
+func TestSelectShardedLimitOverflow(t *testing.T) {
+	var l limitRecorder
+	sharded, _ := shardedBoxes(t, &l)
+	keys := []uint32{1, 2, 3, 4, 5, 6, 7, 8}
+
+	users := shardedSelect(t, sharded, sbox.SelectReq{Space: 0, Offset: 2, Limit: math.MaxInt32, Keys: keys})
+	if len(users) != 6 {
+		t.Errorf("Expected 6 users after offset, got %d", len(users))
+	}
+
+	// offset+limit wraps to SelectN in int32
+	l.limits = nil
+	users = shardedSelect(t, sharded, sbox.SelectReq{Space: 0, Offset: math.MaxInt32, Limit: math.MaxInt32, Keys: keys})
+	if len(users) != 0 {
+		t.Errorf("Offset past merged result should give empty result: %+v", users)
+	}
+	if len(l.limits) != 2 {
+		t.Fatalf("Expected selects to two shards, got %v", l.limits)
+	}
+	for _, lim := range l.limits {
+		if lim != math.MaxInt32 {
+			t.Errorf("Shard limit should be clamped to MaxInt32, got %d", lim)
+		}
+	}
+}
+
+func TestSelectShardedError(t *testing.T) {
+	var l limitRecorder
+	sharded, _ := shardedBoxes(t, &l)
+
+	res := sbox.SelectSharded(nil, sharded, sbox.SelectReq{Space: 9, Limit: 1, Keys: []uint32{1, 2, 3, 4}})
+	if res.Code != sbox.RcIllegalParams {
+		t.Errorf("Shard's error should be returned, got %x", res.Code)
+	}
+}
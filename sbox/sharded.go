@@ -0,0 +1,150 @@
+package sbox
+
+import (
+	"math"
+	"reflect"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/marshal"
+)
+
+func firstField(r *marshal.Reader) []byte {
+	if card := r.IntUint32(); card == 0 {
+		return nil
+	}
+	sz := r.Intvar()
+	return r.Slice(sz)
+}
+
+// ShardKey extracts first field of a select key, stored tuple, or update and delete key.
+// It is suitable as iproto.ShardedService.Key , so that tuple is stored on the same shard
+// it will be selected from.
+func ShardKey(req *iproto.Request) []byte {
+	r := marshal.Reader{Body: req.Body}
+	switch req.Msg {
+	case SelectReq{}.IMsg():
+		r.Slice(16)
+		if r.IntUint32() == 0 {
+			return nil
+		}
+	case StoreReq{}.IMsg(), UpdateReq{}.IMsg(), DeleteReq{}.IMsg():
+		r.Slice(8)
+	default:
+		return nil
+	}
+	if key := firstField(&r); r.Err == nil {
+		return key
+	}
+	return nil
+}
+
+func keyShardKey(key interface{}) []byte {
+	var w marshal.Writer
+	WriteTuple(&w, key)
+	r := marshal.Reader{Body: w.Written()}
+	return firstField(&r)
+}
+
+func splitKeys(keys interface{}, res []interface{}) []interface{} {
+	switch k := keys.(type) {
+	case []byte, string:
+		return append(res, k)
+	case []interface{}:
+		for _, v := range k {
+			res = splitKeys(v, res)
+		}
+		return res
+	}
+	v := reflect.ValueOf(keys)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			for i := 0; i < v.Len(); i++ {
+				res = append(res, v.Index(i).Interface())
+			}
+			return res
+		}
+	}
+	return append(res, keys)
+}
+
+// SelectSharded splits keys of select among shards of sharded service, sends
+// a select per shard and merges results into one response.
+// Offset and Limit are applied to merged result.
+func SelectSharded(cx *iproto.Context, sharded *iproto.ShardedService, req SelectReq) *iproto.Response {
+	var names []string
+	groups := make(map[string][]interface{})
+	servs := make(map[string]iproto.Service)
+	for _, key := range splitKeys(req.Keys, nil) {
+		name, serv := sharded.Shard(keyShardKey(key))
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+			servs[name] = serv
+		}
+		groups[name] = append(groups[name], key)
+	}
+
+	var multi *iproto.MultiRequest
+	if cx != nil {
+		multi = cx.NewMulti()
+	} else {
+		multi = &iproto.MultiRequest{}
+	}
+	multi.TimeoutFrom(sharded)
+	for _, name := range names {
+		sub := req
+		sub.Keys = groups[name]
+		sub.Offset = 0
+		if req.Limit >= 0 {
+			/* every shard could hold all tuples before offset */
+			sub.Limit = math.MaxInt32
+			if lim := int64(req.Offset) + int64(req.Limit); lim < math.MaxInt32 {
+				sub.Limit = int32(lim)
+			}
+		}
+		if serv := servs[name]; serv != nil {
+			multi.Send(serv, sub)
+		} else {
+			multi.Request(sub.IMsg(), sub).IOError()
+		}
+	}
+	return mergeSelects(req, multi.Results().Sort())
+}
+
+func mergeSelects(req SelectReq, results iproto.MultiResponse) *iproto.Response {
+	var w marshal.Writer
+	var tuples [][]byte
+	for _, res := range results {
+		if !res.Valid() {
+			return res
+		}
+		r := marshal.Reader{Body: res.Body}
+		cnt := r.IntUint32()
+		for i := 0; i < cnt && r.Err == nil; i++ {
+			tuple := r.Body
+			sz := r.IntUint32()
+			if r.Slice(sz + 4); r.Err == nil {
+				tuples = append(tuples, tuple[:sz+8])
+			}
+		}
+		if r.Err != nil {
+			return &iproto.Response{Msg: req.IMsg(), Code: iproto.RcProtocolError}
+		}
+	}
+	if off := int(req.Offset); off < len(tuples) {
+		tuples = tuples[off:]
+	} else {
+		tuples = nil
+	}
+	if req.Limit >= 0 && int(req.Limit) < len(tuples) {
+		tuples = tuples[:req.Limit]
+	}
+	w.IntUint32(len(tuples))
+	for _, t := range tuples {
+		w.Bytes(t)
+	}
+	return &iproto.Response{Msg: req.IMsg(), Code: RcOK, Body: w.Written()}
+}
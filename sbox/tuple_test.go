@@ -20,6 +20,28 @@ type SStruct struct {
 	S string
 }
 
+type STail struct {
+	I int32
+	T []string `sbox:"tail"`
+}
+
+type SPair struct {
+	K string
+	V int16
+}
+
+type SSplit struct {
+	I int32
+	P []SPair `sbox:"tailsplit"`
+}
+
+type SOpt struct {
+	I int32
+	P *int32 `iproto:"opt"`
+}
+
+var five = int32(5)
+
 type burbur int32
 
 var shoulds = []Should{
@@ -31,6 +53,12 @@ var shoulds = []Should{
 	{&[]int32{0x3def, 0xff00}, []byte{2, 0, 0, 0, 4, 0xef, 0x3d, 0, 0, 4, 0, 0xff, 0, 0}},
 	{SStruct{0x3def, 0xfe, []byte{1, 2, 3}, "abcd"},
 		[]byte{4, 0, 0, 0, 4, 0xef, 0x3d, 0, 0, 1, 0xfe, 3, 1, 2, 3, 4, 'a', 'b', 'c', 'd'}},
+	{STail{1, []string{"a", "bc"}},
+		[]byte{3, 0, 0, 0, 4, 1, 0, 0, 0, 1, 'a', 2, 'b', 'c'}},
+	{SSplit{2, []SPair{{"a", 1}, {"bc", 2}}},
+		[]byte{5, 0, 0, 0, 4, 2, 0, 0, 0, 1, 'a', 2, 1, 0, 2, 'b', 'c', 2, 2, 0}},
+	{SOpt{I: 1}, []byte{2, 0, 0, 0, 4, 1, 0, 0, 0, 0}},
+	{SOpt{I: 1, P: &five}, []byte{2, 0, 0, 0, 4, 1, 0, 0, 0, 4, 5, 0, 0, 0}},
 }
 
 var wr = &marshal.Writer{}
@@ -0,0 +1,45 @@
+package sbox
+
+import (
+	"github.com/funny-falcon/go-iproto"
+)
+
+func call(cx *iproto.Context, serv iproto.Service, req iproto.RequestData) (*iproto.Response, error) {
+	var res *iproto.Response
+	if cx != nil {
+		res = cx.Call(serv, req)
+	} else {
+		res = iproto.Call(serv, req)
+	}
+	return res, res.Err()
+}
+
+// Select sends select and decodes all found tuples with ReadMany. cx could be nil.
+//
+//	users, err := sbox.Select[User](cx, box, sbox.SelectReq{Space: 1, Limit: sbox.SelectAll, Keys: ids})
+func Select[T any](cx *iproto.Context, serv iproto.Service, req SelectReq) (res []T, err error) {
+	var resp *iproto.Response
+	if resp, err = call(cx, serv, req); err == nil {
+		_, _, err = ReadMany(resp.Body, &res)
+	}
+	return
+}
+
+// SelectOne sends select and decodes first found tuple, found is false if there is no tuples
+func SelectOne[T any](cx *iproto.Context, serv iproto.Service, req SelectReq) (res T, found bool, err error) {
+	var resp *iproto.Response
+	if resp, err = call(cx, serv, req); err == nil {
+		found, _, err = ReadFirst(resp.Body, &res)
+	}
+	return
+}
+
+// Returning sends store, update or delete request, and decodes returned tuple.
+// Request should have Return flag set, found is false if no tuple were affected.
+func Returning[T any](cx *iproto.Context, serv iproto.Service, req iproto.RequestData) (res T, found bool, err error) {
+	var resp *iproto.Response
+	if resp, err = call(cx, serv, req); err == nil {
+		found, _, err = ReadFirst(resp.Body, &res)
+	}
+	return
+}
@@ -0,0 +1,84 @@
+package sbox_test
+
+import (
+	"testing"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/sbox"
+	"github.com/funny-falcon/go-iproto/sbox/sboxtest"
+)
+
+type user struct {
+	Id    uint32
+	Email string
+}
+
+func usersBox(users ...user) *sboxtest.Box {
+	box := sboxtest.New()
+	box.AddSpace(0, sboxtest.Index{Fields: []int{0}, Types: []sboxtest.FieldType{sboxtest.Num}, Tree: true})
+	for _, u := range users {
+		iproto.Call(box, sbox.StoreReq{Space: 0, Tuple: u})
+	}
+	return box
+}
+
+func failedWith(err error, code iproto.RetCode) bool {
+	e, ok := err.(*iproto.Error)
+	return ok && e.Code == code
+}
+
+func TestTypedSelect(t *testing.T) {
+	box := usersBox(user{1, "a@x"}, user{2, "b@x"})
+
+	users, err := sbox.Select[user](nil, box, sbox.SelectReq{Space: 0, Limit: sbox.SelectAll, Keys: []uint32{2, 1}})
+	if err != nil || len(users) != 2 || users[0] != (user{2, "b@x"}) || users[1] != (user{1, "a@x"}) {
+		t.Errorf("Select returned %+v %v", users, err)
+	}
+	var cx iproto.Context
+	users, err = sbox.Select[user](&cx, box, sbox.SelectReq{Space: 0, Limit: sbox.SelectAll, Keys: uint32(5)})
+	if err != nil || len(users) != 0 {
+		t.Errorf("Select of absent key should return no tuples, got %+v %v", users, err)
+	}
+	users, err = sbox.Select[user](nil, box, sbox.SelectReq{Space: 9, Limit: sbox.SelectAll, Keys: uint32(1)})
+	if !failedWith(err, sbox.RcIllegalParams) || users != nil {
+		t.Errorf("Select from unknown space should fail with RcIllegalParams, got %+v %v", users, err)
+	}
+}
+
+func TestTypedSelectOne(t *testing.T) {
+	box := usersBox(user{1, "a@x"})
+
+	u, found, err := sbox.SelectOne[user](nil, box, sbox.SelectReq{Space: 0, Limit: 1, Keys: uint32(1)})
+	if err != nil || !found || u != (user{1, "a@x"}) {
+		t.Errorf("SelectOne returned %+v %v %v", u, found, err)
+	}
+	u, found, err = sbox.SelectOne[user](nil, box, sbox.SelectReq{Space: 0, Limit: 1, Keys: uint32(2)})
+	if err != nil || found || u != (user{}) {
+		t.Errorf("SelectOne of absent key should not find, got %+v %v %v", u, found, err)
+	}
+	_, found, err = sbox.SelectOne[user](nil, box, sbox.SelectReq{Space: 0, Limit: 1, Keys: "long key"})
+	if !failedWith(err, sbox.RcWrongField) || found {
+		t.Errorf("SelectOne by wrong key should fail with RcWrongField, got %v %v", found, err)
+	}
+}
+
+func TestTypedReturning(t *testing.T) {
+	box := usersBox(user{1, "a@x"})
+
+	u, found, err := sbox.Returning[user](nil, box, sbox.StoreReq{Space: 0, Return: true, Tuple: user{2, "b@x"}})
+	if err != nil || !found || u != (user{2, "b@x"}) {
+		t.Errorf("Store returned %+v %v %v", u, found, err)
+	}
+	u, found, err = sbox.Returning[user](nil, box, sbox.DeleteReq{Space: 0, Return: true, Key: uint32(1)})
+	if err != nil || !found || u != (user{1, "a@x"}) {
+		t.Errorf("Delete returned %+v %v %v", u, found, err)
+	}
+	u, found, err = sbox.Returning[user](nil, box, sbox.DeleteReq{Space: 0, Return: true, Key: uint32(1)})
+	if err != nil || found || u != (user{}) {
+		t.Errorf("Delete of absent tuple should not find, got %+v %v %v", u, found, err)
+	}
+	_, found, err = sbox.Returning[user](nil, box, sbox.StoreReq{Space: 0, Mode: uint16(sbox.Insert), Return: true, Tuple: user{2, "c@x"}})
+	if !failedWith(err, sbox.RcTupleExists) || found {
+		t.Errorf("Insert of existing should fail with RcTupleExists, got %v %v", found, err)
+	}
+}
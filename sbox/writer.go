@@ -11,6 +11,14 @@ import (
 
 var _ = log.Print
 
+// ITupleWriter is implemented by types which write themselves as a whole tuple:
+// fields count followed by fields prefixed with ber size. iprotogen generates it for structs.
+type ITupleWriter interface {
+	ITupleWrite(w *marshal.Writer)
+}
+
+var ituplewriter = reflect.TypeOf(new(ITupleWriter)).Elem()
+
 func WriteTuple(w *marshal.Writer, i interface{}) {
 	switch o := i.(type) {
 	case nil:
@@ -68,6 +76,8 @@ func WriteTuple(w *marshal.Writer, i interface{}) {
 		for _, v := range o {
 			w.WriteWithSize(v, (*marshal.Writer).Intvar)
 		}
+	case ITupleWriter:
+		o.ITupleWrite(w)
 	default:
 		val := reflect.ValueOf(i)
 		rt := val.Type()
@@ -117,6 +127,13 @@ type TWriter struct {
 func (t *TWriter) Fill() {
 	rt := t.Writer.Type
 
+	if rt.Implements(ituplewriter) {
+		t.Write = func(w *marshal.Writer, v reflect.Value) {
+			v.Interface().(ITupleWriter).ITupleWrite(w)
+		}
+		return
+	}
+
 	switch rt.Kind() {
 	case reflect.Ptr:
 		elwr := _writer(rt.Elem())
@@ -175,7 +192,7 @@ func (sw *TWriter) structCnt(v reflect.Value) int {
 		return len(flds) - 1 + v.Field(flds[len(flds)-1].I).Len()
 	case TailSplit:
 		last := flds[len(flds)-1]
-		return len(flds) - 1 + v.Field(last.I).Len()*len(last.TWriter.Flds)
+		return len(flds) - 1 + v.Field(last.I).Len()*len(last.Elem.Flds)
 	}
 	return 0
 }
@@ -189,28 +206,34 @@ func (sw *TWriter) structWriter(w *marshal.Writer, v reflect.Value) {
 	}
 	for i := 0; i < n; i++ {
 		fs := &flds[i]
-		fs.WithSize(w, v.Field(fs.I), (*marshal.Writer).Intvar)
+		fv := v.Field(fs.I)
+		// nil optional pointer is written as empty field
+		if fs.Opt && fv.IsNil() {
+			w.Intvar(0)
+			continue
+		}
+		fs.WithSize(w, fv, (*marshal.Writer).Intvar)
 	}
 	switch sw.Tail {
 	case NoTail:
 	case Tail:
 		fs := &flds[n]
-		fv := v.Field(n)
+		fv := v.Field(fs.I)
 		l := fv.Len()
 		for i := 0; i < l; i++ {
 			val := fv.Index(i)
-			fs.WithSize(w, val, (*marshal.Writer).Intvar)
+			fs.Elem.WithSize(w, val, (*marshal.Writer).Intvar)
 		}
 	case TailSplit:
 		fs := &flds[n]
-		fv := v.Field(n)
+		fv := v.Field(fs.I)
 		l := fv.Len()
-		fss := fs.TWriter.Flds
+		fss := fs.Elem.Flds
 		fl := len(fss)
 		for i := 0; i < l; i++ {
 			str := fv.Index(i)
 			for j := 0; j < fl; j++ {
-				fss[i].WithSize(w, str.Field(i), (*marshal.Writer).Intvar)
+				fss[j].WithSize(w, str.Field(fss[j].I), (*marshal.Writer).Intvar)
 			}
 		}
 	}
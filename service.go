@@ -1,6 +1,7 @@
 package iproto
 
 import (
+	"errors"
 	"log"
 	"time"
 )
@@ -52,11 +53,15 @@ type EndPoint interface {
 	Stop()
 }
 
-func Run(s EndPoint) {
+var ErrAlreadyRunned = errors.New("iproto: EndPoint already runned")
+
+// Run runs standalone end point, it returns ErrAlreadyRunned if end point is running
+func Run(s EndPoint) error {
 	if s.Runned() {
-		log.Panicf("EndPoint already runned ( %v )", s)
+		return ErrAlreadyRunned
 	}
 	s.Run(nil)
+	return nil
 }
 
 type PointLoop interface {
@@ -71,6 +76,18 @@ type SimplePoint struct {
 	PointLoop
 	Timeout     time.Duration
 	TimeoutCode RetCode
+
+	// MaxQueue and MaxQueueBytes bound number and body size of requests waiting
+	// for end point, Overflow chooses what to do when queue is full.
+	// One more request could wait out of the queue, while end point is busy.
+	MaxQueue      int
+	MaxQueueBytes int
+	Overflow      Overflow
+	// OverflowCode answers requests rejected by OverflowReject, RcOverload if zero
+	OverflowCode RetCode
+	// Priorities makes waiting requests received by Request.Priority, lower priorities
+	// are still received after StarvationLimit requests of higher ones
+	Priorities bool
 }
 
 var _ EndPoint = (*SimplePoint)(nil)
@@ -89,9 +106,19 @@ func (s *SimplePoint) Standalone() bool {
 
 func (s *SimplePoint) Run(ch chan *Request) {
 	if ch == nil {
-		ch = make(chan *Request, 16*1024)
 		s.standalone = true
 		s.b.init()
+		s.b.maxLen, s.b.maxBytes, s.b.overflow = s.MaxQueue, s.MaxQueueBytes, s.Overflow
+		s.b.priorities = s.Priorities
+		if s.b.code = s.OverflowCode; s.b.code == RcOK {
+			s.b.code = RcOverload
+		}
+		if s.b.bounded() || s.b.priorities {
+			/* so every waiting request is accounted and ordered in buffer */
+			ch = make(chan *Request)
+		} else {
+			ch = make(chan *Request, 16*1024)
+		}
 	}
 	s.b.ch = ch
 	if s.standalone {
@@ -100,15 +127,26 @@ func (s *SimplePoint) Run(ch chan *Request) {
 	go s.Loop()
 }
 
+// QueueLen is a number of requests waiting to be received by end point
+func (s *SimplePoint) QueueLen() int {
+	return s.b.len()
+}
+
+// QueueBytes is a body size of requests waiting in queue, it is exact only for bounded queue
+func (s *SimplePoint) QueueBytes() int {
+	return s.b.size()
+}
+
 func (s *SimplePoint) ReceiveChan() <-chan *Request {
 	return s.b.ch
 }
 
-func (s *SimplePoint) RunChild(p EndPoint) {
+func (s *SimplePoint) RunChild(p EndPoint) error {
 	if p.Runned() {
-		log.Panicf("EndPoint already runned ( %v )", s)
+		return ErrAlreadyRunned
 	}
 	p.Run(s.b.ch)
+	return nil
 }
 
 func (s *SimplePoint) Init(p PointLoop) {
@@ -120,20 +158,18 @@ func (s *SimplePoint) ExitChan() <-chan bool {
 	return s.exit
 }
 
+// Send fails request with RcInternalError if end point is not running or is a child end point
 func (s *SimplePoint) Send(r *Request) {
-	if s.b.ch == nil {
-		panic("EndPoint is not running")
-	}
-
-	if !s.standalone {
-		log.Panicf("you should not call Send on child endpoint %+v", s)
+	if s.b.ch == nil || !s.standalone {
+		r.RespondFail(RcInternalError)
+		return
 	}
 
 	r.Lock()
-	defer r.Unlock()
 	if !r.SetPending() {
 		/* this could happen if SetDeadline already respond with timeout */
 		if r.Performed() {
+			r.Unlock()
 			return
 		}
 		log.Panicf("Request already sent somewhere %+v", s)
@@ -143,9 +179,12 @@ func (s *SimplePoint) Send(r *Request) {
 
 	/* this could happen if SetDeadline already respond with timeout */
 	if r.Performed() {
+		r.Unlock()
 		return
 	}
+	r.Unlock()
 
+	/* push chains bookmark and could respond, so request should be unlocked */
 	s.b.push(r)
 }
 
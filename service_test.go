@@ -0,0 +1,71 @@
+package iproto_test
+
+import (
+	"testing"
+
+	"github.com/funny-falcon/go-iproto"
+)
+
+// echoPoint answers every received request with RcOK
+type echoPoint struct {
+	iproto.SimplePoint
+}
+
+func newEchoPoint() *echoPoint {
+	p := &echoPoint{}
+	p.Init(p)
+	return p
+}
+
+func (p *echoPoint) Loop() {
+	for {
+		select {
+		case r := <-p.ReceiveChan():
+			if r.SetInFly(nil) {
+				r.RespondBytes(iproto.RcOK, nil)
+			}
+		case <-p.ExitChan():
+			return
+		}
+	}
+}
+
+func TestSendNotRunning(t *testing.T) {
+	p := newEchoPoint()
+	if res := iproto.CallMsgBody(p, msgGet, nil); res.Code != iproto.RcInternalError {
+		t.Errorf("Send to not running end point should fail with RcInternalError, got %x", res.Code)
+	}
+
+	if err := iproto.Run(p); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	if err := iproto.Run(p); err != iproto.ErrAlreadyRunned {
+		t.Errorf("Second Run should fail with ErrAlreadyRunned, got %v", err)
+	}
+	if res := iproto.CallMsgBody(p, msgGet, nil); res.Code != iproto.RcOK {
+		t.Errorf("Send to running end point failed with %x", res.Code)
+	}
+
+	child := newEchoPoint()
+	if err := p.RunChild(child); err != nil {
+		t.Fatal(err)
+	}
+	defer child.Stop()
+	if err := p.RunChild(child); err != iproto.ErrAlreadyRunned {
+		t.Errorf("Second RunChild should fail with ErrAlreadyRunned, got %v", err)
+	}
+	if res := iproto.CallMsgBody(child, msgGet, nil); res.Code != iproto.RcInternalError {
+		t.Errorf("Send to child end point should fail with RcInternalError, got %x", res.Code)
+	}
+}
+
+func TestResetOutsideResponder(t *testing.T) {
+	r := &iproto.Request{Msg: msgGet, Responder: make(iproto.Chan, 1)}
+	if r.ResetToPending() || r.ResetToNew() {
+		t.Errorf("Reset of not prepared request should return false")
+	}
+	if r.State() != iproto.RsNew {
+		t.Errorf("State of request is changed to %d", r.State())
+	}
+}
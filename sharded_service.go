@@ -0,0 +1,138 @@
+package iproto
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const DefaultVirtualNodes = 160
+
+type ringPoint struct {
+	hash uint32
+	name string
+}
+
+type ring []ringPoint
+
+func (r ring) Len() int           { return len(r) }
+func (r ring) Less(i, j int) bool { return r[i].hash < r[j].hash }
+func (r ring) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// ShardedService routes request to a member service by consistent hashing of a request key.
+// Members could be added and removed at runtime: only keys of added or removed member are remapped.
+type ShardedService struct {
+	// Key extracts sharding key from request
+	Key func(*Request) []byte
+	// VirtualNodes is a number of points on a ring per member
+	VirtualNodes int
+	// Timeout is returned as DefaultTimeout
+	Timeout time.Duration
+
+	m       sync.Mutex
+	ring    ring
+	members map[string]Service
+}
+
+func NewSharded(key func(*Request) []byte) *ShardedService {
+	return &ShardedService{Key: key}
+}
+
+func (s *ShardedService) vnodes() int {
+	if s.VirtualNodes > 0 {
+		return s.VirtualNodes
+	}
+	return DefaultVirtualNodes
+}
+
+// Add puts member service on a ring. Member with same name is replaced.
+func (s *ShardedService) Add(name string, serv Service) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	members := make(map[string]Service, len(s.members)+1)
+	for n, m := range s.members {
+		members[n] = m
+	}
+	_, replace := members[name]
+	members[name] = serv
+	if !replace {
+		n := s.vnodes()
+		newRing := make(ring, len(s.ring), len(s.ring)+n)
+		copy(newRing, s.ring)
+		for i := 0; i < n; i++ {
+			h := crc32.ChecksumIEEE([]byte(name + "#" + strconv.Itoa(i)))
+			newRing = append(newRing, ringPoint{hash: h, name: name})
+		}
+		sort.Stable(newRing)
+		s.ring = newRing
+	}
+	s.members = members
+}
+
+// Remove takes member off a ring
+func (s *ShardedService) Remove(name string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, ok := s.members[name]; !ok {
+		return
+	}
+	members := make(map[string]Service, len(s.members))
+	for n, m := range s.members {
+		if n != name {
+			members[n] = m
+		}
+	}
+	newRing := make(ring, 0, len(s.ring))
+	for _, p := range s.ring {
+		if p.name != name {
+			newRing = append(newRing, p)
+		}
+	}
+	s.members, s.ring = members, newRing
+}
+
+// Members returns names of all members
+func (s *ShardedService) Members() (names []string) {
+	s.m.Lock()
+	for name := range s.members {
+		names = append(names, name)
+	}
+	s.m.Unlock()
+	sort.Strings(names)
+	return
+}
+
+// Shard returns name and service of a member which owns a key
+func (s *ShardedService) Shard(key []byte) (name string, serv Service) {
+	s.m.Lock()
+	r, members := s.ring, s.members
+	s.m.Unlock()
+	if len(r) == 0 {
+		return
+	}
+	h := crc32.ChecksumIEEE(key)
+	i := sort.Search(len(r), func(i int) bool { return r[i].hash >= h })
+	if i == len(r) {
+		i = 0
+	}
+	name = r[i].name
+	return name, members[name]
+}
+
+func (s *ShardedService) Send(r *Request) {
+	if _, serv := s.Shard(s.Key(r)); serv != nil {
+		serv.Send(r)
+	} else {
+		r.IOError()
+	}
+}
+
+func (s *ShardedService) DefaultTimeout() time.Duration {
+	return s.Timeout
+}
+
+func (s *ShardedService) Runned() bool {
+	return true
+}
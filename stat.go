@@ -13,6 +13,16 @@ func (ss *StatService) Send(r *Request) {
 	}
 }
 
+func (ss *StatService) SendBatch(reqs []*Request) {
+	batch := make([]*Request, 0, len(reqs))
+	for _, r := range reqs {
+		if r.ChainBookmark(&statBookmark{f: ss.F, e: NowEpoch()}) {
+			batch = append(batch, r)
+		}
+	}
+	SendBatch(ss.Service, batch)
+}
+
 type statBookmark struct {
 	Bookmark
 	f func(*Request, time.Duration)
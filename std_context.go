@@ -0,0 +1,121 @@
+package iproto
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// FromStd creates Context which is canceled when std is canceled and expired
+// when std deadline exceeded.
+// Context.Done should be called to release goroutine watching for std.
+func FromStd(std context.Context) (cx *Context) {
+	cx = &Context{}
+	cx.follow(std)
+	return
+}
+
+// ChildStd creates child Context which is canceled either with parent or with std.
+func (c *Context) ChildStd(std context.Context) (child *Context) {
+	child, _ = c.Child()
+	child.follow(std)
+	return
+}
+
+func (c *Context) follow(std context.Context) {
+	c.std = std
+	done := std.Done()
+	if done == nil {
+		return
+	}
+	select {
+	case <-done:
+		c.stdFired()
+		return
+	default:
+	}
+	c.stdStop = make(chan struct{})
+	go c.stdLoop(done, c.stdStop)
+}
+
+func (c *Context) stdLoop(done <-chan struct{}, stop <-chan struct{}) {
+	select {
+	case <-done:
+		c.stdFired()
+	case <-stop:
+	}
+}
+
+func (c *Context) stdFired() {
+	if c.std.Err() == context.DeadlineExceeded {
+		c.Expire()
+	} else {
+		c.Cancel()
+	}
+}
+
+func (c *Context) closeStd() {
+	c.m.Lock()
+	if c.stdDone != nil && !c.stdClosed {
+		c.stdClosed = true
+		close(c.stdDone)
+	}
+	c.m.Unlock()
+}
+
+func (c *Context) stdDoneChan() (ch chan struct{}) {
+	c.m.Lock()
+	if c.stdDone == nil {
+		c.stdDone = make(chan struct{})
+	}
+	if !c.stdClosed && atomic.LoadUint32((*uint32)(&c.State)) != uint32(CxOK) {
+		c.stdClosed = true
+		close(c.stdDone)
+	}
+	ch = c.stdDone
+	c.m.Unlock()
+	return
+}
+
+// Std exposes Context as context.Context.
+// Its Done channel is closed when Context is canceled or expired.
+// Deadline and Value are taken from nearest context.Context the Context were created with,
+// children created with Child inherit it from parent.
+func (c *Context) Std() context.Context {
+	return stdContext{c}
+}
+
+type stdContext struct {
+	c *Context
+}
+
+func (s stdContext) Deadline() (deadline time.Time, ok bool) {
+	if std := s.c.std; std != nil {
+		return std.Deadline()
+	}
+	return
+}
+
+func (s stdContext) Done() <-chan struct{} {
+	return s.c.stdDoneChan()
+}
+
+// Err is derived from Done channel, so it is not nil only after channel is closed
+func (s stdContext) Err() error {
+	select {
+	case <-s.c.stdDoneChan():
+	default:
+		return nil
+	}
+	if CxState(atomic.LoadUint32((*uint32)(&s.c.State))) == CxTimeout {
+		return context.DeadlineExceeded
+	}
+	return context.Canceled
+}
+
+func (s stdContext) Value(key interface{}) interface{} {
+	if std := s.c.std; std != nil {
+		return std.Value(key)
+	}
+	return nil
+}
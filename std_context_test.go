@@ -0,0 +1,139 @@
+package iproto
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type stdKey struct{}
+
+// loadState reads state changed by CAS in other goroutines
+func loadState(cx *Context) CxState {
+	return CxState(atomic.LoadUint32((*uint32)(&cx.State)))
+}
+
+func waitState(t *testing.T, cx *Context, state CxState) {
+	t.Helper()
+	select {
+	case <-cx.Std().Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Context was not finished, state %d", loadState(cx))
+	}
+	if got := loadState(cx); got != state {
+		t.Errorf("State %d, expect %d", got, state)
+	}
+}
+
+func TestFromStdCancel(t *testing.T) {
+	std, cancel := context.WithCancel(context.WithValue(context.Background(), stdKey{}, "v"))
+	cx := FromStd(std)
+	defer cx.Done()
+	std = cx.Std()
+	if std.Err() != nil {
+		t.Fatalf("Err %v before cancel", std.Err())
+	}
+	if v := std.Value(stdKey{}); v != "v" {
+		t.Errorf("Value %v, expect v", v)
+	}
+	cancel()
+	waitState(t, cx, CxCanceled)
+	if std.Err() != context.Canceled {
+		t.Errorf("Err %v, expect %v", std.Err(), context.Canceled)
+	}
+}
+
+func TestFromStdDeadline(t *testing.T) {
+	deadline := time.Now().Add(10 * time.Millisecond)
+	std, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	cx := FromStd(std)
+	defer cx.Done()
+	if d, ok := cx.Std().Deadline(); !ok || !d.Equal(deadline) {
+		t.Errorf("Deadline %v %v, expect %v", d, ok, deadline)
+	}
+	waitState(t, cx, CxTimeout)
+	if err := cx.Std().Err(); err != context.DeadlineExceeded {
+		t.Errorf("Err %v, expect %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestFromStdFinished(t *testing.T) {
+	std, cancel := context.WithCancel(context.Background())
+	cancel()
+	cx := FromStd(std)
+	defer cx.Done()
+	if got := loadState(cx); got != CxCanceled {
+		t.Errorf("State %d, expect canceled", got)
+	}
+}
+
+func TestChildStd(t *testing.T) {
+	std, cancel := context.WithCancel(context.Background())
+	parent := &Context{}
+	child := parent.ChildStd(std)
+	cancel()
+	waitState(t, child, CxCanceled)
+	if !parent.Alive() {
+		t.Errorf("Parent is canceled with child's context.Context")
+	}
+	child.Done()
+
+	child = parent.ChildStd(context.Background())
+	// Cancel waits for child to be done
+	go parent.Cancel()
+	waitState(t, child, CxCanceled)
+	child.Done()
+}
+
+func TestStd(t *testing.T) {
+	cx := &Context{}
+	std := cx.Std()
+	if _, ok := std.Deadline(); ok {
+		t.Errorf("Context without context.Context has deadline")
+	}
+	if std.Value(stdKey{}) != nil {
+		t.Errorf("Context without context.Context has value")
+	}
+	select {
+	case <-std.Done():
+		t.Fatalf("Done is closed before cancel")
+	default:
+	}
+	cx.Expire()
+	waitState(t, cx, CxTimeout)
+	if std.Err() != context.DeadlineExceeded {
+		t.Errorf("Err %v, expect %v", std.Err(), context.DeadlineExceeded)
+	}
+}
+
+func TestStdChildInherits(t *testing.T) {
+	std := context.WithValue(context.Background(), stdKey{}, "v")
+	parent := FromStd(std)
+	child, _ := parent.Child()
+	cstd := child.Std()
+	// child may finish concurrently with reading its Value
+	go child.Done()
+	if v := cstd.Value(stdKey{}); v != "v" {
+		t.Errorf("Value %v, expect v", v)
+	}
+	parent.Done()
+}
+
+func TestStdErrAfterDone(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		cx := &Context{}
+		std := cx.Std()
+		go cx.Cancel()
+		for std.Err() == nil {
+			runtime.Gosched()
+		}
+		select {
+		case <-std.Done():
+		default:
+			t.Fatalf("Err is set before Done is closed")
+		}
+	}
+}
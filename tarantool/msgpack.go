@@ -0,0 +1,16 @@
+package tarantool
+
+import (
+	"github.com/funny-falcon/go-iproto/marshal"
+)
+
+// Ext is a msgpack extension value, such as decimal or uuid
+type Ext = marshal.Ext
+
+// Decode decodes one msgpack value, integers are decoded as uint64 or int64,
+// arrays as []interface{} and maps as map[interface{}]interface{}
+func Decode(b []byte) (v interface{}, rest []byte, err error) {
+	r := marshal.MsgpackReader{Reader: &marshal.Reader{Body: b}}
+	v = r.Any()
+	return v, r.Body, r.Err
+}
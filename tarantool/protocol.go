@@ -0,0 +1,362 @@
+/*
+Package tarantool implements MessagePack framed IPROTO protocol of Tarantool 1.6+
+for client.Server, and requests in its format.
+
+	proto := &tarantool.Protocol{User: "app", Password: "secret"}
+	serv := client.ServerConfig{Address: "localhost:3301", Protocol: proto}.NewServer()
+	iproto.Run(serv)
+	res := iproto.Call(serv, tarantool.Select{Space: 512, Key: []interface{}{1}})
+	tuples, err := tarantool.Data(res)
+
+Errors of Tarantool are returned as codes of Fatal kind with error number in upper bits,
+see Code and ErrorNumber, and with error message as response body.
+*/
+package tarantool
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/marshal"
+	nt "github.com/funny-falcon/go-iproto/net"
+)
+
+// request types
+const (
+	OpSelect  = iproto.RequestType(1)
+	OpInsert  = iproto.RequestType(2)
+	OpReplace = iproto.RequestType(3)
+	OpUpdate  = iproto.RequestType(4)
+	OpDelete  = iproto.RequestType(5)
+	OpCall16  = iproto.RequestType(6)
+	OpAuth    = iproto.RequestType(7)
+	OpEval    = iproto.RequestType(8)
+	OpCall    = iproto.RequestType(10)
+	OpPing    = iproto.RequestType(64)
+)
+
+// keys of header and body maps
+const (
+	keyCode         = 0x00
+	keySync         = 0x01
+	keySchemaId     = 0x05
+	keySpaceId      = 0x10
+	keyIndexId      = 0x11
+	keyLimit        = 0x12
+	keyOffset       = 0x13
+	keyIterator     = 0x14
+	keyKey          = 0x20
+	keyTuple        = 0x21
+	keyFunctionName = 0x22
+	keyUserName     = 0x23
+	keyExpr         = 0x27
+	keyOps          = 0x28
+	keyData         = 0x30
+	keyError        = 0x31
+)
+
+const (
+	greetingSize = 128
+	scrambleSize = 20
+	errorFlag    = 0x8000
+	// maxHeader is enough for header map of code, sync and schema id
+	maxHeader = 32
+)
+
+// Code converts Tarantool error number to RetCode of Fatal kind
+func Code(errno uint32) iproto.RetCode {
+	return iproto.RetCode(errno)<<8 | iproto.RcFatal
+}
+
+// ErrorNumber returns Tarantool error number of code returned by Protocol
+func ErrorNumber(code iproto.RetCode) uint32 {
+	return uint32(code >> 8)
+}
+
+// Some of Tarantool error codes
+var (
+	RcTupleFound         = Code(3)
+	RcNoSuchProc         = Code(33)
+	RcNoSuchIndex        = Code(35)
+	RcNoSuchSpace        = Code(36)
+	RcAccessDenied       = Code(42)
+	RcNoSuchUser         = Code(45)
+	RcPasswordMismatch   = Code(47)
+	RcUnknownRequestType = Code(48)
+)
+
+func init() {
+	for code, name := range map[iproto.RetCode]string{
+		RcTupleFound:         "tuple found",
+		RcNoSuchProc:         "no such proc",
+		RcNoSuchIndex:        "no such index",
+		RcNoSuchSpace:        "no such space",
+		RcAccessDenied:       "access denied",
+		RcNoSuchUser:         "no such user",
+		RcPasswordMismatch:   "password mismatch",
+		RcUnknownRequestType: "unknown request type",
+	} {
+		iproto.RetCodeNames[code] = name
+	}
+}
+
+var ErrGreeting = errors.New("tarantool: wrong greeting")
+
+// Protocol is a nt.Protocol for client.ServerConfig, it could be shared by connections.
+// Connection authenticates with chap-sha1, if User is set.
+type Protocol struct {
+	User     string
+	Password string
+
+	schemaId uint64
+	version  atomic.Value
+}
+
+var _ nt.Protocol = (*Protocol)(nil)
+
+// SchemaId is a last schema id seen in responses
+func (p *Protocol) SchemaId() uint64 {
+	return atomic.LoadUint64(&p.schemaId)
+}
+
+// Version is a first line of last greeting, such as "Tarantool 1.10.2 (Binary) uuid"
+func (p *Protocol) Version() string {
+	v, _ := p.version.Load().(string)
+	return v
+}
+
+func (p *Protocol) Handshake(conn nt.NetConn, r nt.FrameReader, timeout time.Duration) (err error) {
+	if d, ok := conn.(nt.SetDeadliner); ok && timeout > 0 {
+		d.SetReadDeadline(time.Now().Add(timeout))
+		d.SetWriteDeadline(time.Now().Add(timeout))
+		defer d.SetReadDeadline(time.Time{})
+		defer d.SetWriteDeadline(time.Time{})
+	}
+
+	greeting := make([]byte, greetingSize)
+	if _, err = io.ReadFull(conn, greeting); err != nil {
+		return
+	}
+	version := string(bytes.TrimRight(greeting[:greetingSize/2], " \n\x00"))
+	if !bytes.HasPrefix(greeting, []byte("Tarantool")) {
+		return ErrGreeting
+	}
+	p.version.Store(version)
+	if p.User == "" {
+		return nil
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(string(bytes.TrimRight(greeting[greetingSize/2:], " \n\x00")))
+	if err != nil || len(salt) < scrambleSize {
+		return ErrGreeting
+	}
+	w := marshal.MsgpackWriter{Writer: &marshal.Writer{}}
+	w.MapHeader(2)
+	w.Uint(keyUserName)
+	w.Str(p.User)
+	w.Uint(keyTuple)
+	w.ArrayHeader(2)
+	w.Str("chap-sha1")
+	w.Bin(scramble(salt[:scrambleSize], p.Password))
+	if _, err = conn.Write(writeFrame(w, OpAuth, 0, w.Written())); err != nil {
+		return
+	}
+
+	res, err := r.ReadResponse()
+	if err == nil && res.Code != iproto.RcOK {
+		err = &iproto.Error{Code: res.Code, Body: res.Body}
+	}
+	return
+}
+
+// scramble is xor(sha1(password), sha1(salt, sha1(sha1(password))))
+func scramble(salt []byte, password string) []byte {
+	step1 := sha1.Sum([]byte(password))
+	step2 := sha1.Sum(step1[:])
+	h := sha1.New()
+	h.Write(salt)
+	h.Write(step2[:])
+	step3 := h.Sum(nil)
+	for i := range step3 {
+		step3[i] ^= step1[i]
+	}
+	return step3
+}
+
+// writeFrame writes length, header with code and sync, and body, and returns written frame
+func writeFrame(w marshal.MsgpackWriter, msg iproto.RequestType, sync uint32, body []byte) []byte {
+	w.Need(5)[0] = 0xce
+	w.MapHeader(2)
+	w.Uint(keyCode)
+	w.Uint(uint64(msg))
+	w.Uint(keySync)
+	w.Uint(uint64(sync))
+	w.Bytes(body)
+	frame := w.Written()
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(frame)-5))
+	return frame
+}
+
+func (p *Protocol) NewReader(r io.Reader, timeout time.Duration) nt.FrameReader {
+	return &reader{r: nt.NewSliceReader(r, timeout), p: p}
+}
+
+func (p *Protocol) NewWriter(w io.Writer, timeout time.Duration) nt.FrameWriter {
+	return &writer{w: nt.NewBufWriter(w, timeout), mw: marshal.MsgpackWriter{Writer: &marshal.Writer{}}}
+}
+
+type reader struct {
+	r       *nt.SliceReader
+	p       *Protocol
+	maxBody int
+}
+
+func (r *reader) SetMaxBody(max int) {
+	r.maxBody = max
+}
+
+func (r *reader) length() (n uint64, err error) {
+	var c byte
+	if c, err = r.r.ReadByte(); err != nil {
+		return
+	}
+	var p []byte
+	switch {
+	case c < 0x80:
+		return uint64(c), nil
+	case c >= 0xcc && c <= 0xcf:
+		if p, err = r.r.Read(1 << (c - 0xcc)); err != nil {
+			return
+		}
+	default:
+		return 0, fmt.Errorf("tarantool: wrong frame length code %#x", c)
+	}
+	for _, b := range p {
+		n = n<<8 | uint64(b)
+	}
+	return n, nil
+}
+
+func (r *reader) ReadResponse() (res nt.Response, err error) {
+	var n uint64
+	if n, err = r.length(); err != nil {
+		return
+	}
+	if r.maxBody > 0 && n > uint64(r.maxBody) {
+		return res, r.tooLarge(n)
+	}
+	var frame []byte
+	if frame, err = r.r.Read(int(n)); err != nil {
+		return
+	}
+	return r.p.parse(frame)
+}
+
+// tooLarge reads header of frame of length n, so error tells which request is answered,
+// body is left unread
+func (r *reader) tooLarge(n uint64) error {
+	tl := &nt.FrameTooLarge{Size: uint32(n), Max: r.maxBody}
+	size := n
+	if size > maxHeader {
+		size = maxHeader
+	}
+	if head, err := r.r.Read(int(size)); err == nil {
+		mr := marshal.MsgpackReader{Reader: &marshal.Reader{Body: head}}
+		var res nt.Response
+		if _, res = r.p.header(mr); mr.Err == nil {
+			tl.Msg, tl.Id = res.Msg, res.Id
+		}
+	}
+	return tl
+}
+
+// header reads header map of frame into code, and Msg and Id of res
+func (p *Protocol) header(r marshal.MsgpackReader) (code uint64, res nt.Response) {
+	var sync uint64
+	for n := r.MapHeader(); n > 0 && r.Err == nil; n-- {
+		switch r.Uint() {
+		case keyCode:
+			code = r.Uint()
+		case keySync:
+			sync = r.Uint()
+		case keySchemaId:
+			atomic.StoreUint64(&p.schemaId, r.Uint())
+		default:
+			r.Skip()
+		}
+	}
+	res.Id = uint32(sync)
+	if res.Id == iproto.PingRequestId {
+		res.Msg = iproto.Ping
+	}
+	return
+}
+
+func (p *Protocol) parse(frame []byte) (res nt.Response, err error) {
+	r := marshal.MsgpackReader{Reader: &marshal.Reader{Body: frame}}
+	var code uint64
+	if code, res = p.header(r); r.Err != nil {
+		return res, r.Err
+	}
+	if code&errorFlag == 0 {
+		res.Body = r.Body
+		return
+	}
+	res.Code = Code(uint32(code &^ errorFlag))
+	for n := r.MapHeader(); n > 0 && r.Err == nil; n-- {
+		if r.Uint() == keyError {
+			res.Body = r.Bin()
+		} else {
+			r.Skip()
+		}
+	}
+	return res, r.Err
+}
+
+func (r *reader) ReadPing() (err error) {
+	var res nt.Response
+	if res, err = r.ReadResponse(); err != nil {
+		return
+	}
+	if res.Msg != iproto.Ping || res.Code != iproto.RcOK {
+		err = errors.New("Iproto ping failed")
+	}
+	return
+}
+
+type writer struct {
+	w  *nt.BufWriter
+	mw marshal.MsgpackWriter
+}
+
+func (w *writer) WriteRequest(req nt.Request) error {
+	return w.w.Write(writeFrame(w.mw, req.Msg, req.Id, req.Body))
+}
+
+func (w *writer) Ping() error {
+	return w.WriteRequest(nt.Request{Msg: OpPing, Id: iproto.PingRequestId})
+}
+
+func (w *writer) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *writer) Buffered() int {
+	return w.w.Buffered()
+}
+
+func (w *writer) Written() int64 {
+	return w.w.Written()
+}
+
+func (w *writer) SetBufferSize(size int) {
+	w.w.SetSize(size)
+}
@@ -0,0 +1,280 @@
+package tarantool
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/marshal"
+	nt "github.com/funny-falcon/go-iproto/net"
+	"github.com/funny-falcon/go-iproto/net/client"
+)
+
+var salt = []byte("0123456789abcdefghijABCDEFGHIJ==")
+
+// fakeServer answers as Tarantool: space 512 has tuple [1, "one"], anything else is an error
+func fakeServer(t *testing.T, password string) (addr string, stop func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveFake(t, c, password)
+		}
+	}()
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func fakeGreeting() []byte {
+	greeting := make([]byte, greetingSize)
+	for i := range greeting {
+		greeting[i] = ' '
+	}
+	copy(greeting, "Tarantool 1.10.0 (Binary) fake")
+	greeting[63] = '\n'
+	copy(greeting[64:], base64.StdEncoding.EncodeToString(salt))
+	greeting[127] = '\n'
+	return greeting
+}
+
+func serveFake(t *testing.T, c net.Conn, password string) {
+	defer c.Close()
+	if _, err := c.Write(fakeGreeting()); err != nil {
+		return
+	}
+	head := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(c, head); err != nil {
+			return
+		}
+		frame := make([]byte, binary.BigEndian.Uint32(head[1:]))
+		if _, err := io.ReadFull(c, frame); err != nil {
+			return
+		}
+		h, rest, _ := Decode(frame)
+		header := h.(map[interface{}]interface{})
+		b, _, _ := Decode(rest)
+		body, _ := b.(map[interface{}]interface{})
+		sync := uint32(header[uint64(keySync)].(uint64))
+
+		var code uint64
+		var data []interface{}
+		var msg string
+		switch iproto.RequestType(header[uint64(keyCode)].(uint64)) {
+		case OpAuth:
+			auth := body[uint64(keyTuple)].([]interface{})
+			if !bytes.Equal(auth[1].([]byte), scramble(salt[:scrambleSize], password)) {
+				code, msg = 47, "Incorrect password supplied for user 'app'"
+			}
+		case OpPing:
+		case OpSelect:
+			if body[uint64(keySpaceId)].(uint64) != 512 {
+				code, msg = 36, "Space '1' does not exist"
+				break
+			}
+			data = []interface{}{[]interface{}{1, "one"}}
+		case OpCall:
+			data = []interface{}{body[uint64(keyFunctionName)], body[uint64(keyTuple)]}
+		default:
+			code, msg = 48, "Unknown request type"
+		}
+
+		w := marshal.MsgpackWriter{Writer: &marshal.Writer{}}
+		w.Need(5)[0] = 0xce
+		w.MapHeader(3)
+		w.Uint(keySync)
+		w.Uint(uint64(sync))
+		w.Uint(keySchemaId)
+		w.Uint(7)
+		w.Uint(keyCode)
+		if code != 0 {
+			w.Uint(errorFlag | code)
+			w.MapHeader(1)
+			w.Uint(keyError)
+			w.Str(msg)
+		} else {
+			w.Uint(0)
+			w.MapHeader(1)
+			w.Uint(keyData)
+			w.Encode(data)
+		}
+		frame = w.Written()
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(frame)-5))
+		if _, err := c.Write(frame); err != nil {
+			return
+		}
+	}
+}
+
+func TestProtocol(t *testing.T) {
+	addr, stop := fakeServer(t, "secret")
+	defer stop()
+
+	proto := &Protocol{User: "app", Password: "secret"}
+	cli, err := client.New(client.ServerConfig{Address: addr, Protocol: proto, Timeout: time.Second, Logger: iproto.NopLogger{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	iproto.Run(cli)
+	defer cli.Stop()
+
+	data, err := Data(iproto.Call(cli, Select{Space: 512, Key: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data, []interface{}{[]interface{}{uint64(1), "one"}}) {
+		t.Errorf("unexpected select result %#v", data)
+	}
+	type tuple struct {
+		Id   int
+		Name string
+	}
+	var tuples []tuple
+	if err = ReadData(iproto.Call(cli, Select{Space: 512, Key: 1}), &tuples); err != nil || len(tuples) != 1 || tuples[0] != (tuple{1, "one"}) {
+		t.Errorf("unexpected select result %#v %v", tuples, err)
+	}
+	if proto.SchemaId() != 7 {
+		t.Errorf("schema id should be remembered, got %d", proto.SchemaId())
+	}
+	if v := proto.Version(); v != "Tarantool 1.10.0 (Binary) fake" {
+		t.Errorf("unexpected version %q", v)
+	}
+
+	data, err = Data(iproto.Call(cli, Call{Name: "f", Args: []interface{}{"a", -1}}))
+	if err != nil || !reflect.DeepEqual(data, []interface{}{"f", []interface{}{"a", int64(-1)}}) {
+		t.Errorf("unexpected call result %#v %v", data, err)
+	}
+
+	res := iproto.Call(cli, Select{Space: 1})
+	if res.Code != RcNoSuchSpace || ErrorNumber(res.Code) != 36 || res.Code.Kind() != iproto.RcFatal {
+		t.Errorf("no such space expected, got %x", res.Code)
+	}
+	if _, err = Data(res); err == nil || string(res.Body) != "Space '1' does not exist" {
+		t.Errorf("error message expected, got %v %q", err, res.Body)
+	}
+	if res = iproto.Call(cli, Ping{}); res.Code != iproto.RcOK {
+		t.Errorf("ping failed %x", res.Code)
+	}
+}
+
+func TestAuthFailed(t *testing.T) {
+	addr, stop := fakeServer(t, "secret")
+	defer stop()
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	proto := &Protocol{User: "app", Password: "wrong"}
+	err = proto.Handshake(c.(*net.TCPConn), proto.NewReader(c, 0), time.Second)
+	if iproto.Code(err) != RcPasswordMismatch {
+		t.Errorf("password mismatch expected, got %v", err)
+	}
+}
+
+// okFrame is a frame of successful response with body
+func okFrame(sync uint32, body []byte) []byte {
+	return writeFrame(marshal.MsgpackWriter{Writer: &marshal.Writer{}}, 0, sync, body)
+}
+
+func TestHandshakeReader(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	go func() {
+		defer srv.Close()
+		srv.Write(fakeGreeting())
+		head := make([]byte, 5)
+		if _, err := io.ReadFull(srv, head); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(srv, make([]byte, binary.BigEndian.Uint32(head[1:]))); err != nil {
+			return
+		}
+		// ping reply arrives together with auth reply
+		srv.Write(append(okFrame(0, nil), okFrame(iproto.PingRequestId, nil)...))
+	}()
+
+	proto := &Protocol{User: "app", Password: "secret"}
+	r := proto.NewReader(cli, time.Second)
+	if err := proto.Handshake(nt.RwcWrapper{ReadWriteCloser: cli}, r, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ReadPing(); err != nil {
+		t.Errorf("Frame after auth reply is lost: %v", err)
+	}
+}
+
+func TestFrameTooLarge(t *testing.T) {
+	for _, expect := range []nt.FrameTooLarge{
+		{Id: 5, Size: 105, Max: 10},
+		{Msg: iproto.Ping, Id: iproto.PingRequestId, Size: 109, Max: 10},
+	} {
+		r := (&Protocol{}).NewReader(bytes.NewReader(okFrame(expect.Id, make([]byte, 100))), 0)
+		r.SetMaxBody(10)
+		_, err := r.ReadResponse()
+		if tl, ok := err.(*nt.FrameTooLarge); !ok || *tl != expect {
+			t.Errorf("Expect %+v, got %#v", expect, err)
+		}
+	}
+
+	// header is cut by end of frame
+	r := (&Protocol{}).NewReader(bytes.NewReader([]byte{3, 0x81, keySync, 0xce}), 0)
+	r.SetMaxBody(2)
+	_, err := r.ReadResponse()
+	if tl, ok := err.(*nt.FrameTooLarge); !ok || tl.Id != 0 || tl.Size != 3 {
+		t.Errorf("Expect FrameTooLarge without id, got %#v", err)
+	}
+}
+
+func TestRequests(t *testing.T) {
+	body := marshal.Write(Update{Space: 1, Key: "k", Ops: []Op{
+		{Op: "+", Field: 2, Arg: 3},
+		{Op: ":", Field: 1, Arg: Splice{Offset: 0, Len: 1, Str: "x"}},
+	}})
+	v, rest, err := Decode(body)
+	if err != nil || len(rest) != 0 {
+		t.Fatal(err, rest)
+	}
+	expected := map[interface{}]interface{}{
+		uint64(keySpaceId): uint64(1),
+		uint64(keyIndexId): uint64(0),
+		uint64(keyKey):     []interface{}{"k"},
+		uint64(keyOps): []interface{}{
+			[]interface{}{"+", uint64(2), uint64(3)},
+			[]interface{}{":", uint64(1), uint64(0), uint64(1), "x"},
+		},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("unexpected update body %#v", v)
+	}
+
+	type tuple struct {
+		Id   uint32
+		Name string
+		skip int
+		Rate float64
+	}
+	v, _, err = Decode(marshal.Write(Insert{Space: 2, Tuple: tuple{Id: 5, Name: "five", Rate: 0.5}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = map[interface{}]interface{}{
+		uint64(keySpaceId): uint64(2),
+		uint64(keyTuple):   []interface{}{uint64(5), "five", 0.5},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("unexpected insert body %#v", v)
+	}
+}
@@ -0,0 +1,265 @@
+package tarantool
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/marshal"
+)
+
+// Iterator types of Select
+const (
+	IterEq  = uint32(0)
+	IterReq = uint32(1)
+	IterAll = uint32(2)
+	IterLt  = uint32(3)
+	IterLe  = uint32(4)
+	IterGe  = uint32(5)
+	IterGt  = uint32(6)
+)
+
+// Select selects tuples by Key, which is a value or a slice of values of index parts.
+// Zero Limit means no limit.
+type Select struct {
+	Space    uint32
+	Index    uint32
+	Offset   uint32
+	Limit    uint32
+	Iterator uint32
+	Key      interface{}
+}
+
+func (r Select) IMsg() iproto.RequestType { return OpSelect }
+
+func (r Select) IWrite(w *marshal.Writer) {
+	limit := r.Limit
+	if limit == 0 {
+		limit = ^uint32(0)
+	}
+	mw := marshal.MsgpackWriter{Writer: w}
+	mw.MapHeader(6)
+	mw.Uint(keySpaceId)
+	mw.Uint(uint64(r.Space))
+	mw.Uint(keyIndexId)
+	mw.Uint(uint64(r.Index))
+	mw.Uint(keyOffset)
+	mw.Uint(uint64(r.Offset))
+	mw.Uint(keyLimit)
+	mw.Uint(uint64(limit))
+	mw.Uint(keyIterator)
+	mw.Uint(uint64(r.Iterator))
+	mw.Uint(keyKey)
+	mw.Encode(key(r.Key))
+}
+
+// Insert inserts Tuple, which is a slice or a struct
+type Insert struct {
+	Space uint32
+	Tuple interface{}
+}
+
+func (r Insert) IMsg() iproto.RequestType { return OpInsert }
+
+func (r Insert) IWrite(w *marshal.Writer) {
+	writeTuple(w, r.Space, r.Tuple)
+}
+
+// Replace inserts or replaces Tuple
+type Replace struct {
+	Space uint32
+	Tuple interface{}
+}
+
+func (r Replace) IMsg() iproto.RequestType { return OpReplace }
+
+func (r Replace) IWrite(w *marshal.Writer) {
+	writeTuple(w, r.Space, r.Tuple)
+}
+
+func writeTuple(w *marshal.Writer, space uint32, tuple interface{}) {
+	mw := marshal.MsgpackWriter{Writer: w}
+	mw.MapHeader(2)
+	mw.Uint(keySpaceId)
+	mw.Uint(uint64(space))
+	mw.Uint(keyTuple)
+	mw.Encode(tuple)
+}
+
+// Op is an update operation, such as {"=", 1, "val"} or {"+", 2, 1}.
+// Arg of ":" operation is Splice.
+type Op struct {
+	Op    string
+	Field int
+	Arg   interface{}
+}
+
+// Splice is argument of ":" operation
+type Splice struct {
+	Offset int
+	Len    int
+	Str    string
+}
+
+// Update updates tuple found by Key in Index
+type Update struct {
+	Space uint32
+	Index uint32
+	Key   interface{}
+	Ops   []Op
+}
+
+func (r Update) IMsg() iproto.RequestType { return OpUpdate }
+
+func (r Update) IWrite(w *marshal.Writer) {
+	mw := marshal.MsgpackWriter{Writer: w}
+	mw.MapHeader(4)
+	mw.Uint(keySpaceId)
+	mw.Uint(uint64(r.Space))
+	mw.Uint(keyIndexId)
+	mw.Uint(uint64(r.Index))
+	mw.Uint(keyKey)
+	mw.Encode(key(r.Key))
+	mw.Uint(keyOps)
+	mw.ArrayHeader(len(r.Ops))
+	for _, op := range r.Ops {
+		if s, ok := op.Arg.(Splice); ok {
+			mw.ArrayHeader(5)
+			mw.Str(op.Op)
+			mw.Int(int64(op.Field))
+			mw.Int(int64(s.Offset))
+			mw.Int(int64(s.Len))
+			mw.Str(s.Str)
+			continue
+		}
+		mw.ArrayHeader(3)
+		mw.Str(op.Op)
+		mw.Int(int64(op.Field))
+		mw.Encode(op.Arg)
+	}
+}
+
+// Delete deletes tuple found by Key in Index
+type Delete struct {
+	Space uint32
+	Index uint32
+	Key   interface{}
+}
+
+func (r Delete) IMsg() iproto.RequestType { return OpDelete }
+
+func (r Delete) IWrite(w *marshal.Writer) {
+	mw := marshal.MsgpackWriter{Writer: w}
+	mw.MapHeader(3)
+	mw.Uint(keySpaceId)
+	mw.Uint(uint64(r.Space))
+	mw.Uint(keyIndexId)
+	mw.Uint(uint64(r.Index))
+	mw.Uint(keyKey)
+	mw.Encode(key(r.Key))
+}
+
+// Call calls stored function Name, Args is a slice or a struct
+type Call struct {
+	Name string
+	Args interface{}
+}
+
+func (r Call) IMsg() iproto.RequestType { return OpCall }
+
+func (r Call) IWrite(w *marshal.Writer) {
+	writeCall(w, keyFunctionName, r.Name, r.Args)
+}
+
+// Call16 is a Call with Tarantool 1.6 semantic: result is always converted to tuples
+type Call16 Call
+
+func (r Call16) IMsg() iproto.RequestType { return OpCall16 }
+
+func (r Call16) IWrite(w *marshal.Writer) {
+	writeCall(w, keyFunctionName, r.Name, r.Args)
+}
+
+// Eval evaluates lua Expr with Args
+type Eval struct {
+	Expr string
+	Args interface{}
+}
+
+func (r Eval) IMsg() iproto.RequestType { return OpEval }
+
+func (r Eval) IWrite(w *marshal.Writer) {
+	writeCall(w, keyExpr, r.Expr, r.Args)
+}
+
+func writeCall(w *marshal.Writer, k uint64, s string, args interface{}) {
+	mw := marshal.MsgpackWriter{Writer: w}
+	mw.MapHeader(2)
+	mw.Uint(k)
+	mw.Str(s)
+	mw.Uint(keyTuple)
+	if args == nil {
+		mw.ArrayHeader(0)
+	} else {
+		mw.Encode(args)
+	}
+}
+
+// Ping is an empty request
+type Ping struct{}
+
+func (r Ping) IMsg() iproto.RequestType { return OpPing }
+
+func (r Ping) IWrite(w *marshal.Writer) {
+	mw := marshal.MsgpackWriter{Writer: w}
+	mw.MapHeader(0)
+}
+
+// key wraps single value into array
+func key(k interface{}) interface{} {
+	if k == nil {
+		return []interface{}{}
+	}
+	switch reflect.TypeOf(k).Kind() {
+	case reflect.Slice, reflect.Array:
+		if _, ok := k.([]byte); !ok {
+			return k
+		}
+	}
+	return []interface{}{k}
+}
+
+var ErrNoData = errors.New("tarantool: response has no data")
+
+// Data returns tuples or results of call from successful response,
+// or *iproto.Error for failed one
+func Data(res *iproto.Response) ([]interface{}, error) {
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+	var data []interface{}
+	err := ReadData(res, &data)
+	return data, err
+}
+
+// ReadData reads tuples or results of call into v, which is a pointer to slice,
+// tuples are read into structs as described in marshal.MsgpackReader
+//
+//	var users []User
+//	err := tarantool.ReadData(iproto.Call(serv, tarantool.Select{Space: 512, Iterator: tarantool.IterAll}), &users)
+func ReadData(res *iproto.Response, v interface{}) error {
+	if err := res.Err(); err != nil {
+		return err
+	}
+	r := marshal.MsgpackReader{Reader: &marshal.Reader{Body: res.Body}}
+	for n := r.MapHeader(); n > 0 && r.Err == nil; n-- {
+		if r.Uint() == keyData {
+			return r.Decode(v)
+		}
+		r.Skip()
+	}
+	if r.Err != nil {
+		return r.Err
+	}
+	return ErrNoData
+}
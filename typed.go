@@ -0,0 +1,42 @@
+package iproto
+
+// CallAs sends req to serv and reads successful response body into Resp.
+// Response with code other than RcOK is returned as *Error.
+// cx could be nil.
+//
+//	user, err := iproto.CallAs[User](cx, box, GetUser{Id: 1})
+func CallAs[Resp any, Req RequestData](cx *Context, serv Service, req Req) (resp Resp, err error) {
+	var res *Response
+	if cx != nil {
+		res = cx.Call(serv, req)
+	} else {
+		res = Call(serv, req)
+	}
+	if err = res.Err(); err == nil {
+		err = res.Body.Read(&resp)
+	}
+	return
+}
+
+// CallBatchAs sends requests as CallBatch does and reads every successful response into Resp.
+// errs[i] is nil if i-th request succeeded.
+func CallBatchAs[Resp any, Req RequestData](cx *Context, serv Service, reqs []Req) (resps []Resp, errs []error) {
+	data := make([]RequestData, len(reqs))
+	for i, r := range reqs {
+		data[i] = r
+	}
+	var results MultiResponse
+	if cx != nil {
+		results = cx.CallBatch(serv, data)
+	} else {
+		results = CallBatch(serv, data)
+	}
+	resps = make([]Resp, len(results))
+	errs = make([]error, len(results))
+	for i, res := range results {
+		if errs[i] = res.Err(); errs[i] == nil {
+			errs[i] = res.Body.Read(&resps[i])
+		}
+	}
+	return
+}
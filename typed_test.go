@@ -0,0 +1,91 @@
+package iproto_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/funny-falcon/go-iproto"
+)
+
+const msgGet = iproto.RequestType(23)
+
+type getReq struct {
+	Id uint32
+}
+
+func (getReq) IMsg() iproto.RequestType { return msgGet }
+
+type pair struct {
+	Id    uint32
+	Twice uint32
+}
+
+// pairService answers getReq with pair, id 0 is not found, and ids above 100 are listed up to id
+var pairService = iproto.SF(func(r *iproto.Request) {
+	var req getReq
+	if err := r.Body.Read(&req); err != nil {
+		r.Respond(iproto.RcProtocolError, nil)
+		return
+	}
+	switch {
+	case req.Id == 0:
+		r.RespondBytes(0x102, []byte("not found"))
+	case req.Id > 100:
+		var list []pair
+		for i := uint32(101); i < req.Id; i++ {
+			list = append(list, pair{i, i * 2})
+		}
+		r.Respond(iproto.RcOK, list)
+	default:
+		r.Respond(iproto.RcOK, pair{req.Id, req.Id * 2})
+	}
+})
+
+func TestCallAs(t *testing.T) {
+	p, err := iproto.CallAs[pair](nil, pairService, getReq{3})
+	if err != nil || p != (pair{3, 6}) {
+		t.Errorf("CallAs returned %+v %v", p, err)
+	}
+
+	var cx iproto.Context
+	p, err = iproto.CallAs[pair](&cx, pairService, getReq{0})
+	var e *iproto.Error
+	if !errors.As(err, &e) || e.Code != 0x102 || string(e.Body) != "not found" {
+		t.Errorf("Error code should be returned as *Error with body, got %v", err)
+	}
+	if p != (pair{}) {
+		t.Errorf("Failed CallAs should return zero value, got %+v", p)
+	}
+
+	list, err := iproto.CallAs[[]pair](nil, pairService, getReq{101})
+	if err != nil || len(list) != 0 {
+		t.Errorf("Empty result should be decoded as empty list, got %+v %v", list, err)
+	}
+	list, err = iproto.CallAs[[]pair](nil, pairService, getReq{103})
+	if err != nil || len(list) != 2 || list[1] != (pair{102, 204}) {
+		t.Errorf("Wrong list %+v %v", list, err)
+	}
+
+	if _, err = iproto.CallAs[[]pair](nil, pairService, getReq{3}); err == nil || errors.As(err, &e) {
+		t.Errorf("Body of wrong type should fail to decode, got %v", err)
+	}
+}
+
+func TestCallBatchAs(t *testing.T) {
+	resps, errs := iproto.CallBatchAs[pair](nil, pairService, []getReq{{1}, {0}, {2}})
+	if len(resps) != 3 || len(errs) != 3 {
+		t.Fatalf("Wrong count of results %d %d", len(resps), len(errs))
+	}
+	if errs[0] != nil || resps[0] != (pair{1, 2}) || errs[2] != nil || resps[2] != (pair{2, 4}) {
+		t.Errorf("Successful results are broken %+v %v", resps, errs)
+	}
+	if !errors.Is(errs[1], &iproto.Error{Code: 0x102}) || resps[1] != (pair{}) {
+		t.Errorf("Failed request should have error with its code, got %+v %v", resps[1], errs[1])
+	}
+
+	var cx iproto.Context
+	resps, errs = iproto.CallBatchAs[pair](&cx, pairService, []getReq(nil))
+	if len(resps) != 0 || len(errs) != 0 {
+		t.Errorf("Empty batch should have no results, got %+v %v", resps, errs)
+	}
+}
@@ -86,6 +86,9 @@ func (w *MultiRequest) Request(msg RequestType, body interface{}) *Request {
 	req := w.gen.Request(uint32(len(w.requests)), msg, body)
 	req.Responder = w
 	req.timerSet = w.timerSet
+	if w.cx != nil {
+		req.Priority = w.cx.Priority
+	}
 	if len(w.requests) == cap(w.requests) {
 		w.m.Lock()
 		if cap(w.requests) == 0 {
@@ -124,6 +127,15 @@ func (w *MultiRequest) Send(serv Service, r RequestData) *Request {
 	return req
 }
 
+// SendBatch creates requests and passes them to serv at once with SendBatch
+func (w *MultiRequest) SendBatch(serv Service, reqs []RequestData) {
+	batch := make([]*Request, len(reqs))
+	for i, r := range reqs {
+		batch[i] = w.Request(r.IMsg(), r)
+	}
+	SendBatch(serv, batch)
+}
+
 func (w *MultiRequest) Each() <-chan *Response {
 	if w.kind&mrFailed != 0 && w.c != w.r {
 		w.performFailAll()